@@ -0,0 +1,103 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+const (
+	// ConfigFileName is the name of the config file the agent reads
+	ConfigFileName = "config.json"
+	// ConfigFlag is the agent flag taking the path of its config file
+	ConfigFlag = "--config"
+	// StopCommand is the agent command, run in the container of a running agent,
+	// asking it to stop profiling early. The agent then reports what it sampled so
+	// far in a partial result.
+	StopCommand = "stop"
+	// StartedMarker prefixes the line the agent logs as soon as it starts,
+	// before it reads its config, acknowledging the version of the contract it
+	// implements:
+	//
+	//	---PROFILEPOD-AGENT-STARTED apiVersion=agent.profilepod.io/v1---
+	//
+	// The operator fails the target of an agent acknowledging another version
+	// without waiting for its result.
+	StartedMarker = "---PROFILEPOD-AGENT-STARTED"
+)
+
+// Config tells the agent what to profile and how. The agent refuses a config
+// whose APIVersion it does not implement, and answers with a result of the
+// same APIVersion.
+type Config struct {
+	// APIVersion is the version of the contract the config follows.
+	APIVersion string `json:"apiVersion"`
+
+	// Target is the container to profile.
+	Target Target `json:"target"`
+
+	// Duration is the profiling duration, e.g. 30s or 2m.
+	Duration string `json:"duration"`
+
+	// Event is the profiled event, e.g. cpu, alloc or perf:cache-misses.
+	Event string `json:"event"`
+
+	// EventOptions tune the sampling of Event.
+	// +optional
+	EventOptions EventOptions `json:"eventOptions,omitempty"`
+
+	// Languages are the languages Event can be profiled in, every language when
+	// empty. The agent fails with ErrorUnsupportedLanguage as soon as it detected
+	// another language, before profiling.
+	// +optional
+	Languages []string `json:"languages,omitempty"`
+
+	// Formats are the formats of the artifacts the agent should produce.
+	Formats []string `json:"formats"`
+}
+
+// Target identifies the profiled container on the node of the agent.
+type Target struct {
+	// PodUID is the uid of the target pod.
+	PodUID string `json:"podUID"`
+
+	// ContainerName is the name of the target container.
+	ContainerName string `json:"containerName"`
+
+	// ContainerID is the id of the target container without its runtime prefix.
+	ContainerID string `json:"containerID"`
+
+	// Runtime is the container runtime running the target, docker or containerd.
+	Runtime string `json:"runtime"`
+
+	// RuntimePath is where the host directory of the runtime is mounted in the agent.
+	RuntimePath string `json:"runtimePath"`
+}
+
+// EventOptions tune the sampling of the profiled event.
+type EventOptions struct {
+	// Interval is the sampling interval, in bytes for alloc or as a duration for wall.
+	Interval string `json:"interval,omitempty"`
+
+	// Threshold is the shortest recorded lock contention.
+	Threshold string `json:"threshold,omitempty"`
+
+	// SamplePeriod is the number of perf events between two samples.
+	SamplePeriod *int64 `json:"samplePeriod,omitempty"`
+
+	// Threads samples every thread separately.
+	Threads bool `json:"threads,omitempty"`
+
+	// TracefsPath is where the host tracefs is mounted in the agent.
+	TracefsPath string `json:"tracefsPath,omitempty"`
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1 contains version v1 of the contract between the operator and the
+// profile-pod agent.
+package v1
+
+import (
+	"time"
+)
+
+// APIVersion identifies version v1 of the agent contract.
+const APIVersion = "agent.profilepod.io/v1"
+
+const (
+	FormatHTML      = "html"
+	FormatCollapsed = "collapsed"
+	// FormatSamples is the timeline of the recorded samples, one tab separated
+	// "<unix time in nanoseconds>\t<thread>\t<weight>\t<frame;frame;...>" line per
+	// sample, the root frame first
+	FormatSamples = "samples"
+
+	// EncodingGzip is the encoding of gzipped artifact data
+	EncodingGzip = "gzip"
+	// EncodingIdentity is the encoding of uncompressed artifact data
+	EncodingIdentity = "identity"
+)
+
+// Error codes reported by the agent. The code of a failed agent becomes the
+// reason of its target.
+const (
+	ErrorTargetNotFound       = "TargetNotFound"
+	ErrorLanguageNotDetected  = "LanguageNotDetected"
+	ErrorUnsupportedLanguage  = "UnsupportedLanguage"
+	ErrorUnsupportedEvent     = "UnsupportedEvent"
+	ErrorPerfEventUnavailable = "PerfEventUnavailable"
+	ErrorProfilerFailed       = "ProfilerFailed"
+	ErrorInternal             = "InternalError"
+)
+
+const (
+	// DetailPerfEventParanoid is the perf_event_paranoid setting of the node
+	DetailPerfEventParanoid = "perf_event_paranoid"
+	// DetailExitCode is the exit code of a failed profiler
+	DetailExitCode = "exit_code"
+)
+
+// Result is the envelope the agent writes to its logs once it finished,
+// whether it succeeded or not.
+type Result struct {
+	// APIVersion is the version of the contract the envelope follows.
+	APIVersion string `json:"apiVersion"`
+
+	// Artifacts are the profiles produced by the agent.
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+
+	// Language is the programming language detected in the target container.
+	Language string `json:"language,omitempty"`
+
+	// PID is the host process id of the profiled process.
+	PID int32 `json:"pid,omitempty"`
+
+	// Profiler is the name and version of the profiler the agent ran, e.g. async-profiler/2.9.
+	Profiler string `json:"profiler,omitempty"`
+
+	// Samples is the number of samples recorded.
+	Samples int64 `json:"samples,omitempty"`
+
+	// StartTime and EndTime bound the profiling of the target.
+	StartTime *time.Time `json:"startTime,omitempty"`
+	EndTime   *time.Time `json:"endTime,omitempty"`
+
+	// Warnings are problems that did not prevent profiling.
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Partial is set when the agent was stopped before the requested duration
+	// elapsed, the artifacts then hold what was sampled until it stopped.
+	Partial bool `json:"partial,omitempty"`
+
+	// Error is set when the agent failed.
+	Error *Error `json:"error,omitempty"`
+}
+
+// Artifact is a profile in a single format.
+type Artifact struct {
+	// Format of the profile, html or collapsed.
+	Format string `json:"format"`
+
+	// Encoding of Data, gzip or identity.
+	Encoding string `json:"encoding"`
+
+	// Data is the encoded profile.
+	Data []byte `json:"data"`
+}
+
+// Error explains why the agent failed.
+type Error struct {
+	// Code is a machine readable error code.
+	Code string `json:"code"`
+
+	// Message is a human readable explanation.
+	Message string `json:"message,omitempty"`
+
+	// Details hold additional facts about the error, e.g. perf_event_paranoid.
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Artifact returns the artifact in format, or nil when the agent produced none.
+func (result *Result) Artifact(format string) *Artifact {
+	for i := range result.Artifacts {
+		if result.Artifacts[i].Format == format {
+			return &result.Artifacts[i]
+		}
+	}
+	return nil
+}
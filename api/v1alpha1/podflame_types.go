@@ -20,24 +20,42 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
-// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
-
 // PodFlameSpec defines the desired state of PodFlame
 type PodFlameSpec struct {
-	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
-
-	// +kubebuilder:validation:Required
+	// TargetPod is the name of a single pod to profile.
+	// Exactly one of targetPod, targetSelector and targetRef must be set.
+	// +optional
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	TargetPod string `json:"targetPod,omitempty"`
 
-	// +kubebuilder:validation:Enum:="cpu"
+	// TargetSelector selects the pods to profile in the PodFlame namespace.
+	// An agent pod is created for every running pod that matches the selector.
+	// Exactly one of targetPod, targetSelector and targetRef must be set.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	TargetSelector *metav1.LabelSelector `json:"targetSelector,omitempty"`
+
+	// TargetRef references a workload in the PodFlame namespace whose pods are profiled.
+	// Exactly one of targetPod, targetSelector and targetRef must be set.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	TargetRef *TargetReference `json:"targetRef,omitempty"`
+
+	// Event is the profiled event, one of cpu, alloc, wall, offcpu, lock or a
+	// perf:<event-name> hardware or software performance counter, e.g. perf:cache-misses.
+	// +kubebuilder:validation:Pattern:="^(cpu|alloc|wall|offcpu|lock|perf:[A-Za-z0-9_.-]+)$"
 	// +kubebuilder:validation:Required
 	// +kubebuilder:default:=cpu
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	Event string `json:"event,omitempty"`
 
+	// EventOptions holds options specific to the profiled event.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	EventOptions *EventOptions `json:"eventOptions,omitempty"`
+
+	// Duration is the time every target is profiled, or the duration of a window
+	// of a continuous PodFlame, in minutes and seconds, e.g. 2m or 1m30s.
 	// +kubebuilder:default:="2m"
 	// +kubebuilder:validation:Pattern:="^(([1-6]{0,1}[0-9])([mM]{1}))?(([1-6]{0,1}[0-9])([sS]{1}))?$"
 	// +kubebuilder:validation:MinLength:=1
@@ -45,28 +63,544 @@ type PodFlameSpec struct {
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	Duration string `json:"duration,omitempty"`
 
+	// ContainerName is the name of the profiled container of the target pods. It is
+	// required when they run more than one container and no default container is found.
 	// +optional
 	// +operator-sdk:csv:customresourcedefinitions:type=spec
 	ContainerName string `json:"containerName,omitempty"`
+
+	// Aggregate merges the profiles of all targets into a single profile.
+	// When set, the agents also produce collapsed stacks, which are merged.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Aggregate *AggregateSpec `json:"aggregate,omitempty"`
+
+	// Formats are the formats of the profiling results, html, svg, collapsed, pprof,
+	// speedscope or chrometrace. The agent produces html, collapsed stacks and timestamped
+	// samples, which the operator converts to the other formats. default: html.
+	// +optional
+	// +listType=set
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Formats []OutputFormat `json:"formats,omitempty"`
+
+	// Export overrides where the operator exports the profiles of this PodFlame.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Export *ExportSpec `json:"export,omitempty"`
+
+	// Continuous keeps profiling the targets in windows of duration, every interval,
+	// for as long as they live, instead of profiling them once.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Continuous *ContinuousSpec `json:"continuous,omitempty"`
+
+	// TTLSecondsAfterFinished deletes the PodFlame and its results once this number of
+	// seconds elapsed after it finished, successfully or not. 0 deletes it right after it
+	// finished. default: the TTL of the operator, which keeps finished PodFlames unless set.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+
+	// Cancel stops profiling early. Running agents stop and report what they sampled
+	// so far, which is stored as a partial profile, and the PodFlame ends Cancelled.
+	// It is the only field of the spec that can be changed. It can not be unset, but
+	// the runs started later by the rerun annotation are not cancelled.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Cancel bool `json:"cancel,omitempty"`
+}
+
+// ContinuousSpec defines the profiling windows of a continuous PodFlame
+type ContinuousSpec struct {
+	// Interval is the time between the starts of two profiling windows, e.g. 5m.
+	// It must be longer than the duration of the windows.
+	// +kubebuilder:validation:Pattern:="^([0-9]+(s|m|h))+$"
+	Interval string `json:"interval"`
+
+	// History is the number of windows kept for every target, the results of older windows are deleted.
+	// +kubebuilder:validation:Minimum:=1
+	// +kubebuilder:validation:Maximum:=100
+	// +kubebuilder:default:=12
+	// +optional
+	History int32 `json:"history,omitempty"`
+
+	// RollingAggregate merges the windows kept in history into a rolling profile of every target.
+	// +optional
+	RollingAggregate bool `json:"rollingAggregate,omitempty"`
 }
 
+// EventOptions defines the options of the profiled event
+type EventOptions struct {
+	// AllocInterval is the amount of allocated memory between two allocation samples,
+	// in bytes with an optional k, m or g suffix. Only valid with the alloc event.
+	// +kubebuilder:validation:Pattern:="^[0-9]+[kKmMgG]?$"
+	// +optional
+	AllocInterval string `json:"allocInterval,omitempty"`
+
+	// WallInterval is the wall clock time between two samples of every thread,
+	// e.g. 20ms. Only valid with the wall event.
+	// +kubebuilder:validation:Pattern:="^[0-9]+(ns|us|ms|s)$"
+	// +optional
+	WallInterval string `json:"wallInterval,omitempty"`
+
+	// LockThreshold is the minimum time a thread must wait on a lock for the
+	// contention to be recorded, e.g. 10ms. Only valid with the lock event.
+	// +kubebuilder:validation:Pattern:="^[0-9]+(ns|us|ms|s)$"
+	// +optional
+	LockThreshold string `json:"lockThreshold,omitempty"`
+
+	// SamplePeriod is the number of counted events between two samples.
+	// Only valid with perf events.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	SamplePeriod *int64 `json:"samplePeriod,omitempty"`
+}
+
+// AggregateSpec defines how the profiles of all targets are merged
+type AggregateSpec struct {
+	// PodRootFrame adds the target pod name as the root frame of its stacks.
+	// +optional
+	PodRootFrame bool `json:"podRootFrame,omitempty"`
+
+	// ContainerRootFrame adds the target container name as a root frame of its stacks,
+	// below the pod name when podRootFrame is set.
+	// +optional
+	ContainerRootFrame bool `json:"containerRootFrame,omitempty"`
+}
+
+// ExportSpec overrides the exporters configured on the operator
+type ExportSpec struct {
+	// OTLP overrides the OTLP profiles exporter of the operator.
+	// +optional
+	OTLP *OTLPExportSpec `json:"otlp,omitempty"`
+}
+
+// OTLPProtocol is the transport of the OTLP profiles exporter
+// +kubebuilder:validation:Enum:=grpc;http
+type OTLPProtocol string
+
+const (
+	// OTLPProtocolGRPC sends profiles to the ProfilesService of the collector.
+	OTLPProtocolGRPC OTLPProtocol = "grpc"
+	// OTLPProtocolHTTP posts binary protobuf profiles to the collector.
+	OTLPProtocolHTTP OTLPProtocol = "http"
+)
+
+// OTLPExportSpec overrides the OTLP profiles exporter of the operator
+type OTLPExportSpec struct {
+	// Disabled skips the OTLP export of the profiles of this PodFlame.
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Endpoint is the URL of the collector, e.g. http://otel-collector.monitoring:4317,
+	// defaults to the endpoint of the operator. It must be the endpoint of the operator or one
+	// of the endpoints it allows with --otlp-allowed-endpoints.
+	// +kubebuilder:validation:Pattern:="^https?://"
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Protocol is the transport to the collector, defaults to the protocol of the operator.
+	// +optional
+	Protocol OTLPProtocol `json:"protocol,omitempty"`
+}
+
+// ReplicaPolicy describes which replicas of a workload are profiled
+// +kubebuilder:validation:Enum:=Random;Count;All
+type ReplicaPolicy string
+
+const (
+	// ReplicaPolicyRandom profiles one random replica.
+	ReplicaPolicyRandom ReplicaPolicy = "Random"
+	// ReplicaPolicyCount profiles a number of random replicas.
+	ReplicaPolicyCount ReplicaPolicy = "Count"
+	// ReplicaPolicyAll profiles every replica.
+	ReplicaPolicyAll ReplicaPolicy = "All"
+)
+
+// TargetReference identifies a workload by its owner reference
+type TargetReference struct {
+	// APIVersion of the workload, defaults to apps/v1 or batch/v1 according to the kind.
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// +kubebuilder:validation:Enum:=Deployment;StatefulSet;DaemonSet;ReplicaSet;Job
+	Kind string `json:"kind"`
+
+	// +kubebuilder:validation:MinLength:=1
+	Name string `json:"name"`
+
+	// Policy selects which of the workload replicas are profiled.
+	// +kubebuilder:default:=Random
+	// +optional
+	Policy ReplicaPolicy `json:"policy,omitempty"`
+
+	// Replicas is the number of replicas to profile when policy is Count.
+	// +kubebuilder:validation:Minimum:=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+}
+
+// PodFlamePhase is a label for the condition of a PodFlame at the current time
+// +kubebuilder:validation:Enum:=Pending;Scheduling;Running;Succeeded;Failed;Cancelled
+type PodFlamePhase string
+
+const (
+	// PodFlamePending means the targets of the PodFlame are not resolved yet.
+	PodFlamePending PodFlamePhase = "Pending"
+	// PodFlameScheduling means the agent pods are created but none of them is running yet.
+	PodFlameScheduling PodFlamePhase = "Scheduling"
+	// PodFlameRunning means at least one agent pod is profiling its target.
+	PodFlameRunning PodFlamePhase = "Running"
+	// PodFlameSucceeded means a flame graph was produced for at least one target.
+	PodFlameSucceeded PodFlamePhase = "Succeeded"
+	// PodFlameFailed means no flame graph could be produced.
+	PodFlameFailed PodFlamePhase = "Failed"
+	// PodFlameCancelled means profiling was stopped by cancel or the stop annotation
+	// before it finished, keeping the partial profiles of the stopped agents.
+	PodFlameCancelled PodFlamePhase = "Cancelled"
+)
+
 // PodFlameStatus defines the observed state of PodFlame
 type PodFlameStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// Phase is a simple, high-level summary of where the PodFlame is in its lifecycle.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Phase PodFlamePhase `json:"phase,omitempty"`
+
+	// Conditions represent the latest available observations of the PodFlame state.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// StartTime is the time the targets were resolved and the agent pods scheduled.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is the time profiling finished, successfully or not.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// ObservedGeneration is the most recent generation observed by the controller.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// AgentPod is the name of the agent pod in the operator namespace when a single target is profiled.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	AgentPod string `json:"agentPod,omitempty"`
+
+	// Results reference the profile in every requested format when a single target is profiled.
+	// +optional
+	// +listType=map
+	// +listMapKey=format
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Results []ResultReference `json:"results,omitempty"`
+
+	// Event is the profiled event.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Event string `json:"event,omitempty"`
+
+	// Units is the unit of the flame graph sample values, e.g. samples for cpu,
+	// bytes for alloc or nanoseconds for the time weighted offcpu flame graphs.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Units string `json:"units,omitempty"`
+
+	// AggregatedResults reference the profile merged from every target in every
+	// requested format, when aggregation is requested.
+	// +optional
+	// +listType=map
+	// +listMapKey=format
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	AggregatedResults []ResultReference `json:"aggregatedResults,omitempty"`
+
+	// Targets holds the result of profiling each target pod.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Targets []TargetStatus `json:"targets,omitempty"`
+
+	// Run is the index of the current run, counted from 0. Every rerun increments it.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Run int64 `json:"run,omitempty"`
 
+	// RerunNonce is the value of the rerun annotation that started the current run.
 	// +optional
 	// +operator-sdk:csv:customresourcedefinitions:type=status
-	FlameGraph string `json:"flameGraph,omitempty"`
+	RerunNonce string `json:"rerunNonce,omitempty"`
 
+	// CancelledRun is the run stopped by cancel. Cancel can not be unset, so the
+	// runs started after it by the rerun annotation ignore it.
 	// +optional
 	// +operator-sdk:csv:customresourcedefinitions:type=status
-	Failed string `json:"failed,omitempty" protobuf:"varint,6,opt,name=failed"`
+	CancelledRun *int64 `json:"cancelledRun,omitempty"`
+
+	// History holds the outcome of the previous runs, oldest first. The results of
+	// the runs dropped from the history are deleted.
+	// +optional
+	// +kubebuilder:validation:MaxItems:=10
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	History []RunStatus `json:"history,omitempty"`
+}
+
+// RunStatus defines the outcome of a previous run of a PodFlame
+type RunStatus struct {
+	// Run is the index of the run, counted from 0.
+	Run int64 `json:"run"`
+
+	// RerunNonce is the value of the rerun annotation that started the run.
+	// +optional
+	RerunNonce string `json:"rerunNonce,omitempty"`
+
+	// Phase the run ended in.
+	Phase PodFlamePhase `json:"phase"`
+
+	// Reason is a machine readable explanation of the outcome of the run.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable explanation of the outcome of the run.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// StartTime is the time the targets of the run were resolved.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is the time the run finished.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Results reference the profile of the run when a single target was profiled.
+	// +optional
+	// +listType=map
+	// +listMapKey=format
+	Results []ResultReference `json:"results,omitempty"`
+
+	// AggregatedResults reference the profile merged from every target of the run.
+	// +optional
+	// +listType=map
+	// +listMapKey=format
+	AggregatedResults []ResultReference `json:"aggregatedResults,omitempty"`
+
+	// Targets hold the results of every target pod of the run.
+	// +optional
+	Targets []RunTargetStatus `json:"targets,omitempty"`
+}
+
+// RunTargetStatus defines the outcome of profiling a target pod in a previous run
+type RunTargetStatus struct {
+	// PodName is the name of the profiled pod.
+	PodName string `json:"podName"`
+
+	// Phase profiling the target ended in.
+	Phase PodFlamePhase `json:"phase"`
+
+	// Results reference the profile of the target, of its latest window for a
+	// continuous PodFlame.
+	// +optional
+	// +listType=map
+	// +listMapKey=format
+	Results []ResultReference `json:"results,omitempty"`
+
+	// RollingResults reference the profile merged from the windows of the target.
+	// +optional
+	// +listType=map
+	// +listMapKey=format
+	RollingResults []ResultReference `json:"rollingResults,omitempty"`
+}
+
+// TargetStatus defines the observed state of profiling a single target pod
+type TargetStatus struct {
+	// PodName is the name of the profiled pod.
+	PodName string `json:"podName"`
+
+	// +optional
+	ContainerName string `json:"containerName,omitempty"`
+
+	// +optional
+	NodeName string `json:"nodeName,omitempty"`
+
+	// Language is the programming language of the target application detected by the agent.
+	// +optional
+	Language string `json:"language,omitempty"`
+
+	// PID is the host process id of the profiled process.
+	// +optional
+	PID int32 `json:"pid,omitempty"`
+
+	// Profiler is the profiler the agent ran for the detected language.
+	// +optional
+	Profiler string `json:"profiler,omitempty"`
+
+	// AgentAPIVersion is the version of the agent contract the agent
+	// acknowledged when it started, or answered with.
+	// +optional
+	AgentAPIVersion string `json:"agentAPIVersion,omitempty"`
+
+	// Samples is the number of samples the agent recorded.
+	// +optional
+	Samples int64 `json:"samples,omitempty"`
+
+	// StartTime is the time the agent started profiling the target.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// EndTime is the time the agent stopped profiling the target.
+	// +optional
+	EndTime *metav1.Time `json:"endTime,omitempty"`
+
+	// Warnings are problems reported by the agent that did not prevent profiling.
+	// +optional
+	Warnings []string `json:"warnings,omitempty"`
+
+	// AgentPod is the name of the agent pod profiling this target in the operator namespace.
+	// +optional
+	AgentPod string `json:"agentPod,omitempty"`
+
+	// Phase of profiling this target.
+	// +optional
+	Phase PodFlamePhase `json:"phase,omitempty"`
+
+	// Results reference the profile of this target in every requested format.
+	// +optional
+	// +listType=map
+	// +listMapKey=format
+	Results []ResultReference `json:"results,omitempty"`
+
+	// Reason is a machine readable explanation of why profiling the target failed.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable explanation of why profiling the target failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Window is the index of the current profiling window of a continuous PodFlame.
+	// +optional
+	Window int64 `json:"window,omitempty"`
+
+	// NextWindowTime is the time the next profiling window of a continuous PodFlame starts.
+	// +optional
+	NextWindowTime *metav1.Time `json:"nextWindowTime,omitempty"`
+
+	// Windows are the last profiling windows of a continuous PodFlame, oldest first.
+	// +optional
+	Windows []WindowStatus `json:"windows,omitempty"`
+
+	// RollingResults reference the profile merged from the windows kept in history,
+	// when rolling aggregation is requested.
+	// +optional
+	// +listType=map
+	// +listMapKey=format
+	RollingResults []ResultReference `json:"rollingResults,omitempty"`
+}
+
+// WindowStatus defines the observed state of a profiling window of a continuous PodFlame
+type WindowStatus struct {
+	// Index of the window, counted from 0.
+	Index int64 `json:"index"`
+
+	// Phase of profiling this window, Succeeded, Failed or Cancelled when it was
+	// stopped early.
+	Phase PodFlamePhase `json:"phase"`
+
+	// StartTime is the time the agent started profiling the window.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// EndTime is the time the agent stopped profiling the window.
+	// +optional
+	EndTime *metav1.Time `json:"endTime,omitempty"`
+
+	// Samples is the number of samples the agent recorded.
+	// +optional
+	Samples int64 `json:"samples,omitempty"`
+
+	// Results reference the profile of this window in every requested format.
+	// +optional
+	// +listType=map
+	// +listMapKey=format
+	Results []ResultReference `json:"results,omitempty"`
+
+	// Reason is a machine readable explanation of why profiling the window failed.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable explanation of why profiling the window failed.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// OutputFormat is a format of the profiling results
+// +kubebuilder:validation:Enum=html;svg;collapsed;pprof;speedscope;chrometrace
+type OutputFormat string
+
+const (
+	// FormatHTML is the interactive flame graph page produced by the agent
+	FormatHTML OutputFormat = "html"
+	// FormatSVG is a flame graph image
+	FormatSVG OutputFormat = "svg"
+	// FormatCollapsed is the collapsed stacks format of flamegraph.pl
+	FormatCollapsed OutputFormat = "collapsed"
+	// FormatPprof is the protobuf profile format read by go tool pprof
+	FormatPprof OutputFormat = "pprof"
+	// FormatSpeedscope is the speedscope JSON format, keeping the time order of the samples
+	FormatSpeedscope OutputFormat = "speedscope"
+	// FormatChromeTrace is the Chrome Trace Event format, keeping the time order of the samples
+	FormatChromeTrace OutputFormat = "chrometrace"
+)
+
+// ResultReference points to a gzipped profiling result kept outside the PodFlame object
+type ResultReference struct {
+	// Format of the result.
+	Format OutputFormat `json:"format"`
+
+	// ContentType is the media type of the result once decompressed.
+	// +optional
+	ContentType string `json:"contentType,omitempty"`
+
+	// Backend is the result storage backend holding the result, configmap, secret or s3.
+	Backend string `json:"backend"`
+
+	// Name is the name of the object holding the result in the PodFlame namespace,
+	// or the object key in the bucket for the s3 backend.
+	// When the result is split into several chunks, chunk i > 0 is held by <name>-<i>.
+	Name string `json:"name"`
+
+	// Bucket is the bucket holding the result for the s3 backend.
+	// +optional
+	Bucket string `json:"bucket,omitempty"`
+
+	// URL is a presigned URL downloading the result, when the backend supports it.
+	// It stops working once the presign expiry of the operator elapsed.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// Chunks is the number of objects the result is split into.
+	// +optional
+	Chunks int32 `json:"chunks,omitempty"`
+
+	// Size is the size of the gzipped result in bytes.
+	Size int64 `json:"size"`
+
+	// SHA256 is the hex encoded SHA-256 checksum of the gzipped result.
+	SHA256 string `json:"sha256"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:storageversion
 // +kubebuilder:resource:shortName="pf"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // PodFlame is the Schema for the podflames API
 type PodFlame struct {
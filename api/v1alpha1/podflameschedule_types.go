@@ -0,0 +1,142 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConcurrencyPolicy describes how a scheduled run is handled while a previous run is still profiling
+// +kubebuilder:validation:Enum:=Allow;Forbid;Replace
+type ConcurrencyPolicy string
+
+const (
+	// AllowConcurrent starts the scheduled run alongside the running ones.
+	AllowConcurrent ConcurrencyPolicy = "Allow"
+	// ForbidConcurrent skips the scheduled run while a previous run is profiling.
+	ForbidConcurrent ConcurrencyPolicy = "Forbid"
+	// ReplaceConcurrent deletes the running runs before starting the scheduled one.
+	ReplaceConcurrent ConcurrencyPolicy = "Replace"
+)
+
+// PodFlameScheduleSpec defines the desired state of PodFlameSchedule
+type PodFlameScheduleSpec struct {
+	// Schedule is the cron expression of the runs, e.g. "0 2 * * *" for every night at 02:00.
+	// +kubebuilder:validation:MinLength:=1
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Schedule string `json:"schedule"`
+
+	// TimeZone is the time zone name of the schedule, e.g. Europe/Paris. default: the time zone of the operator.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	TimeZone *string `json:"timeZone,omitempty"`
+
+	// StartingDeadlineSeconds is how late a run may start after its scheduled time,
+	// missed runs are skipped. default: no deadline.
+	// +kubebuilder:validation:Minimum:=0
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+
+	// ConcurrencyPolicy handles a scheduled run while a previous run is still profiling.
+	// +kubebuilder:default:=Forbid
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	ConcurrencyPolicy ConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+
+	// Suspend stops scheduling new runs, runs already started are not affected.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	Suspend *bool `json:"suspend,omitempty"`
+
+	// PodFlameTemplate is the PodFlame created by every run.
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	PodFlameTemplate PodFlameTemplateSpec `json:"podFlameTemplate"`
+
+	// SuccessfulRunsHistoryLimit is the number of succeeded PodFlames kept.
+	// +kubebuilder:validation:Minimum:=0
+	// +kubebuilder:default:=3
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	SuccessfulRunsHistoryLimit *int32 `json:"successfulRunsHistoryLimit,omitempty"`
+
+	// FailedRunsHistoryLimit is the number of failed and cancelled PodFlames kept.
+	// +kubebuilder:validation:Minimum:=0
+	// +kubebuilder:default:=1
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec
+	FailedRunsHistoryLimit *int32 `json:"failedRunsHistoryLimit,omitempty"`
+}
+
+// PodFlameTemplateSpec describes the PodFlame created by a scheduled run
+type PodFlameTemplateSpec struct {
+	// Labels and annotations of the created PodFlames.
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec of the created PodFlames.
+	Spec PodFlameSpec `json:"spec"`
+}
+
+// PodFlameScheduleStatus defines the observed state of PodFlameSchedule
+type PodFlameScheduleStatus struct {
+	// Active are the PodFlames of the runs still profiling.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Active []corev1.ObjectReference `json:"active,omitempty"`
+
+	// LastScheduleTime is the scheduled time of the last started run.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// LastSuccessfulTime is the completion time of the last succeeded run.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+// +kubebuilder:resource:shortName="pfs"
+// +kubebuilder:printcolumn:name="Schedule",type="string",JSONPath=".spec.schedule"
+// +kubebuilder:printcolumn:name="Suspend",type="boolean",JSONPath=".spec.suspend"
+// +kubebuilder:printcolumn:name="Last Schedule",type="date",JSONPath=".status.lastScheduleTime"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// PodFlameSchedule is the Schema for the podflameschedules API
+type PodFlameSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PodFlameScheduleSpec   `json:"spec,omitempty"`
+	Status PodFlameScheduleStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PodFlameScheduleList contains a list of PodFlameSchedule
+type PodFlameScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PodFlameSchedule `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PodFlameSchedule{}, &PodFlameScheduleList{})
+}
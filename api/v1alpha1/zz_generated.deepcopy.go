@@ -22,16 +22,103 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AggregateSpec) DeepCopyInto(out *AggregateSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AggregateSpec.
+func (in *AggregateSpec) DeepCopy() *AggregateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AggregateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContinuousSpec) DeepCopyInto(out *ContinuousSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContinuousSpec.
+func (in *ContinuousSpec) DeepCopy() *ContinuousSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ContinuousSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EventOptions) DeepCopyInto(out *EventOptions) {
+	*out = *in
+	if in.SamplePeriod != nil {
+		in, out := &in.SamplePeriod, &out.SamplePeriod
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EventOptions.
+func (in *EventOptions) DeepCopy() *EventOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(EventOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExportSpec) DeepCopyInto(out *ExportSpec) {
+	*out = *in
+	if in.OTLP != nil {
+		in, out := &in.OTLP, &out.OTLP
+		*out = new(OTLPExportSpec)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExportSpec.
+func (in *ExportSpec) DeepCopy() *ExportSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ExportSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OTLPExportSpec) DeepCopyInto(out *OTLPExportSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OTLPExportSpec.
+func (in *OTLPExportSpec) DeepCopy() *OTLPExportSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(OTLPExportSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodFlame) DeepCopyInto(out *PodFlame) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodFlame.
@@ -84,9 +171,177 @@ func (in *PodFlameList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodFlameSchedule) DeepCopyInto(out *PodFlameSchedule) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodFlameSchedule.
+func (in *PodFlameSchedule) DeepCopy() *PodFlameSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(PodFlameSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PodFlameSchedule) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodFlameScheduleList) DeepCopyInto(out *PodFlameScheduleList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PodFlameSchedule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodFlameScheduleList.
+func (in *PodFlameScheduleList) DeepCopy() *PodFlameScheduleList {
+	if in == nil {
+		return nil
+	}
+	out := new(PodFlameScheduleList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PodFlameScheduleList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodFlameScheduleSpec) DeepCopyInto(out *PodFlameScheduleSpec) {
+	*out = *in
+	if in.TimeZone != nil {
+		in, out := &in.TimeZone, &out.TimeZone
+		*out = new(string)
+		**out = **in
+	}
+	if in.StartingDeadlineSeconds != nil {
+		in, out := &in.StartingDeadlineSeconds, &out.StartingDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Suspend != nil {
+		in, out := &in.Suspend, &out.Suspend
+		*out = new(bool)
+		**out = **in
+	}
+	in.PodFlameTemplate.DeepCopyInto(&out.PodFlameTemplate)
+	if in.SuccessfulRunsHistoryLimit != nil {
+		in, out := &in.SuccessfulRunsHistoryLimit, &out.SuccessfulRunsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailedRunsHistoryLimit != nil {
+		in, out := &in.FailedRunsHistoryLimit, &out.FailedRunsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodFlameScheduleSpec.
+func (in *PodFlameScheduleSpec) DeepCopy() *PodFlameScheduleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PodFlameScheduleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodFlameScheduleStatus) DeepCopyInto(out *PodFlameScheduleStatus) {
+	*out = *in
+	if in.Active != nil {
+		in, out := &in.Active, &out.Active
+		*out = make([]v1.ObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastScheduleTime != nil {
+		in, out := &in.LastScheduleTime, &out.LastScheduleTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSuccessfulTime != nil {
+		in, out := &in.LastSuccessfulTime, &out.LastSuccessfulTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodFlameScheduleStatus.
+func (in *PodFlameScheduleStatus) DeepCopy() *PodFlameScheduleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PodFlameScheduleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodFlameSpec) DeepCopyInto(out *PodFlameSpec) {
 	*out = *in
+	if in.TargetSelector != nil {
+		in, out := &in.TargetSelector, &out.TargetSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TargetRef != nil {
+		in, out := &in.TargetRef, &out.TargetRef
+		*out = new(TargetReference)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.EventOptions != nil {
+		in, out := &in.EventOptions, &out.EventOptions
+		*out = new(EventOptions)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Aggregate != nil {
+		in, out := &in.Aggregate, &out.Aggregate
+		*out = new(AggregateSpec)
+		**out = **in
+	}
+	if in.Formats != nil {
+		in, out := &in.Formats, &out.Formats
+		*out = make([]OutputFormat, len(*in))
+		copy(*out, *in)
+	}
+	if in.Export != nil {
+		in, out := &in.Export, &out.Export
+		*out = new(ExportSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Continuous != nil {
+		in, out := &in.Continuous, &out.Continuous
+		*out = new(ContinuousSpec)
+		**out = **in
+	}
+	if in.TTLSecondsAfterFinished != nil {
+		in, out := &in.TTLSecondsAfterFinished, &out.TTLSecondsAfterFinished
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodFlameSpec.
@@ -102,6 +357,50 @@ func (in *PodFlameSpec) DeepCopy() *PodFlameSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodFlameStatus) DeepCopyInto(out *PodFlameStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Results != nil {
+		in, out := &in.Results, &out.Results
+		*out = make([]ResultReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.AggregatedResults != nil {
+		in, out := &in.AggregatedResults, &out.AggregatedResults
+		*out = make([]ResultReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Targets != nil {
+		in, out := &in.Targets, &out.Targets
+		*out = make([]TargetStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CancelledRun != nil {
+		in, out := &in.CancelledRun, &out.CancelledRun
+		*out = new(int64)
+		**out = **in
+	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]RunStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodFlameStatus.
@@ -113,3 +412,197 @@ func (in *PodFlameStatus) DeepCopy() *PodFlameStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodFlameTemplateSpec) DeepCopyInto(out *PodFlameTemplateSpec) {
+	*out = *in
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodFlameTemplateSpec.
+func (in *PodFlameTemplateSpec) DeepCopy() *PodFlameTemplateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PodFlameTemplateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResultReference) DeepCopyInto(out *ResultReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResultReference.
+func (in *ResultReference) DeepCopy() *ResultReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ResultReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RunStatus) DeepCopyInto(out *RunStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Results != nil {
+		in, out := &in.Results, &out.Results
+		*out = make([]ResultReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.AggregatedResults != nil {
+		in, out := &in.AggregatedResults, &out.AggregatedResults
+		*out = make([]ResultReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Targets != nil {
+		in, out := &in.Targets, &out.Targets
+		*out = make([]RunTargetStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RunStatus.
+func (in *RunStatus) DeepCopy() *RunStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RunStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RunTargetStatus) DeepCopyInto(out *RunTargetStatus) {
+	*out = *in
+	if in.Results != nil {
+		in, out := &in.Results, &out.Results
+		*out = make([]ResultReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.RollingResults != nil {
+		in, out := &in.RollingResults, &out.RollingResults
+		*out = make([]ResultReference, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RunTargetStatus.
+func (in *RunTargetStatus) DeepCopy() *RunTargetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RunTargetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TargetReference) DeepCopyInto(out *TargetReference) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetReference.
+func (in *TargetReference) DeepCopy() *TargetReference {
+	if in == nil {
+		return nil
+	}
+	out := new(TargetReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TargetStatus) DeepCopyInto(out *TargetStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.EndTime != nil {
+		in, out := &in.EndTime, &out.EndTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Warnings != nil {
+		in, out := &in.Warnings, &out.Warnings
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Results != nil {
+		in, out := &in.Results, &out.Results
+		*out = make([]ResultReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.NextWindowTime != nil {
+		in, out := &in.NextWindowTime, &out.NextWindowTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Windows != nil {
+		in, out := &in.Windows, &out.Windows
+		*out = make([]WindowStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RollingResults != nil {
+		in, out := &in.RollingResults, &out.RollingResults
+		*out = make([]ResultReference, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetStatus.
+func (in *TargetStatus) DeepCopy() *TargetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TargetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WindowStatus) DeepCopyInto(out *WindowStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.EndTime != nil {
+		in, out := &in.EndTime, &out.EndTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Results != nil {
+		in, out := &in.Results, &out.Results
+		*out = make([]ResultReference, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WindowStatus.
+func (in *WindowStatus) DeepCopy() *WindowStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(WindowStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,524 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// ConversionDataAnnotation holds the spelling of the spec fields that a version
+// of PodFlame normalizes, so that converting a PodFlame back to the version it
+// was written in restores them.
+const ConversionDataAnnotation = "profilepod.io/conversion-data"
+
+// conversionData is the value of the conversion data annotation. On a v1beta1
+// PodFlame it holds the v1alpha1 spelling of the durations and sizes, on a
+// v1alpha1 PodFlame the v1beta1 spelling of the sizes v1alpha1 rounds.
+type conversionData struct {
+	Duration      string `json:"duration,omitempty"`
+	Interval      string `json:"interval,omitempty"`
+	AllocInterval string `json:"allocInterval,omitempty"`
+	WallInterval  string `json:"wallInterval,omitempty"`
+	LockThreshold string `json:"lockThreshold,omitempty"`
+}
+
+// ConvertTo converts this PodFlame to the v1alpha1 hub version.
+func (src *PodFlame) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1alpha1.PodFlame)
+	alpha := readConversionData(&src.ObjectMeta)
+	var beta conversionData
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	spec := &src.Spec
+	dst.Spec = v1alpha1.PodFlameSpec{
+		TargetPod:               spec.Target.Pod,
+		TargetSelector:          spec.Target.Selector.DeepCopy(),
+		ContainerName:           spec.Target.Container,
+		Event:                   string(spec.Event),
+		Duration:                alphaDuration(spec.Duration.Duration, alpha.Duration),
+		Formats:                 convertSlice(spec.Formats, func(format OutputFormat) v1alpha1.OutputFormat { return v1alpha1.OutputFormat(format) }),
+		TTLSecondsAfterFinished: copyPtr(spec.TTLSecondsAfterFinished),
+		Cancel:                  spec.Cancel,
+	}
+	if workload := spec.Target.Workload; workload != nil {
+		dst.Spec.TargetRef = &v1alpha1.TargetReference{
+			APIVersion: workload.APIVersion,
+			Kind:       workload.Kind,
+			Name:       workload.Name,
+			Policy:     v1alpha1.ReplicaPolicy(workload.Policy),
+			Replicas:   copyPtr(workload.Replicas),
+		}
+	}
+	if options := spec.EventOptions; options != nil {
+		dst.Spec.EventOptions = &v1alpha1.EventOptions{SamplePeriod: copyPtr(options.SamplePeriod)}
+		if options.AllocInterval != nil {
+			bytes := options.AllocInterval.Value()
+			dst.Spec.EventOptions.AllocInterval = alphaSize(bytes, alpha.AllocInterval)
+			if options.AllocInterval.Cmp(*resource.NewQuantity(bytes, resource.BinarySI)) != 0 {
+				// v1alpha1 rounds sizes up to a whole number of bytes
+				beta.AllocInterval = options.AllocInterval.String()
+			}
+		}
+		if options.WallInterval != nil {
+			dst.Spec.EventOptions.WallInterval = alphaDuration(options.WallInterval.Duration, alpha.WallInterval)
+		}
+		if options.LockThreshold != nil {
+			dst.Spec.EventOptions.LockThreshold = alphaDuration(options.LockThreshold.Duration, alpha.LockThreshold)
+		}
+	}
+	if aggregate := spec.Aggregate; aggregate != nil {
+		dst.Spec.Aggregate = &v1alpha1.AggregateSpec{
+			PodRootFrame:       aggregate.PodRootFrame,
+			ContainerRootFrame: aggregate.ContainerRootFrame,
+		}
+	}
+	if export := spec.Export; export != nil {
+		dst.Spec.Export = &v1alpha1.ExportSpec{}
+		if otlp := export.OTLP; otlp != nil {
+			dst.Spec.Export.OTLP = &v1alpha1.OTLPExportSpec{
+				Disabled: otlp.Disabled,
+				Endpoint: otlp.Endpoint,
+				Protocol: v1alpha1.OTLPProtocol(otlp.Protocol),
+			}
+		}
+	}
+	if continuous := spec.Continuous; continuous != nil {
+		dst.Spec.Continuous = &v1alpha1.ContinuousSpec{
+			Interval:         alphaDuration(continuous.Interval.Duration, alpha.Interval),
+			History:          continuous.History,
+			RollingAggregate: continuous.RollingAggregate,
+		}
+	}
+
+	status := &src.Status
+	dst.Status = v1alpha1.PodFlameStatus{
+		Phase:              v1alpha1.PodFlamePhase(status.Phase),
+		Conditions:         convertSlice(status.Conditions, func(condition metav1.Condition) metav1.Condition { return condition }),
+		StartTime:          status.StartTime.DeepCopy(),
+		CompletionTime:     status.CompletionTime.DeepCopy(),
+		ObservedGeneration: status.ObservedGeneration,
+		AgentPod:           status.AgentPod,
+		Results:            convertSlice(status.Results, resultToAlpha),
+		Event:              string(status.Event),
+		Units:              status.Units,
+		AggregatedResults:  convertSlice(status.AggregatedResults, resultToAlpha),
+		Targets:            convertSlice(status.Targets, targetToAlpha),
+		Run:                status.Run,
+		RerunNonce:         status.RerunNonce,
+		CancelledRun:       copyPtr(status.CancelledRun),
+		History: convertSlice(status.History, func(run RunStatus) v1alpha1.RunStatus {
+			return v1alpha1.RunStatus{
+				Run:               run.Run,
+				RerunNonce:        run.RerunNonce,
+				Phase:             v1alpha1.PodFlamePhase(run.Phase),
+				Reason:            run.Reason,
+				Message:           run.Message,
+				StartTime:         run.StartTime.DeepCopy(),
+				CompletionTime:    run.CompletionTime.DeepCopy(),
+				Results:           convertSlice(run.Results, resultToAlpha),
+				AggregatedResults: convertSlice(run.AggregatedResults, resultToAlpha),
+				Targets: convertSlice(run.Targets, func(target RunTargetStatus) v1alpha1.RunTargetStatus {
+					return v1alpha1.RunTargetStatus{
+						PodName:        target.PodName,
+						Phase:          v1alpha1.PodFlamePhase(target.Phase),
+						Results:        convertSlice(target.Results, resultToAlpha),
+						RollingResults: convertSlice(target.RollingResults, resultToAlpha),
+					}
+				}),
+			}
+		}),
+	}
+	return writeConversionData(&dst.ObjectMeta, beta)
+}
+
+// ConvertFrom converts from the v1alpha1 hub version to this version.
+func (dst *PodFlame) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1alpha1.PodFlame)
+	beta := readConversionData(&src.ObjectMeta)
+	var alpha conversionData
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	spec := &src.Spec
+	duration, err := betaDuration(spec.Duration, &alpha.Duration)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", spec.Duration, err)
+	}
+	dst.Spec = PodFlameSpec{
+		Target: PodFlameTarget{
+			Pod:       spec.TargetPod,
+			Selector:  spec.TargetSelector.DeepCopy(),
+			Container: spec.ContainerName,
+		},
+		Event:                   Event(spec.Event),
+		Duration:                duration,
+		Formats:                 convertSlice(spec.Formats, func(format v1alpha1.OutputFormat) OutputFormat { return OutputFormat(format) }),
+		TTLSecondsAfterFinished: copyPtr(spec.TTLSecondsAfterFinished),
+		Cancel:                  spec.Cancel,
+	}
+	if ref := spec.TargetRef; ref != nil {
+		dst.Spec.Target.Workload = &WorkloadReference{
+			APIVersion: ref.APIVersion,
+			Kind:       ref.Kind,
+			Name:       ref.Name,
+			Policy:     ReplicaPolicy(ref.Policy),
+			Replicas:   copyPtr(ref.Replicas),
+		}
+	}
+	if options := spec.EventOptions; options != nil {
+		dst.Spec.EventOptions = &EventOptions{SamplePeriod: copyPtr(options.SamplePeriod)}
+		if options.AllocInterval != "" {
+			allocInterval, err := betaSize(options.AllocInterval, beta.AllocInterval, &alpha.AllocInterval)
+			if err != nil {
+				return fmt.Errorf("invalid allocInterval %q: %w", options.AllocInterval, err)
+			}
+			dst.Spec.EventOptions.AllocInterval = &allocInterval
+		}
+		if options.WallInterval != "" {
+			wallInterval, err := betaDuration(options.WallInterval, &alpha.WallInterval)
+			if err != nil {
+				return fmt.Errorf("invalid wallInterval %q: %w", options.WallInterval, err)
+			}
+			dst.Spec.EventOptions.WallInterval = &wallInterval
+		}
+		if options.LockThreshold != "" {
+			lockThreshold, err := betaDuration(options.LockThreshold, &alpha.LockThreshold)
+			if err != nil {
+				return fmt.Errorf("invalid lockThreshold %q: %w", options.LockThreshold, err)
+			}
+			dst.Spec.EventOptions.LockThreshold = &lockThreshold
+		}
+	}
+	if aggregate := spec.Aggregate; aggregate != nil {
+		dst.Spec.Aggregate = &AggregateSpec{
+			PodRootFrame:       aggregate.PodRootFrame,
+			ContainerRootFrame: aggregate.ContainerRootFrame,
+		}
+	}
+	if export := spec.Export; export != nil {
+		dst.Spec.Export = &ExportSpec{}
+		if otlp := export.OTLP; otlp != nil {
+			dst.Spec.Export.OTLP = &OTLPExportSpec{
+				Disabled: otlp.Disabled,
+				Endpoint: otlp.Endpoint,
+				Protocol: OTLPProtocol(otlp.Protocol),
+			}
+		}
+	}
+	if continuous := spec.Continuous; continuous != nil {
+		interval, err := betaDuration(continuous.Interval, &alpha.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid continuous interval %q: %w", continuous.Interval, err)
+		}
+		dst.Spec.Continuous = &ContinuousSpec{
+			Interval:         interval,
+			History:          continuous.History,
+			RollingAggregate: continuous.RollingAggregate,
+		}
+	}
+
+	status := &src.Status
+	dst.Status = PodFlameStatus{
+		Phase:              PodFlamePhase(status.Phase),
+		Conditions:         convertSlice(status.Conditions, func(condition metav1.Condition) metav1.Condition { return condition }),
+		StartTime:          status.StartTime.DeepCopy(),
+		CompletionTime:     status.CompletionTime.DeepCopy(),
+		ObservedGeneration: status.ObservedGeneration,
+		AgentPod:           status.AgentPod,
+		Results:            convertSlice(status.Results, resultFromAlpha),
+		Event:              Event(status.Event),
+		Units:              status.Units,
+		AggregatedResults:  convertSlice(status.AggregatedResults, resultFromAlpha),
+		Targets:            convertSlice(status.Targets, targetFromAlpha),
+		Run:                status.Run,
+		RerunNonce:         status.RerunNonce,
+		CancelledRun:       copyPtr(status.CancelledRun),
+		History: convertSlice(status.History, func(run v1alpha1.RunStatus) RunStatus {
+			return RunStatus{
+				Run:               run.Run,
+				RerunNonce:        run.RerunNonce,
+				Phase:             PodFlamePhase(run.Phase),
+				Reason:            run.Reason,
+				Message:           run.Message,
+				StartTime:         run.StartTime.DeepCopy(),
+				CompletionTime:    run.CompletionTime.DeepCopy(),
+				Results:           convertSlice(run.Results, resultFromAlpha),
+				AggregatedResults: convertSlice(run.AggregatedResults, resultFromAlpha),
+				Targets: convertSlice(run.Targets, func(target v1alpha1.RunTargetStatus) RunTargetStatus {
+					return RunTargetStatus{
+						PodName:        target.PodName,
+						Phase:          PodFlamePhase(target.Phase),
+						Results:        convertSlice(target.Results, resultFromAlpha),
+						RollingResults: convertSlice(target.RollingResults, resultFromAlpha),
+					}
+				}),
+			}
+		}),
+	}
+	return writeConversionData(&dst.ObjectMeta, alpha)
+}
+
+func targetToAlpha(target TargetStatus) v1alpha1.TargetStatus {
+	return v1alpha1.TargetStatus{
+		PodName:         target.PodName,
+		ContainerName:   target.ContainerName,
+		NodeName:        target.NodeName,
+		Language:        target.Language,
+		PID:             target.PID,
+		Profiler:        target.Profiler,
+		AgentAPIVersion: target.AgentAPIVersion,
+		Samples:         target.Samples,
+		StartTime:       target.StartTime.DeepCopy(),
+		EndTime:         target.EndTime.DeepCopy(),
+		Warnings:        convertSlice(target.Warnings, func(warning string) string { return warning }),
+		AgentPod:        target.AgentPod,
+		Phase:           v1alpha1.PodFlamePhase(target.Phase),
+		Results:         convertSlice(target.Results, resultToAlpha),
+		Reason:          target.Reason,
+		Message:         target.Message,
+		Window:          target.Window,
+		NextWindowTime:  target.NextWindowTime.DeepCopy(),
+		Windows: convertSlice(target.Windows, func(window WindowStatus) v1alpha1.WindowStatus {
+			return v1alpha1.WindowStatus{
+				Index:     window.Index,
+				Phase:     v1alpha1.PodFlamePhase(window.Phase),
+				StartTime: window.StartTime.DeepCopy(),
+				EndTime:   window.EndTime.DeepCopy(),
+				Samples:   window.Samples,
+				Results:   convertSlice(window.Results, resultToAlpha),
+				Reason:    window.Reason,
+				Message:   window.Message,
+			}
+		}),
+		RollingResults: convertSlice(target.RollingResults, resultToAlpha),
+	}
+}
+
+func targetFromAlpha(target v1alpha1.TargetStatus) TargetStatus {
+	return TargetStatus{
+		PodName:         target.PodName,
+		ContainerName:   target.ContainerName,
+		NodeName:        target.NodeName,
+		Language:        target.Language,
+		PID:             target.PID,
+		Profiler:        target.Profiler,
+		AgentAPIVersion: target.AgentAPIVersion,
+		Samples:         target.Samples,
+		StartTime:       target.StartTime.DeepCopy(),
+		EndTime:         target.EndTime.DeepCopy(),
+		Warnings:        convertSlice(target.Warnings, func(warning string) string { return warning }),
+		AgentPod:        target.AgentPod,
+		Phase:           PodFlamePhase(target.Phase),
+		Results:         convertSlice(target.Results, resultFromAlpha),
+		Reason:          target.Reason,
+		Message:         target.Message,
+		Window:          target.Window,
+		NextWindowTime:  target.NextWindowTime.DeepCopy(),
+		Windows: convertSlice(target.Windows, func(window v1alpha1.WindowStatus) WindowStatus {
+			return WindowStatus{
+				Index:     window.Index,
+				Phase:     PodFlamePhase(window.Phase),
+				StartTime: window.StartTime.DeepCopy(),
+				EndTime:   window.EndTime.DeepCopy(),
+				Samples:   window.Samples,
+				Results:   convertSlice(window.Results, resultFromAlpha),
+				Reason:    window.Reason,
+				Message:   window.Message,
+			}
+		}),
+		RollingResults: convertSlice(target.RollingResults, resultFromAlpha),
+	}
+}
+
+func resultToAlpha(ref ResultReference) v1alpha1.ResultReference {
+	return v1alpha1.ResultReference{
+		Format:      v1alpha1.OutputFormat(ref.Format),
+		ContentType: ref.ContentType,
+		Backend:     ref.Backend,
+		Name:        ref.Name,
+		Bucket:      ref.Bucket,
+		URL:         ref.URL,
+		Chunks:      ref.Chunks,
+		Size:        ref.Size,
+		SHA256:      ref.SHA256,
+	}
+}
+
+func resultFromAlpha(ref v1alpha1.ResultReference) ResultReference {
+	return ResultReference{
+		Format:      OutputFormat(ref.Format),
+		ContentType: ref.ContentType,
+		Backend:     ref.Backend,
+		Name:        ref.Name,
+		Bucket:      ref.Bucket,
+		URL:         ref.URL,
+		Chunks:      ref.Chunks,
+		Size:        ref.Size,
+		SHA256:      ref.SHA256,
+	}
+}
+
+// convertSlice converts every item of in, keeping a nil slice nil.
+func convertSlice[From, To any](in []From, convert func(From) To) []To {
+	if in == nil {
+		return nil
+	}
+	out := make([]To, len(in))
+	for i := range in {
+		out[i] = convert(in[i])
+	}
+	return out
+}
+
+func copyPtr[T any](in *T) *T {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	return &out
+}
+
+// readConversionData returns the conversion data annotation of meta. A
+// malformed annotation is ignored, the fields are then normalized.
+func readConversionData(meta *metav1.ObjectMeta) conversionData {
+	var data conversionData
+	if raw, ok := meta.Annotations[ConversionDataAnnotation]; ok {
+		if err := json.Unmarshal([]byte(raw), &data); err != nil {
+			return conversionData{}
+		}
+	}
+	return data
+}
+
+// writeConversionData replaces the conversion data annotation of meta with
+// data, or removes it when data is empty.
+func writeConversionData(meta *metav1.ObjectMeta, data conversionData) error {
+	delete(meta.Annotations, ConversionDataAnnotation)
+	if data == (conversionData{}) {
+		return nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[ConversionDataAnnotation] = string(raw)
+	return nil
+}
+
+// parseAlphaDuration parses a v1alpha1 duration, which may be upper case.
+func parseAlphaDuration(value string) (time.Duration, error) {
+	return time.ParseDuration(strings.ToLower(value))
+}
+
+// alphaDuration returns the v1alpha1 spelling of d, spelling when it is the
+// spelling of d.
+func alphaDuration(d time.Duration, spelling string) string {
+	if parsed, err := parseAlphaDuration(spelling); err == nil && parsed == d {
+		return spelling
+	}
+	// 2m rather than 2m0s, 1h rather than 1h0m0s
+	value := d.String()
+	if strings.HasSuffix(value, "m0s") {
+		value = strings.TrimSuffix(value, "0s")
+	}
+	if strings.HasSuffix(value, "h0m") {
+		value = strings.TrimSuffix(value, "0m")
+	}
+	return value
+}
+
+// betaDuration parses the v1alpha1 duration value, and records value in
+// spelling when its v1beta1 form does not convert back to it.
+func betaDuration(value string, spelling *string) (metav1.Duration, error) {
+	if value == "" {
+		return metav1.Duration{}, nil
+	}
+	d, err := parseAlphaDuration(value)
+	if err != nil {
+		return metav1.Duration{}, err
+	}
+	if alphaDuration(d, "") != value {
+		*spelling = value
+	}
+	return metav1.Duration{Duration: d}, nil
+}
+
+// sizeSuffixes are the binary suffixes of the v1alpha1 sizes, largest first.
+var sizeSuffixes = []struct {
+	suffix string
+	bytes  int64
+}{{"g", 1 << 30}, {"m", 1 << 20}, {"k", 1 << 10}}
+
+// parseAlphaSize parses a v1alpha1 size, a number of bytes with an optional
+// k, m or g binary suffix.
+func parseAlphaSize(value string) (int64, error) {
+	multiplier := int64(1)
+	for _, suffix := range sizeSuffixes {
+		if strings.HasSuffix(strings.ToLower(value), suffix.suffix) {
+			multiplier = suffix.bytes
+			value = value[:len(value)-1]
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * multiplier, nil
+}
+
+// alphaSize returns the v1alpha1 spelling of bytes, spelling when it is the
+// spelling of bytes.
+func alphaSize(bytes int64, spelling string) string {
+	if parsed, err := parseAlphaSize(spelling); err == nil && parsed == bytes {
+		return spelling
+	}
+	for _, suffix := range sizeSuffixes {
+		if bytes != 0 && bytes%suffix.bytes == 0 {
+			return strconv.FormatInt(bytes/suffix.bytes, 10) + suffix.suffix
+		}
+	}
+	return strconv.FormatInt(bytes, 10)
+}
+
+// betaSize parses the v1alpha1 size value, restoring the betaSpelling it was
+// rounded from, and records value in spelling when its v1beta1 form does not
+// convert back to it.
+func betaSize(value, betaSpelling string, spelling *string) (resource.Quantity, error) {
+	bytes, err := parseAlphaSize(value)
+	if err != nil {
+		return resource.Quantity{}, err
+	}
+	if alphaSize(bytes, "") != value {
+		*spelling = value
+	}
+	if quantity, err := resource.ParseQuantity(betaSpelling); err == nil && quantity.Value() == bytes {
+		return quantity, nil
+	}
+	return *resource.NewQuantity(bytes, resource.BinarySI), nil
+}
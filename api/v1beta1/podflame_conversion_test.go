@@ -0,0 +1,110 @@
+package v1beta1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConvertFromAlpha(t *testing.T) {
+	replicas := int32(2)
+	cancelledRun := int64(0)
+	now := metav1.NewTime(time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC))
+	alpha := &v1alpha1.PodFlame{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-app-flame", Namespace: "my-app-namespace"},
+		Spec: v1alpha1.PodFlameSpec{
+			TargetRef:     &v1alpha1.TargetReference{Kind: "Deployment", Name: "my-app", Policy: v1alpha1.ReplicaPolicyCount, Replicas: &replicas},
+			ContainerName: "app",
+			Event:         "alloc",
+			EventOptions:  &v1alpha1.EventOptions{AllocInterval: "512K"},
+			Duration:      "90S",
+			Formats:       []v1alpha1.OutputFormat{v1alpha1.FormatHTML, v1alpha1.FormatPprof},
+			Continuous:    &v1alpha1.ContinuousSpec{Interval: "5m", History: 12},
+		},
+		Status: v1alpha1.PodFlameStatus{
+			Phase:     v1alpha1.PodFlameRunning,
+			StartTime: &now,
+			Targets: []v1alpha1.TargetStatus{{
+				PodName:         "my-app-54674f9647-jvm98",
+				Phase:           v1alpha1.PodFlameRunning,
+				AgentAPIVersion: "agent.profilepod.io/v1",
+				Windows:         []v1alpha1.WindowStatus{{Index: 0, Phase: v1alpha1.PodFlameSucceeded, Results: []v1alpha1.ResultReference{{Format: v1alpha1.FormatHTML, Backend: "configmap", Name: "result"}}}},
+			}},
+
+			Run:          1,
+			RerunNonce:   "1700000000",
+			CancelledRun: &cancelledRun,
+			History: []v1alpha1.RunStatus{{
+				Run:     0,
+				Phase:   v1alpha1.PodFlameSucceeded,
+				Reason:  "ProfileSucceeded",
+				Targets: []v1alpha1.RunTargetStatus{{PodName: "my-app-54674f9647-jvm98", Phase: v1alpha1.PodFlameSucceeded, Results: []v1alpha1.ResultReference{{Format: v1alpha1.FormatHTML, Backend: "configmap", Name: "run-0"}}}},
+			}},
+		},
+	}
+
+	beta := &PodFlame{}
+	if err := beta.ConvertFrom(alpha.DeepCopy()); err != nil {
+		t.Fatalf("ConvertFrom failed: %s", err)
+	}
+	if beta.Spec.Target.Workload == nil || beta.Spec.Target.Workload.Name != "my-app" || beta.Spec.Target.Container != "app" {
+		t.Errorf("unexpected target %+v", beta.Spec.Target)
+	}
+	if beta.Spec.Duration.Duration != 90*time.Second {
+		t.Errorf("duration = %s, expected 1m30s", beta.Spec.Duration.Duration)
+	}
+	if quantity := beta.Spec.EventOptions.AllocInterval; quantity.Cmp(resource.MustParse("512Ki")) != 0 {
+		t.Errorf("allocInterval = %s, expected 512Ki", quantity)
+	}
+	if beta.Spec.Continuous.Interval.Duration != 5*time.Minute {
+		t.Errorf("interval = %s, expected 5m", beta.Spec.Continuous.Interval.Duration)
+	}
+	if data := beta.Annotations[ConversionDataAnnotation]; data != `{"duration":"90S","allocInterval":"512K"}` {
+		t.Errorf("conversion data = %s", data)
+	}
+
+	restored := &v1alpha1.PodFlame{}
+	if err := beta.ConvertTo(restored); err != nil {
+		t.Fatalf("ConvertTo failed: %s", err)
+	}
+	if !equality.Semantic.DeepEqual(alpha, restored) {
+		t.Errorf("v1alpha1 round trip changed the PodFlame:\n%+v\n%+v", alpha, restored)
+	}
+}
+
+func TestConvertToAlpha(t *testing.T) {
+	allocInterval := resource.MustParse("1500m")
+	wallInterval := metav1.Duration{Duration: 1500 * time.Microsecond}
+	beta := &PodFlame{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-app-flame", Namespace: "my-app-namespace"},
+		Spec: PodFlameSpec{
+			Target:       PodFlameTarget{Pod: "my-app-54674f9647-jvm98"},
+			Event:        EventWall,
+			EventOptions: &EventOptions{AllocInterval: &allocInterval, WallInterval: &wallInterval},
+			Duration:     metav1.Duration{Duration: time.Hour},
+		},
+	}
+
+	alpha := &v1alpha1.PodFlame{}
+	if err := beta.DeepCopy().ConvertTo(alpha); err != nil {
+		t.Fatalf("ConvertTo failed: %s", err)
+	}
+	if alpha.Spec.TargetPod != "my-app-54674f9647-jvm98" || alpha.Spec.Duration != "1h" {
+		t.Errorf("unexpected spec %+v", alpha.Spec)
+	}
+	if options := alpha.Spec.EventOptions; options.AllocInterval != "2" || options.WallInterval != "1.5ms" {
+		t.Errorf("unexpected event options %+v", options)
+	}
+
+	restored := &PodFlame{}
+	if err := restored.ConvertFrom(alpha); err != nil {
+		t.Fatalf("ConvertFrom failed: %s", err)
+	}
+	if !equality.Semantic.DeepEqual(beta, restored) {
+		t.Errorf("v1beta1 round trip changed the PodFlame:\n%+v\n%+v", beta, restored)
+	}
+}
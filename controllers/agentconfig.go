@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	agentv1 "github.com/profile-pod/profile-pod-operator/api/agent/v1"
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	agentConfigVolume = "agent-config"
+	// agentConfigDir is where the agent config is mounted in the agent pod
+	agentConfigDir = "/etc/profilepod"
+	// agentRuntimePath is where the host directory of the container runtime is mounted in the agent pod
+	agentRuntimePath = "/runtimepath"
+
+	ReasonAgentVersionMismatch = "AgentVersionMismatch"
+
+	// agentStartTimeout bounds the time a running agent takes to acknowledge the agent contract
+	agentStartTimeout = time.Minute
+	// agentStartPoll is how often the logs of a running agent are read until it acknowledged the agent contract
+	agentStartPoll = 5 * time.Second
+)
+
+// defineAgentConfig returns the ConfigMap holding the config of the agent pod
+// called name, profiling target for podflame in formats. The ConfigMap shares
+// the name of the agent pod.
+func defineAgentConfig(podflame *profilepodiov1alpha1.PodFlame, name, namespace string, target agentv1.Target, formats []string) (*corev1.ConfigMap, error) {
+	config := agentv1.Config{
+		APIVersion:   agentv1.APIVersion,
+		Target:       target,
+		Duration:     podflame.Spec.Duration,
+		Event:        podflame.Spec.Event,
+		EventOptions: eventOptions(&podflame.Spec),
+		Languages:    eventLanguages(podflame.Spec.Event),
+		Formats:      formats,
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labelsForPodfalme(podflame),
+		},
+		Data: map[string]string{agentv1.ConfigFileName: string(data)},
+	}, nil
+}
+
+// applyAgentConfig creates configMap, replacing the config left by a previous agent pod.
+func (reconciler *PodFlameReconciler) applyAgentConfig(ctx context.Context, configMap *corev1.ConfigMap) error {
+	configMaps := reconciler.Clientset.CoreV1().ConfigMaps(configMap.Namespace)
+	_, err := configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	}
+	return err
+}
+
+// checkAgentVersion reads the version of the agent contract acknowledged by
+// the running agent pod of target, and fails target when the agent
+// acknowledged another version, or none within agentStartTimeout of its start.
+// It reports whether target changed.
+func (reconciler *PodFlameReconciler) checkAgentVersion(ctx context.Context, target *profilepodiov1alpha1.TargetStatus, pod *corev1.Pod) (bool, error) {
+	if target.AgentAPIVersion != "" {
+		return false, nil
+	}
+	version, err := getAgentAPIVersion(ctx, reconciler.Clientset, pod.Namespace, pod.Name)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case version == agentv1.APIVersion:
+		target.AgentAPIVersion = version
+	case version != "":
+		target.AgentAPIVersion = version
+		failTarget(target, ReasonAgentVersionMismatch, fmt.Sprintf("The agent image %s implements version %q of the agent contract, expected %q",
+			GetAgentImage(), version, agentv1.APIVersion))
+	case time.Since(agentStartTime(pod)) >= agentStartTimeout:
+		failTarget(target, ReasonAgentVersionMismatch, fmt.Sprintf("The agent image %s did not acknowledge the agent contract %s within %s of its start",
+			GetAgentImage(), agentv1.APIVersion, agentStartTimeout))
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// agentStartTime returns when the agent container of pod started.
+func agentStartTime(pod *corev1.Pod) time.Time {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == ContainerName && status.State.Running != nil {
+			return status.State.Running.StartedAt.Time
+		}
+	}
+	if pod.Status.StartTime != nil {
+		return pod.Status.StartTime.Time
+	}
+	return pod.CreationTimestamp.Time
+}
+
+// agentStartResult requeues podflame while one of its running agents did not
+// acknowledge the agent contract.
+func agentStartResult(podflame *profilepodiov1alpha1.PodFlame) ctrl.Result {
+	for i := range podflame.Status.Targets {
+		target := &podflame.Status.Targets[i]
+		if target.Phase == profilepodiov1alpha1.PodFlameRunning && target.AgentAPIVersion == "" && !waitingForWindow(target) {
+			return ctrl.Result{RequeueAfter: agentStartPoll}
+		}
+	}
+	return ctrl.Result{}
+}
+
+// earliestResult returns the result of a and b requeued first.
+func earliestResult(a, b ctrl.Result) ctrl.Result {
+	if a.RequeueAfter == 0 || b.RequeueAfter != 0 && b.RequeueAfter < a.RequeueAfter {
+		return b
+	}
+	return a
+}
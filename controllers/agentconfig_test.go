@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	agentv1 "github.com/profile-pod/profile-pod-operator/api/agent/v1"
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// runningAgentPod returns an agent pod whose agent container started started ago.
+func runningAgentPod(name string, started time.Duration) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "profile-pod"},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  ContainerName,
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: metav1.NewTime(time.Now().Add(-started))}},
+			}},
+		},
+	}
+}
+
+func TestCheckAgentVersion(t *testing.T) {
+	acknowledged := func(version string) string {
+		return agentv1.StartedMarker + " apiVersion=" + version + "---\nprofiling\n"
+	}
+	tests := []struct {
+		name    string
+		logs    string
+		started time.Duration
+		// acknowledged is the version recorded before the check
+		acknowledged string
+		changed      bool
+		version      string
+		reason       string
+	}{
+		{name: "acknowledged", logs: acknowledged(agentv1.APIVersion), started: time.Second, changed: true, version: agentv1.APIVersion},
+		{name: "other version", logs: acknowledged("agent.profilepod.io/v2"), started: time.Second, changed: true, version: "agent.profilepod.io/v2", reason: ReasonAgentVersionMismatch},
+		{name: "not yet acknowledged", logs: "starting\n", started: time.Second},
+		{name: "never acknowledged", logs: "starting\n", started: 2 * agentStartTimeout, changed: true, reason: ReasonAgentVersionMismatch},
+		{name: "already acknowledged", logs: acknowledged("agent.profilepod.io/v2"), started: time.Second, acknowledged: agentv1.APIVersion, version: agentv1.APIVersion},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pod := runningAgentPod("my-app-flame-agent", test.started)
+			reconciler, _ := testContinuousReconciler(map[string]string{pod.Name: test.logs})
+			target := &profilepodiov1alpha1.TargetStatus{PodName: "my-app-0", Phase: profilepodiov1alpha1.PodFlameRunning, AgentAPIVersion: test.acknowledged}
+			changed, err := reconciler.checkAgentVersion(context.Background(), target, pod)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if changed != test.changed || target.AgentAPIVersion != test.version || target.Reason != test.reason {
+				t.Errorf("changed %t, version %q and reason %q, expected %t, %q and %q", changed, target.AgentAPIVersion, target.Reason, test.changed, test.version, test.reason)
+			}
+			if failed := target.Phase == profilepodiov1alpha1.PodFlameFailed; failed != (test.reason != "") {
+				t.Errorf("target is %s", target.Phase)
+			}
+		})
+	}
+}
+
+func TestReconcileAgentPodVersionMismatch(t *testing.T) {
+	podflame := testPodFlame("my-app-flame", "0123456789abcdef")
+	target := &profilepodiov1alpha1.TargetStatus{PodName: "my-app-0", AgentPod: "my-app-flame-agent", Phase: profilepodiov1alpha1.PodFlameScheduling}
+	pod := runningAgentPod(target.AgentPod, time.Second)
+	reconciler, _ := testContinuousReconciler(map[string]string{pod.Name: agentv1.StartedMarker + " apiVersion=agent.profilepod.io/v2---\n"})
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	reconciler.Client = clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(pod).Build()
+	recorder := reconciler.Recorder.(*record.FakeRecorder)
+
+	changed, err := reconciler.reconcileAgentPod(context.Background(), podflame, target)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if !changed || target.Phase != profilepodiov1alpha1.PodFlameFailed || target.Reason != ReasonAgentVersionMismatch {
+		t.Fatalf("target is %s with reason %s, expected it failed with %s", target.Phase, target.Reason, ReasonAgentVersionMismatch)
+	}
+	if !hasEvent(recorder, ReasonAgentVersionMismatch) {
+		t.Errorf("expected a %s event", ReasonAgentVersionMismatch)
+	}
+}
+
+func TestAgentStartResult(t *testing.T) {
+	podflame := testPodFlame("my-app-flame", "0123456789abcdef")
+	podflame.Status.Targets = []profilepodiov1alpha1.TargetStatus{
+		{PodName: "my-app-0", Phase: profilepodiov1alpha1.PodFlameRunning, AgentAPIVersion: agentv1.APIVersion},
+		{PodName: "my-app-1", Phase: profilepodiov1alpha1.PodFlameScheduling},
+	}
+	if result := agentStartResult(podflame); result.RequeueAfter != 0 {
+		t.Errorf("requeued after %s while every running agent acknowledged the contract", result.RequeueAfter)
+	}
+	podflame.Status.Targets[1].Phase = profilepodiov1alpha1.PodFlameRunning
+	if result := agentStartResult(podflame); result.RequeueAfter != agentStartPoll {
+		t.Errorf("requeued after %s, expected %s", result.RequeueAfter, agentStartPoll)
+	}
+
+	window := ctrl.Result{RequeueAfter: time.Minute}
+	if result := earliestResult(window, ctrl.Result{RequeueAfter: agentStartPoll}); result.RequeueAfter != agentStartPoll {
+		t.Errorf("requeued after %s, expected %s", result.RequeueAfter, agentStartPoll)
+	}
+	if result := earliestResult(window, ctrl.Result{}); result.RequeueAfter != time.Minute {
+		t.Errorf("requeued after %s, expected %s", result.RequeueAfter, time.Minute)
+	}
+	if result := earliestResult(ctrl.Result{}, window); result.RequeueAfter != time.Minute {
+		t.Errorf("requeued after %s, expected %s", result.RequeueAfter, time.Minute)
+	}
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"github.com/profile-pod/profile-pod-operator/controllers/stacks"
+)
+
+// aggregateTargets merges the collapsed stacks of every succeeded target of
+// podflame and stores the merged profile in every requested format but the
+// timeline formats, as the samples of different pods share no clock to merge on.
+func (reconciler *PodFlameReconciler) aggregateTargets(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame) error {
+	merged := stacks.Stacks{}
+	profiled := 0
+	for i := range podflame.Status.Targets {
+		target := &podflame.Status.Targets[i]
+		ref := findResult(target.Results, profilepodiov1alpha1.FormatCollapsed)
+		if ref == nil {
+			continue
+		}
+		targetStacks, err := reconciler.loadStacks(ctx, podflame, ref)
+		if err != nil {
+			return fmt.Errorf("failed to read profile of %s: %w", target.PodName, err)
+		}
+		merged.Add(targetStacks, rootFrames(podflame.Spec.Aggregate, target)...)
+		profiled++
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+
+	title := fmt.Sprintf("%s %s profile of %s/%s (%d pods)", podflame.Spec.Event, podflame.Spec.Duration,
+		podflame.Namespace, podflame.Name, profiled)
+	var refs []profilepodiov1alpha1.ResultReference
+	for _, format := range requestedFormats(podflame) {
+		if isTimelineFormat(format) {
+			continue
+		}
+		data, err := renderStacks(podflame, merged, format, title)
+		if err != nil {
+			return err
+		}
+		ref, err := reconciler.ResultStore.Save(ctx, podflame, runName(podflame, ResultAggregated)+"-"+string(format), format, data)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, *ref)
+	}
+	podflame.Status.AggregatedResults = refs
+	return nil
+}
+
+// loadStacks loads and parses the collapsed stacks result referenced by ref.
+func (reconciler *PodFlameReconciler) loadStacks(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, ref *profilepodiov1alpha1.ResultReference) (stacks.Stacks, error) {
+	compressed, err := reconciler.ResultStore.Load(ctx, podflame, ref)
+	if err != nil {
+		return nil, err
+	}
+	data, err := stacks.Decompress(compressed)
+	if err != nil {
+		return nil, err
+	}
+	return stacks.Parse(bytes.NewReader(data))
+}
+
+// rootFrames returns the frames prefixed to the stacks of target in the
+// aggregated profile. A container root frame is left out when the agent did
+// not report the container.
+func rootFrames(aggregate *profilepodiov1alpha1.AggregateSpec, target *profilepodiov1alpha1.TargetStatus) []string {
+	var frames []string
+	if aggregate.PodRootFrame {
+		frames = append(frames, target.PodName)
+	}
+	if aggregate.ContainerRootFrame && target.ContainerName != "" {
+		frames = append(frames, target.ContainerName)
+	}
+	return frames
+}
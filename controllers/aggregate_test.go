@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"github.com/profile-pod/profile-pod-operator/controllers/stacks"
+)
+
+func TestRootFrames(t *testing.T) {
+	target := &profilepodiov1alpha1.TargetStatus{PodName: "my-app-0", ContainerName: "app"}
+	tests := []struct {
+		name      string
+		aggregate profilepodiov1alpha1.AggregateSpec
+		target    *profilepodiov1alpha1.TargetStatus
+		expected  []string
+	}{
+		{name: "none", target: target},
+		{name: "pod", aggregate: profilepodiov1alpha1.AggregateSpec{PodRootFrame: true}, target: target, expected: []string{"my-app-0"}},
+		{name: "container", aggregate: profilepodiov1alpha1.AggregateSpec{ContainerRootFrame: true}, target: target, expected: []string{"app"}},
+		{
+			name:      "pod and container",
+			aggregate: profilepodiov1alpha1.AggregateSpec{PodRootFrame: true, ContainerRootFrame: true},
+			target:    target,
+			expected:  []string{"my-app-0", "app"},
+		},
+		{
+			name:      "unknown container",
+			aggregate: profilepodiov1alpha1.AggregateSpec{PodRootFrame: true, ContainerRootFrame: true},
+			target:    &profilepodiov1alpha1.TargetStatus{PodName: "my-app-1"},
+			expected:  []string{"my-app-1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			frames := rootFrames(&test.aggregate, test.target)
+			if !reflect.DeepEqual(frames, test.expected) {
+				t.Fatalf("root frames = %v, expected %v", frames, test.expected)
+			}
+			merged := stacks.Stacks{}
+			merged.Add(stacks.Stacks{"main;foo": 1}, frames...)
+			stack := "main;foo"
+			for i := len(test.expected) - 1; i >= 0; i-- {
+				stack = test.expected[i] + ";" + stack
+			}
+			if merged[stack] != 1 {
+				t.Errorf("merged %v, expected the stack %s", merged, stack)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	agentv1 "github.com/profile-pod/profile-pod-operator/api/agent/v1"
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"github.com/profile-pod/profile-pod-operator/controllers/constants"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// cancelRequested reports whether podflame is asked to stop profiling, with
+// spec.cancel or the stop annotation. Spec.cancel only stops the run it was
+// first seen in, as it can not be unset before a rerun.
+func cancelRequested(podflame *profilepodiov1alpha1.PodFlame) bool {
+	cancelledRun := podflame.Status.CancelledRun
+	if podflame.Spec.Cancel && (cancelledRun == nil || *cancelledRun == podflame.Status.Run) {
+		return true
+	}
+	_, stop := podflame.Annotations[constants.AnnotationStop]
+	return stop
+}
+
+// recordCancel records the current run of podflame as the run stopped by
+// spec.cancel, unless an earlier run was.
+func recordCancel(podflame *profilepodiov1alpha1.PodFlame) {
+	if podflame.Spec.Cancel && podflame.Status.CancelledRun == nil {
+		run := podflame.Status.Run
+		podflame.Status.CancelledRun = &run
+	}
+}
+
+// cancelTarget stops profiling target and reports whether its status changed.
+// A running agent is asked to stop, it then reports a partial result which is
+// collected like the result of a finished agent. A target whose agent is not
+// profiling is cancelled right away, keeping the results of its past windows.
+func (reconciler *PodFlameReconciler) cancelTarget(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, target *profilepodiov1alpha1.TargetStatus) (bool, error) {
+	if targetFinished(target) || target.Reason == ReasonCancelled {
+		return false, nil
+	}
+	pod := &corev1.Pod{}
+	err := reconciler.Get(ctx, types.NamespacedName{Name: target.AgentPod, Namespace: reconciler.OperatorNamesapce}, pod)
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return false, err
+	case pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed:
+		// The agent finished on its own, its result is collected as usual
+		return false, nil
+	case pod.Status.Phase == corev1.PodRunning:
+		err := reconciler.stopAgent(ctx, pod.Name)
+		if err == nil {
+			target.Reason = ReasonCancelled
+			target.Message = "Stopping the profiler"
+			return true, nil
+		}
+		// An agent that can not be stopped is deleted with what it sampled
+		log.FromContext(ctx).Error(err, "Failed to stop the agent", "agentPod", pod.Name)
+		reconciler.Recorder.Event(podflame, "Warning", "StopFailed",
+			fmt.Sprintf("Failed to stop the profiler of %s, its samples are lost: %s", target.PodName, err))
+	}
+
+	target.Phase = profilepodiov1alpha1.PodFlameCancelled
+	target.Reason = ReasonCancelled
+	target.Message = "Cancelled before profiling started"
+	target.NextWindowTime = nil
+	if len(target.Windows) > 0 {
+		target.Message = fmt.Sprintf("Cancelled after %d windows", len(target.Windows))
+	} else {
+		target.Results = nil
+	}
+	return true, nil
+}
+
+// cancelWindow ends a continuous target once the window stopped by a cancel
+// was collected, instead of scheduling the next window.
+func cancelWindow(target *profilepodiov1alpha1.TargetStatus) {
+	target.Phase = profilepodiov1alpha1.PodFlameCancelled
+	target.Reason = ReasonCancelled
+	target.Message = fmt.Sprintf("Cancelled after %d windows", len(target.Windows))
+	target.NextWindowTime = nil
+}
+
+// stopAgent runs the stop command of the agent in its container.
+func (reconciler *PodFlameReconciler) stopAgent(ctx context.Context, podName string) error {
+	if reconciler.execStop != nil {
+		return reconciler.execStop(ctx, podName)
+	}
+	request := reconciler.Clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(reconciler.OperatorNamesapce).
+		Name(podName).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: ContainerName,
+			Command:   []string{agentCommand, agentv1.StopCommand},
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+	executor, err := remotecommand.NewSPDYExecutor(reconciler.RestConfig, "POST", request.URL())
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	if err := executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: io.Discard, Stderr: &stderr}); err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
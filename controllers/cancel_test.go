@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCancelTarget(t *testing.T) {
+	results := []profilepodiov1alpha1.ResultReference{{Name: "my-app-flame-my-app-0-collapsed"}}
+	next := metav1.Now()
+	tests := []struct {
+		name string
+		// agent is the phase of the agent pod, none when empty
+		agent   corev1.PodPhase
+		stopErr error
+		target  profilepodiov1alpha1.TargetStatus
+		// expected are the status of the target once cancelled
+		changed bool
+		stopped bool
+		phase   profilepodiov1alpha1.PodFlamePhase
+		message string
+		results int
+		event   string
+	}{
+		{
+			name: "running", agent: corev1.PodRunning,
+			target:  profilepodiov1alpha1.TargetStatus{Phase: profilepodiov1alpha1.PodFlameRunning},
+			changed: true, stopped: true, phase: profilepodiov1alpha1.PodFlameRunning, message: "Stopping the profiler",
+		},
+		{
+			name: "running agent not stopped", agent: corev1.PodRunning, stopErr: errors.New("command terminated with exit code 1"),
+			target:  profilepodiov1alpha1.TargetStatus{Phase: profilepodiov1alpha1.PodFlameRunning},
+			changed: true, stopped: true, phase: profilepodiov1alpha1.PodFlameCancelled, message: "Cancelled before profiling started",
+			event: "StopFailed",
+		},
+		{
+			name: "pending", target: profilepodiov1alpha1.TargetStatus{Phase: profilepodiov1alpha1.PodFlamePending},
+			changed: true, phase: profilepodiov1alpha1.PodFlameCancelled, message: "Cancelled before profiling started",
+		},
+		{
+			name: "scheduling", agent: corev1.PodPending,
+			target:  profilepodiov1alpha1.TargetStatus{Phase: profilepodiov1alpha1.PodFlameScheduling},
+			changed: true, phase: profilepodiov1alpha1.PodFlameCancelled, message: "Cancelled before profiling started",
+		},
+		{
+			name: "between windows",
+			target: profilepodiov1alpha1.TargetStatus{
+				Phase: profilepodiov1alpha1.PodFlameRunning, Window: 2, NextWindowTime: &next, Results: results,
+				Windows: []profilepodiov1alpha1.WindowStatus{{Index: 0}, {Index: 1, Results: results}},
+			},
+			changed: true, phase: profilepodiov1alpha1.PodFlameCancelled, message: "Cancelled after 2 windows", results: 1,
+		},
+		{
+			name: "agent finished", agent: corev1.PodSucceeded,
+			target: profilepodiov1alpha1.TargetStatus{Phase: profilepodiov1alpha1.PodFlameRunning},
+			phase:  profilepodiov1alpha1.PodFlameRunning,
+		},
+		{
+			name: "stopping", agent: corev1.PodRunning,
+			target: profilepodiov1alpha1.TargetStatus{Phase: profilepodiov1alpha1.PodFlameRunning, Reason: ReasonCancelled, Message: "Stopping the profiler"},
+			phase:  profilepodiov1alpha1.PodFlameRunning, message: "Stopping the profiler",
+		},
+		{
+			name:   "finished",
+			target: profilepodiov1alpha1.TargetStatus{Phase: profilepodiov1alpha1.PodFlameSucceeded, Results: results},
+			phase:  profilepodiov1alpha1.PodFlameSucceeded, results: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := test.target
+			target.PodName, target.AgentPod = "my-app-0", "my-app-flame-my-app-0"
+			var objects []client.Object
+			if test.agent != "" {
+				objects = append(objects, &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: target.AgentPod, Namespace: "profile-pod"},
+					Status:     corev1.PodStatus{Phase: test.agent},
+				})
+			}
+			recorder := record.NewFakeRecorder(10)
+			var stopped []string
+			reconciler := &PodFlameReconciler{
+				Client:            clientfake.NewClientBuilder().WithObjects(objects...).Build(),
+				OperatorNamesapce: "profile-pod",
+				Recorder:          recorder,
+				execStop: func(ctx context.Context, podName string) error {
+					stopped = append(stopped, podName)
+					return test.stopErr
+				},
+			}
+			podflame := testPodFlame("my-app-flame", "0123456789abcdef")
+			podflame.Spec.Cancel = true
+
+			changed, err := reconciler.cancelTarget(context.Background(), podflame, &target)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if changed != test.changed {
+				t.Errorf("changed = %t, expected %t", changed, test.changed)
+			}
+			if (len(stopped) == 1 && stopped[0] == target.AgentPod) != test.stopped || len(stopped) > 1 {
+				t.Errorf("stopped agents %v, expected the agent stopped: %t", stopped, test.stopped)
+			}
+			if target.Phase != test.phase || target.Message != test.message || len(target.Results) != test.results {
+				t.Errorf("target %s %q with %d results, expected %s %q with %d results",
+					target.Phase, target.Message, len(target.Results), test.phase, test.message, test.results)
+			}
+			if target.Phase == profilepodiov1alpha1.PodFlameCancelled && target.NextWindowTime != nil {
+				t.Errorf("cancelled target waits for a window at %v", target.NextWindowTime)
+			}
+			if test.event != "" && !hasEvent(recorder, test.event) {
+				t.Errorf("no %s event", test.event)
+			}
+		})
+	}
+}
+
+func TestCollectAgentResultPartial(t *testing.T) {
+	tests := []struct {
+		name    string
+		partial bool
+		phase   profilepodiov1alpha1.PodFlamePhase
+		reason  string
+		message string
+	}{
+		{
+			name: "stopped", partial: true, phase: profilepodiov1alpha1.PodFlameCancelled,
+			reason: ReasonCancelled, message: "Profiling cancelled, results stored for 1 of 1 target pods",
+		},
+		{
+			// The agent finished its profile before it was asked to stop
+			name: "finished before the stop", phase: profilepodiov1alpha1.PodFlameSucceeded,
+			reason: ReasonProfileSucceeded, message: "Profiler finished successfully",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			podflame := testContinuousPodFlame(0)
+			podflame.Spec.Continuous = nil
+			podflame.Spec.Cancel = true
+			startPending(podflame)
+			target := &profilepodiov1alpha1.TargetStatus{
+				PodName: "my-app-0", AgentPod: "my-app-flame-my-app-0", Phase: profilepodiov1alpha1.PodFlameRunning,
+				Reason: ReasonCancelled, Message: "Stopping the profiler",
+			}
+			result := succeededResult("main;foo 3\n")
+			result.Partial = test.partial
+			reconciler, clientset := testContinuousReconciler(map[string]string{target.AgentPod: agentLogs(t, result)})
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: target.AgentPod, Namespace: "profile-pod"},
+				Status:     corev1.PodStatus{Phase: corev1.PodSucceeded},
+			}
+
+			if _, err := reconciler.collectAgentResult(context.Background(), podflame, target, pod); err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if len(target.Results) != 1 || !storedResults(t, clientset)[target.Results[0].Name] {
+				t.Fatalf("results %+v, expected the profile to be stored", target.Results)
+			}
+			if test.partial != (target.Reason == ReasonCancelled) || test.partial != strings.Contains(target.Message, "partial") {
+				t.Errorf("target %s %q, partial: %t", target.Reason, target.Message, test.partial)
+			}
+
+			podflame.Status.Targets = []profilepodiov1alpha1.TargetStatus{*target}
+			updatePhase(podflame)
+			if podflame.Status.Phase != test.phase {
+				t.Fatalf("phase = %s, expected %s", podflame.Status.Phase, test.phase)
+			}
+			expectConditions(t, podflame, map[string]metav1.ConditionStatus{
+				terminalCondition(test.phase): metav1.ConditionTrue,
+			})
+			for _, condition := range podflame.Status.Conditions {
+				if condition.Type == terminalCondition(test.phase) && (condition.Reason != test.reason || condition.Message != test.message) {
+					t.Errorf("condition %s %s %q, expected %s %q", condition.Type, condition.Reason, condition.Message, test.reason, test.message)
+				}
+			}
+		})
+	}
+}
@@ -10,4 +10,36 @@ const (
 	// AnnotationNamespace is the annotation on profiler pod that specifies which PodFlame instance
 	// namespace a specific profiler pod is associated with
 	AnnotationNamespace = AnnotationDomain + "/namespace"
+
+	// AnnotationContainer is the annotation on profiler pod that specifies which container
+	// of the target pod is profiled
+	AnnotationContainer = AnnotationDomain + "/container"
+
+	// AnnotationContentType is the annotation on stored results that specifies the media
+	// type of the result once decompressed
+	AnnotationContentType = AnnotationDomain + "/content-type"
+
+	// AnnotationScheduledAt is the annotation on PodFlames created by a PodFlameSchedule
+	// that specifies the scheduled time of their run
+	AnnotationScheduledAt = AnnotationDomain + "/scheduled-at"
+
+	// AnnotationDefaultContainer is the annotation on target pods that specifies which
+	// container is profiled when the PodFlame does not set one
+	AnnotationDefaultContainer = AnnotationDomain + "/default-container"
+
+	// AnnotationKubectlDefaultContainer is the annotation on pods that specifies the
+	// default container of kubectl commands
+	AnnotationKubectlDefaultContainer = "kubectl.kubernetes.io/default-container"
+
+	// AnnotationContainerDefaultedBy is the annotation on PodFlames that specifies which
+	// rule chose the profiled container when the PodFlame did not set one
+	AnnotationContainerDefaultedBy = AnnotationDomain + "/container-defaulted-by"
+
+	// AnnotationStop is the annotation on PodFlames that cancels profiling, like
+	// setting spec.cancel
+	AnnotationStop = AnnotationDomain + "/stop"
+
+	// AnnotationRerun is the annotation on finished PodFlames that starts a new run
+	// every time its value, a nonce, changes
+	AnnotationRerun = AnnotationDomain + "/rerun"
 )
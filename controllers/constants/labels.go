@@ -6,4 +6,7 @@ const (
 
 	// The managed-by key for labels.
 	ManagedBy = "app.kubernetes.io/managed-by"
+
+	// The label on PodFlames created by a PodFlameSchedule holding the schedule name.
+	Schedule = "profilepod.io/schedule"
 )
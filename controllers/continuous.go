@@ -0,0 +1,252 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"github.com/profile-pod/profile-pod-operator/controllers/stacks"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// ReasonTargetEnded is the reason of a continuous target whose pod stopped running
+	ReasonTargetEnded = "TargetEnded"
+
+	// ResultRolling prefixes the names of the results merged from the windows of a target
+	ResultRolling = "rolling"
+
+	// defaultWindowHistory is the number of windows kept when the history is not set
+	defaultWindowHistory = 12
+)
+
+// isContinuous reports whether podflame profiles its targets in windows.
+func isContinuous(podflame *profilepodiov1alpha1.PodFlame) bool {
+	return podflame.Spec.Continuous != nil
+}
+
+// profileDuration returns the duration of a profile, or of a window of a
+// continuous PodFlame.
+func profileDuration(spec *profilepodiov1alpha1.PodFlameSpec) (time.Duration, error) {
+	return time.ParseDuration(strings.ToLower(spec.Duration))
+}
+
+// validateContinuous checks that the windows of a continuous PodFlame do not overlap.
+func validateContinuous(spec *profilepodiov1alpha1.PodFlameSpec) error {
+	if spec.Continuous == nil {
+		return nil
+	}
+	interval, err := time.ParseDuration(spec.Continuous.Interval)
+	if err != nil {
+		return fmt.Errorf("Invalid continuous interval %s: %s", spec.Continuous.Interval, err)
+	}
+	duration, err := profileDuration(spec)
+	if err != nil {
+		return fmt.Errorf("Invalid duration %s: %s", spec.Duration, err)
+	}
+	if interval <= duration {
+		return fmt.Errorf("The continuous interval %s must be longer than the duration %s of a window", spec.Continuous.Interval, spec.Duration)
+	}
+	return nil
+}
+
+// windowAgentPodName returns the name of the agent pod profiling the current
+// window of target.
+func windowAgentPodName(podflame *profilepodiov1alpha1.PodFlame, target *profilepodiov1alpha1.TargetStatus) string {
+	return truncateName(runName(podflame, fmt.Sprintf("%s-%s-%s-w%d", podflame.Namespace, podflame.Name, target.PodName, target.Window)),
+		validation.DNS1123SubdomainMaxLength)
+}
+
+// artifactName returns the name of the result of target in format, which is
+// unique to the window of a continuous PodFlame.
+func artifactName(podflame *profilepodiov1alpha1.PodFlame, target *profilepodiov1alpha1.TargetStatus, format profilepodiov1alpha1.OutputFormat) string {
+	if isContinuous(podflame) {
+		return fmt.Sprintf("%s-w%d-%s", runName(podflame, target.PodName), target.Window, format)
+	}
+	return runName(podflame, target.PodName) + "-" + string(format)
+}
+
+// schedulingPhase returns the phase of a target whose agent pod is not running
+// yet. A continuous target stays Running between its windows.
+func schedulingPhase(target *profilepodiov1alpha1.TargetStatus) profilepodiov1alpha1.PodFlamePhase {
+	if len(target.Windows) > 0 {
+		return profilepodiov1alpha1.PodFlameRunning
+	}
+	return profilepodiov1alpha1.PodFlameScheduling
+}
+
+// waitingForWindow reports whether the next window of target is yet to start.
+func waitingForWindow(target *profilepodiov1alpha1.TargetStatus) bool {
+	return target.NextWindowTime != nil && time.Now().Before(target.NextWindowTime.Time)
+}
+
+// nextWindowResult requeues podflame when the earliest next window of its
+// targets starts.
+func nextWindowResult(podflame *profilepodiov1alpha1.PodFlame) ctrl.Result {
+	if !isContinuous(podflame) || isFinished(podflame) {
+		return ctrl.Result{}
+	}
+	var next *metav1.Time
+	for i := range podflame.Status.Targets {
+		target := &podflame.Status.Targets[i]
+		if targetFinished(target) || !waitingForWindow(target) {
+			continue
+		}
+		if next == nil || target.NextWindowTime.Before(next) {
+			next = target.NextWindowTime
+		}
+	}
+	if next == nil {
+		return ctrl.Result{}
+	}
+	return ctrl.Result{RequeueAfter: time.Until(next.Time)}
+}
+
+// targetEnded ends a continuous target whose pod was deleted or stopped
+// running, and reports whether it did.
+func (reconciler *PodFlameReconciler) targetEnded(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, target *profilepodiov1alpha1.TargetStatus) (bool, error) {
+	targetPod, err := GetTargetPod(reconciler.Clientset, target.PodName, podflame.Namespace, ctx)
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return false, err
+	case targetPod.DeletionTimestamp == nil && targetPod.Status.Phase != corev1.PodSucceeded && targetPod.Status.Phase != corev1.PodFailed:
+		return false, nil
+	}
+	target.Phase = profilepodiov1alpha1.PodFlameSucceeded
+	target.Reason = ReasonTargetEnded
+	target.Message = fmt.Sprintf("Target pod %s ended after %d windows", target.PodName, target.Window)
+	target.NextWindowTime = nil
+	reconciler.Recorder.Event(podflame, "Normal", ReasonTargetEnded, target.Message)
+	return true, nil
+}
+
+// collectWindow collects the result of the agent pod profiling the current
+// window of target, records the window and schedules the next one. A target
+// failing before any window succeeded fails like a single profile.
+func (reconciler *PodFlameReconciler) collectWindow(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, target *profilepodiov1alpha1.TargetStatus, pod *corev1.Pod) (bool, error) {
+	changed, err := reconciler.collectAgentResult(ctx, podflame, target, pod)
+	if err != nil || !changed {
+		return changed, err
+	}
+	target.Windows = append(target.Windows, profilepodiov1alpha1.WindowStatus{
+		Index:     target.Window,
+		Phase:     target.Phase,
+		StartTime: target.StartTime,
+		EndTime:   target.EndTime,
+		Samples:   target.Samples,
+		Results:   target.Results,
+		Reason:    target.Reason,
+		Message:   target.Message,
+	})
+	if latestResults(target) == nil {
+		return true, nil
+	}
+
+	reconciler.trimWindows(ctx, podflame, target)
+	target.Results = latestResults(target)
+	if podflame.Spec.Continuous.RollingAggregate {
+		if err := reconciler.rollWindows(ctx, podflame, target); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to aggregate windows", "target", target.PodName)
+			reconciler.Recorder.Event(podflame, "Warning", "AggregationFailed",
+				fmt.Sprintf("Failed to aggregate the windows of %s: %s", target.PodName, err))
+		}
+	}
+	if cancelRequested(podflame) || target.Phase == profilepodiov1alpha1.PodFlameCancelled {
+		cancelWindow(target)
+		return true, nil
+	}
+	// validateSpec already checked the interval
+	interval, _ := time.ParseDuration(podflame.Spec.Continuous.Interval)
+	next := metav1.NewTime(pod.CreationTimestamp.Add(interval))
+	target.NextWindowTime = &next
+	target.Window++
+	target.AgentPod = windowAgentPodName(podflame, target)
+	target.Phase = profilepodiov1alpha1.PodFlameRunning
+	target.Reason = ""
+	target.Message = ""
+	return true, nil
+}
+
+// latestResults returns the results of the latest window of target that
+// produced a profile, which may be partial when the window was cancelled.
+func latestResults(target *profilepodiov1alpha1.TargetStatus) []profilepodiov1alpha1.ResultReference {
+	for i := len(target.Windows) - 1; i >= 0; i-- {
+		if len(target.Windows[i].Results) > 0 {
+			return target.Windows[i].Results
+		}
+	}
+	return nil
+}
+
+// trimWindows drops the windows of target above the history of podflame and
+// deletes their results.
+func (reconciler *PodFlameReconciler) trimWindows(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, target *profilepodiov1alpha1.TargetStatus) {
+	history := int(podflame.Spec.Continuous.History)
+	if history <= 0 {
+		history = defaultWindowHistory
+	}
+	if len(target.Windows) <= history {
+		return
+	}
+	dropped := target.Windows[:len(target.Windows)-history]
+	target.Windows = append([]profilepodiov1alpha1.WindowStatus(nil), target.Windows[len(dropped):]...)
+	for _, window := range dropped {
+		for i := range window.Results {
+			if err := reconciler.ResultStore.Delete(ctx, podflame, &window.Results[i]); err != nil {
+				log.FromContext(ctx).Error(err, "Failed to delete the result of a dropped window",
+					"target", target.PodName, "window", window.Index, "result", window.Results[i].Name)
+			}
+		}
+	}
+}
+
+// rollWindows merges the collapsed stacks of the succeeded windows of target
+// and stores the merged profile in every requested format but the timeline
+// formats.
+func (reconciler *PodFlameReconciler) rollWindows(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, target *profilepodiov1alpha1.TargetStatus) error {
+	merged := stacks.Stacks{}
+	windows := 0
+	for i := range target.Windows {
+		ref := findResult(target.Windows[i].Results, profilepodiov1alpha1.FormatCollapsed)
+		if ref == nil {
+			continue
+		}
+		windowStacks, err := reconciler.loadStacks(ctx, podflame, ref)
+		if err != nil {
+			return fmt.Errorf("failed to read window %d: %w", target.Windows[i].Index, err)
+		}
+		merged.Add(windowStacks)
+		windows++
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+
+	title := fmt.Sprintf("%s profile of %s/%s, last %d windows of %s", podflame.Spec.Event,
+		podflame.Namespace, target.PodName, windows, podflame.Spec.Duration)
+	var refs []profilepodiov1alpha1.ResultReference
+	for _, format := range requestedFormats(podflame) {
+		if isTimelineFormat(format) {
+			continue
+		}
+		data, err := renderStacks(podflame, merged, format, title)
+		if err != nil {
+			return err
+		}
+		ref, err := reconciler.ResultStore.Save(ctx, podflame, runName(podflame, target.PodName)+"-"+ResultRolling+"-"+string(format), format, data)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, *ref)
+	}
+	target.RollingResults = refs
+	return nil
+}
@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	agentv1 "github.com/profile-pod/profile-pod-operator/api/agent/v1"
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	restclient "k8s.io/client-go/rest"
+	fakerest "k8s.io/client-go/rest/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+// logsClientset is a fake clientset serving logs as the logs of the pods, by
+// pod name, where the fake clientset only serves "fake logs".
+type logsClientset struct {
+	*fake.Clientset
+	logs map[string]string
+}
+
+func (clientset *logsClientset) CoreV1() corev1client.CoreV1Interface {
+	return &logsCoreV1{CoreV1Interface: clientset.Clientset.CoreV1(), logs: clientset.logs}
+}
+
+type logsCoreV1 struct {
+	corev1client.CoreV1Interface
+	logs map[string]string
+}
+
+func (coreV1 *logsCoreV1) Pods(namespace string) corev1client.PodInterface {
+	return &logsPods{PodInterface: coreV1.CoreV1Interface.Pods(namespace), logs: coreV1.logs}
+}
+
+type logsPods struct {
+	corev1client.PodInterface
+	logs map[string]string
+}
+
+func (pods *logsPods) GetLogs(name string, _ *corev1.PodLogOptions) *restclient.Request {
+	logs := pods.logs[name]
+	client := &fakerest.RESTClient{
+		Client: fakerest.CreateHTTPClient(func(*http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(logs))}, nil
+		}),
+		NegotiatedSerializer: serializer.NewCodecFactory(runtime.NewScheme()).WithoutConversion(),
+	}
+	return client.Request()
+}
+
+// agentLogs returns the logs of an agent reporting result.
+func agentLogs(t *testing.T, result *agentv1.Result) string {
+	t.Helper()
+	result.APIVersion = agentv1.APIVersion
+	payload, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	return "Profiling\n" + strings.Join(frame(payload, len(payload), checksum(payload), 76), "\n") + "\n"
+}
+
+// succeededResult returns the result of an agent that sampled collapsed.
+func succeededResult(collapsed string) *agentv1.Result {
+	result := testCollapsedResult(collapsed)
+	result.Samples = 10
+	return result
+}
+
+func testContinuousPodFlame(history int32) *profilepodiov1alpha1.PodFlame {
+	podflame := testPodFlame("my-app-flame", "0123456789abcdef")
+	podflame.Spec = profilepodiov1alpha1.PodFlameSpec{
+		TargetPod:  "my-app-0",
+		Event:      "cpu",
+		Duration:   "10s",
+		Formats:    []profilepodiov1alpha1.OutputFormat{profilepodiov1alpha1.FormatCollapsed},
+		Continuous: &profilepodiov1alpha1.ContinuousSpec{Interval: "5m", History: history},
+	}
+	return podflame
+}
+
+// testContinuousReconciler returns a reconciler storing results in ConfigMaps,
+// whose agent pods log logs.
+func testContinuousReconciler(logs map[string]string, objects ...runtime.Object) (*PodFlameReconciler, kubernetes.Interface) {
+	clientset := &logsClientset{Clientset: fake.NewSimpleClientset(objects...), logs: logs}
+	return &PodFlameReconciler{
+		Clientset:         clientset,
+		OperatorNamesapce: "profile-pod",
+		Recorder:          record.NewFakeRecorder(20),
+		ResultStore:       &objectStore{clientset: clientset, backend: BackendConfigMap},
+		ExportQueue:       NewExportQueue(nil, record.NewFakeRecorder(20), time.Second),
+	}, clientset
+}
+
+// finishedAgentPod returns the agent pod of the current window of target, created at created.
+func finishedAgentPod(target *profilepodiov1alpha1.TargetStatus, created time.Time) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: target.AgentPod, Namespace: "profile-pod", CreationTimestamp: metav1.NewTime(created)},
+		Status:     corev1.PodStatus{Phase: corev1.PodSucceeded},
+	}
+}
+
+func storedResults(t *testing.T, clientset kubernetes.Interface) map[string]bool {
+	t.Helper()
+	configMaps, err := clientset.CoreV1().ConfigMaps("my-app-namespace").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	names := map[string]bool{}
+	for _, configMap := range configMaps.Items {
+		names[configMap.Name] = true
+	}
+	return names
+}
+
+func TestCollectWindowSchedulesTheNextWindow(t *testing.T) {
+	podflame := testContinuousPodFlame(2)
+	target := &profilepodiov1alpha1.TargetStatus{PodName: "my-app-0", Phase: profilepodiov1alpha1.PodFlameRunning}
+	target.AgentPod = windowAgentPodName(podflame, target)
+	reconciler, clientset := testContinuousReconciler(map[string]string{
+		target.AgentPod: agentLogs(t, succeededResult("main;foo 3\n")),
+	})
+	created := time.Now().Add(-20 * time.Second).Truncate(time.Second)
+
+	changed, err := reconciler.collectWindow(context.Background(), podflame, target, finishedAgentPod(target, created))
+	if err != nil || !changed {
+		t.Fatalf("collectWindow = %t, %v", changed, err)
+	}
+	if target.Window != 1 || len(target.Windows) != 1 || target.Windows[0].Index != 0 {
+		t.Fatalf("window %d with windows %+v, expected the next window after window 0", target.Window, target.Windows)
+	}
+	if target.Windows[0].Phase != profilepodiov1alpha1.PodFlameSucceeded || len(target.Windows[0].Results) != 1 {
+		t.Errorf("window 0 %+v, expected it succeeded with its result", target.Windows[0])
+	}
+	if target.Phase != profilepodiov1alpha1.PodFlameRunning || target.Reason != "" {
+		t.Errorf("target %s %s, expected it running between windows", target.Phase, target.Reason)
+	}
+	if target.NextWindowTime == nil || !target.NextWindowTime.Time.Equal(created.Add(5*time.Minute)) {
+		t.Errorf("next window at %v, expected an interval after the start of window 0 at %s", target.NextWindowTime, created)
+	}
+	if !strings.HasSuffix(target.AgentPod, "-w1") {
+		t.Errorf("agent pod %s of window 1", target.AgentPod)
+	}
+	if len(target.Results) != 1 || target.Results[0].Name != target.Windows[0].Results[0].Name {
+		t.Errorf("target results %+v, expected the results of window 0", target.Results)
+	}
+	if !storedResults(t, clientset)[target.Results[0].Name] {
+		t.Errorf("result %s of window 0 is not stored", target.Results[0].Name)
+	}
+	if result := nextWindowResult(&profilepodiov1alpha1.PodFlame{
+		Spec:   podflame.Spec,
+		Status: profilepodiov1alpha1.PodFlameStatus{Phase: profilepodiov1alpha1.PodFlameRunning, Targets: []profilepodiov1alpha1.TargetStatus{*target}},
+	}); result.RequeueAfter <= 0 || result.RequeueAfter > 5*time.Minute {
+		t.Errorf("requeued after %s, expected the start of window 1", result.RequeueAfter)
+	}
+}
+
+func TestCollectWindowTrimsHistory(t *testing.T) {
+	podflame := testContinuousPodFlame(2)
+	target := &profilepodiov1alpha1.TargetStatus{PodName: "my-app-0", Phase: profilepodiov1alpha1.PodFlameRunning}
+	logs := map[string]string{}
+	reconciler, clientset := testContinuousReconciler(logs)
+	ctx := context.Background()
+
+	var windowResults []string
+	for window := 0; window < 4; window++ {
+		target.AgentPod = windowAgentPodName(podflame, target)
+		logs[target.AgentPod] = agentLogs(t, succeededResult(fmt.Sprintf("main;window%d 1\n", window)))
+		if _, err := reconciler.collectWindow(ctx, podflame, target, finishedAgentPod(target, time.Now())); err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+		windowResults = append(windowResults, target.Windows[len(target.Windows)-1].Results[0].Name)
+	}
+
+	if len(target.Windows) != 2 || target.Windows[0].Index != 2 || target.Windows[1].Index != 3 {
+		t.Fatalf("windows %+v, expected windows 2 and 3", target.Windows)
+	}
+	stored := storedResults(t, clientset)
+	for window, name := range windowResults {
+		if kept := window >= 2; stored[name] != kept {
+			t.Errorf("result %s of window %d stored: %t, expected %t", name, window, stored[name], kept)
+		}
+	}
+}
+
+func TestCollectWindowFailure(t *testing.T) {
+	failed := &agentv1.Result{Error: &agentv1.Error{Code: agentv1.ErrorTargetNotFound, Message: "No process found in the target container"}}
+
+	t.Run("first window", func(t *testing.T) {
+		podflame := testContinuousPodFlame(2)
+		target := &profilepodiov1alpha1.TargetStatus{PodName: "my-app-0", Phase: profilepodiov1alpha1.PodFlameRunning}
+		target.AgentPod = windowAgentPodName(podflame, target)
+		reconciler, _ := testContinuousReconciler(map[string]string{target.AgentPod: agentLogs(t, failed)})
+
+		if _, err := reconciler.collectWindow(context.Background(), podflame, target, finishedAgentPod(target, time.Now())); err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+		if target.Phase != profilepodiov1alpha1.PodFlameFailed || target.Reason != agentv1.ErrorTargetNotFound {
+			t.Errorf("target %s %s, expected it failed like a single profile", target.Phase, target.Reason)
+		}
+		if target.NextWindowTime != nil || target.Window != 0 {
+			t.Errorf("window %d scheduled at %v after the first window failed", target.Window, target.NextWindowTime)
+		}
+	})
+
+	t.Run("later window", func(t *testing.T) {
+		podflame := testContinuousPodFlame(2)
+		target := &profilepodiov1alpha1.TargetStatus{PodName: "my-app-0", Phase: profilepodiov1alpha1.PodFlameRunning}
+		logs := map[string]string{}
+		reconciler, _ := testContinuousReconciler(logs)
+		ctx := context.Background()
+
+		target.AgentPod = windowAgentPodName(podflame, target)
+		logs[target.AgentPod] = agentLogs(t, succeededResult("main;foo 1\n"))
+		if _, err := reconciler.collectWindow(ctx, podflame, target, finishedAgentPod(target, time.Now())); err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+		succeeded := target.Results
+		logs[target.AgentPod] = agentLogs(t, failed)
+		if _, err := reconciler.collectWindow(ctx, podflame, target, finishedAgentPod(target, time.Now())); err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+
+		if target.Phase != profilepodiov1alpha1.PodFlameRunning || target.Window != 2 || target.NextWindowTime == nil {
+			t.Errorf("target %s at window %d, expected window 2 scheduled after window 1 failed", target.Phase, target.Window)
+		}
+		if len(target.Windows) != 2 || target.Windows[1].Phase != profilepodiov1alpha1.PodFlameFailed ||
+			target.Windows[1].Reason != agentv1.ErrorTargetNotFound {
+			t.Errorf("windows %+v, expected window 1 recorded as failed", target.Windows)
+		}
+		if len(target.Results) != 1 || target.Results[0].Name != succeeded[0].Name {
+			t.Errorf("target results %+v, expected the results of window 0", target.Results)
+		}
+	})
+}
+
+func TestTargetEnded(t *testing.T) {
+	now := metav1.Now()
+	tests := []struct {
+		name  string
+		pod   *corev1.Pod
+		ended bool
+	}{
+		{name: "running", pod: &testPods("my-app-0")[0]},
+		{name: "deleted", ended: true},
+		{name: "terminating", pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "my-app-0", Namespace: "my-app-namespace", DeletionTimestamp: &now}}, ended: true},
+		{name: "completed", pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "my-app-0", Namespace: "my-app-namespace"}, Status: corev1.PodStatus{Phase: corev1.PodSucceeded}}, ended: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var objects []runtime.Object
+			if test.pod != nil {
+				objects = append(objects, test.pod)
+			}
+			reconciler, _ := testContinuousReconciler(nil, objects...)
+			podflame := testContinuousPodFlame(2)
+			next := metav1.Now()
+			target := &profilepodiov1alpha1.TargetStatus{
+				PodName: "my-app-0", Phase: profilepodiov1alpha1.PodFlameRunning, Window: 3, NextWindowTime: &next,
+				Windows: []profilepodiov1alpha1.WindowStatus{{Index: 2, Phase: profilepodiov1alpha1.PodFlameSucceeded}},
+			}
+
+			ended, err := reconciler.targetEnded(context.Background(), podflame, target)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if ended != test.ended {
+				t.Fatalf("ended = %t, expected %t", ended, test.ended)
+			}
+			if !ended {
+				if target.Phase != profilepodiov1alpha1.PodFlameRunning {
+					t.Errorf("running target moved to %s", target.Phase)
+				}
+				return
+			}
+			if target.Phase != profilepodiov1alpha1.PodFlameSucceeded || target.Reason != ReasonTargetEnded || target.NextWindowTime != nil {
+				t.Errorf("ended target %s %s, next window at %v", target.Phase, target.Reason, target.NextWindowTime)
+			}
+			if !strings.Contains(target.Message, "after 3 windows") {
+				t.Errorf("message %q", target.Message)
+			}
+		})
+	}
+}
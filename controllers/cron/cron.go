@@ -0,0 +1,203 @@
+// Package cron parses the standard five field cron expressions used by
+// Kubernetes CronJobs, e.g. "0 2 * * *", and computes their activation times.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression. Every field is a bit set of the values
+// it matches.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domRestricted and dowRestricted are true when the day of month or day of
+	// week field is not a wildcard, a day then matches when either field matches
+	domRestricted, dowRestricted bool
+}
+
+type bounds struct {
+	name     string
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minutes = bounds{name: "minute", min: 0, max: 59}
+	hours   = bounds{name: "hour", min: 0, max: 23}
+	dom     = bounds{name: "day of month", min: 1, max: 31}
+	months  = bounds{name: "month", min: 1, max: 12, names: map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 is also accepted for Sunday
+	dow = bounds{name: "day of week", min: 0, max: 7, names: map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// descriptors are the predefined schedules.
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a five field cron expression, minute, hour, day of month, month
+// and day of week, or one of the @yearly, @monthly, @weekly, @daily and
+// @hourly descriptors.
+func Parse(expression string) (*Schedule, error) {
+	expression = strings.TrimSpace(expression)
+	if strings.HasPrefix(expression, "@") {
+		standard, found := descriptors[strings.ToLower(expression)]
+		if !found {
+			return nil, fmt.Errorf("unknown cron descriptor %s", expression)
+		}
+		expression = standard
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 cron fields, found %d in %q", len(fields), expression)
+	}
+	schedule := &Schedule{}
+	var err error
+	if schedule.minute, err = parseField(fields[0], minutes); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = parseField(fields[1], hours); err != nil {
+		return nil, err
+	}
+	if schedule.dom, err = parseField(fields[2], dom); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = parseField(fields[3], months); err != nil {
+		return nil, err
+	}
+	if schedule.dow, err = parseField(fields[4], dow); err != nil {
+		return nil, err
+	}
+	// Sunday is both 0 and 7
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow |= 1
+	}
+	schedule.domRestricted = !isWildcard(fields[2])
+	schedule.dowRestricted = !isWildcard(fields[4])
+	return schedule, nil
+}
+
+func isWildcard(field string) bool {
+	return field == "*" || field == "?"
+}
+
+// parseField parses a comma separated list of values, ranges and steps, e.g.
+// "1,15-20,*/10".
+func parseField(field string, b bounds) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, uint(1)
+		if i := strings.Index(part, "/"); i >= 0 {
+			parsed, err := strconv.ParseUint(part[i+1:], 10, 8)
+			if err != nil || parsed == 0 {
+				return 0, fmt.Errorf("invalid step in %s field %q", b.name, part)
+			}
+			rangePart, step = part[:i], uint(parsed)
+		}
+		var low, high uint
+		switch {
+		case rangePart == "*" || rangePart == "?":
+			low, high = b.min, b.max
+		case strings.Contains(rangePart, "-"):
+			i := strings.Index(rangePart, "-")
+			var err error
+			if low, err = parseValue(rangePart[:i], b); err != nil {
+				return 0, err
+			}
+			if high, err = parseValue(rangePart[i+1:], b); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range in %s field %q", b.name, part)
+			}
+		default:
+			value, err := parseValue(rangePart, b)
+			if err != nil {
+				return 0, err
+			}
+			low, high = value, value
+			// A single value with a step, e.g. 5/15, runs to the end of the range
+			if step > 1 {
+				high = b.max
+			}
+		}
+		for value := low; value <= high; value += step {
+			set |= 1 << value
+		}
+	}
+	return set, nil
+}
+
+func parseValue(value string, b bounds) (uint, error) {
+	if number, found := b.names[strings.ToLower(value)]; found {
+		return number, nil
+	}
+	number, err := strconv.ParseUint(value, 10, 8)
+	if err != nil || uint(number) < b.min || uint(number) > b.max {
+		return 0, fmt.Errorf("invalid %s %q, expected a value between %d and %d", b.name, value, b.min, b.max)
+	}
+	return uint(number), nil
+}
+
+// maxSearch bounds the search of the next activation of a schedule that can
+// never activate, such as the 30th of February.
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// Next returns the first activation of the schedule strictly after t, in the
+// location of t, or the zero time when the schedule never activates.
+func (schedule *Schedule) Next(t time.Time) time.Time {
+	location := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+	for t.Before(limit) {
+		if schedule.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, location)
+			continue
+		}
+		if !schedule.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, location)
+			continue
+		}
+		if schedule.hour&(1<<uint(t.Hour())) == 0 {
+			next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, location)
+			if !next.After(t) {
+				// The next hour does not exist on a daylight saving change,
+				// step to the first minute of the next hour of the wall clock
+				for next = t; next.Hour() == t.Hour(); {
+					next = next.Add(time.Minute)
+				}
+			}
+			t = next
+			continue
+		}
+		if schedule.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (schedule *Schedule) matchesDay(t time.Time) bool {
+	domMatch := schedule.dom&(1<<uint(t.Day())) != 0
+	dowMatch := schedule.dow&(1<<uint(t.Weekday())) != 0
+	if schedule.domRestricted && schedule.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
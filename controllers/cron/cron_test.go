@@ -0,0 +1,78 @@
+package cron
+
+import (
+	"testing"
+	"time"
+	// The time zones of the daylight saving tests do not depend on the host
+	_ "time/tzdata"
+)
+
+func TestNext(t *testing.T) {
+	from := time.Date(2023, time.January, 31, 13, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expression string
+		next       time.Time
+	}{
+		{"0 2 * * *", time.Date(2023, time.February, 1, 2, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2023, time.January, 31, 13, 15, 0, 0, time.UTC)},
+		{"30 9-17 * * mon-fri", time.Date(2023, time.January, 31, 13, 30, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * 0", time.Date(2023, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2023, time.February, 5, 12, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2023, time.January, 31, 14, 0, 0, 0, time.UTC)},
+		{"5,10 13 31 jan *", time.Date(2023, time.January, 31, 13, 10, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, test := range tests {
+		schedule, err := Parse(test.expression)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %s", test.expression, err)
+			continue
+		}
+		if next := schedule.Next(from); !next.Equal(test.next) {
+			t.Errorf("Next(%q) = %s, expected %s", test.expression, next, test.next)
+		}
+	}
+}
+
+func TestNextDaylightSaving(t *testing.T) {
+	location := func(name string) *time.Location {
+		t.Helper()
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+		return location
+	}
+	newYork, stJohns, kolkata := location("America/New_York"), location("America/St_Johns"), location("Asia/Kolkata")
+	tests := []struct {
+		expression string
+		from       time.Time
+		next       time.Time
+	}{
+		// 02:00 is skipped, the clock goes from 01:59 to 03:00
+		{"0 3 * * *", time.Date(2024, time.March, 10, 0, 30, 0, 0, newYork), time.Date(2024, time.March, 10, 3, 0, 0, 0, newYork)},
+		{"30 2 * * *", time.Date(2024, time.March, 10, 0, 30, 0, 0, newYork), time.Date(2024, time.March, 11, 2, 30, 0, 0, newYork)},
+		// The same change in a zone offset by half an hour from UTC
+		{"0 3 * * *", time.Date(2024, time.March, 10, 0, 30, 0, 0, stJohns), time.Date(2024, time.March, 10, 3, 0, 0, 0, stJohns)},
+		{"15 * * * *", time.Date(2024, time.March, 10, 1, 30, 0, 0, stJohns), time.Date(2024, time.March, 10, 3, 15, 0, 0, stJohns)},
+		{"0 9 * * *", time.Date(2024, time.March, 10, 0, 30, 0, 0, kolkata), time.Date(2024, time.March, 10, 9, 0, 0, 0, kolkata)},
+	}
+	for _, test := range tests {
+		schedule, err := Parse(test.expression)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %s", test.expression, err)
+		}
+		if next := schedule.Next(test.from); !next.Equal(test.next) {
+			t.Errorf("Next(%q) from %s = %s, expected %s", test.expression, test.from, next, test.next)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "@reboot"} {
+		if _, err := Parse(expression); err == nil {
+			t.Errorf("Parse(%q) succeeded, expected an error", expression)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	agentv1 "github.com/profile-pod/profile-pod-operator/api/agent/v1"
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	EventCPU    = "cpu"
+	EventAlloc  = "alloc"
+	EventWall   = "wall"
+	EventOffCPU = "offcpu"
+	EventLock   = "lock"
+	// PerfEventPrefix prefixes the name of a perf hardware or software event
+	PerfEventPrefix = "perf:"
+
+	UnitsSamples     = "samples"
+	UnitsBytes       = "bytes"
+	UnitsNanoseconds = "nanoseconds"
+	UnitsEvents      = "events"
+
+	ReasonUnsupportedEvent = agentv1.ErrorUnsupportedEvent
+
+	tracefsPath = "/sys/kernel/tracing"
+	debugfsPath = "/sys/kernel/debug"
+	tracefsName = "tracefs"
+	debugfsName = "debugfs"
+)
+
+// validateSpec checks the parts of the PodFlame spec that can not be expressed
+// in the CRD schema.
+func validateSpec(spec *profilepodiov1alpha1.PodFlameSpec) error {
+	if err := validateTarget(spec); err != nil {
+		return err
+	}
+	if err := validateExport(spec); err != nil {
+		return err
+	}
+	if err := validateContinuous(spec); err != nil {
+		return err
+	}
+	return validateEvent(spec)
+}
+
+// perfEvents are the perf hardware and software events the agent can sample.
+var perfEvents = []string{
+	"cycles", "instructions", "ref-cycles", "bus-cycles",
+	"cache-references", "cache-misses", "branch-instructions", "branch-misses",
+	"L1-dcache-load-misses", "LLC-load-misses", "dTLB-load-misses", "iTLB-load-misses",
+	"cpu-clock", "task-clock", "page-faults", "minor-faults", "major-faults",
+	"context-switches", "cpu-migrations",
+}
+
+// isPerfEvent reports whether event is a perf:<event-name> event.
+func isPerfEvent(event string) bool {
+	return strings.HasPrefix(event, PerfEventPrefix)
+}
+
+// validateEvent checks that the profiled event is known and that the event
+// options match it.
+func validateEvent(spec *profilepodiov1alpha1.PodFlameSpec) error {
+	if isPerfEvent(spec.Event) {
+		if err := validatePerfEvent(strings.TrimPrefix(spec.Event, PerfEventPrefix)); err != nil {
+			return err
+		}
+	}
+	options := spec.EventOptions
+	if options == nil {
+		return nil
+	}
+	if options.AllocInterval != "" && spec.Event != EventAlloc {
+		return fmt.Errorf("allocInterval is only valid with the %s event", EventAlloc)
+	}
+	if options.WallInterval != "" && spec.Event != EventWall {
+		return fmt.Errorf("wallInterval is only valid with the %s event", EventWall)
+	}
+	if options.LockThreshold != "" && spec.Event != EventLock {
+		return fmt.Errorf("lockThreshold is only valid with the %s event", EventLock)
+	}
+	if options.SamplePeriod != nil && !isPerfEvent(spec.Event) {
+		return fmt.Errorf("samplePeriod is only valid with %s<event-name> events", PerfEventPrefix)
+	}
+	return nil
+}
+
+func validatePerfEvent(name string) error {
+	for _, known := range perfEvents {
+		if name == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown perf event %s, known events are %s", name, strings.Join(perfEvents, ", "))
+}
+
+// eventOptions returns the agent options carrying the options of the profiled event.
+func eventOptions(spec *profilepodiov1alpha1.PodFlameSpec) agentv1.EventOptions {
+	var options agentv1.EventOptions
+	switch spec.Event {
+	case EventWall:
+		// Wall clock samples are only meaningful per thread
+		options.Threads = true
+	case EventOffCPU:
+		options.TracefsPath = tracefsPath
+	}
+	specOptions := spec.EventOptions
+	if specOptions == nil {
+		return options
+	}
+	if specOptions.AllocInterval != "" {
+		options.Interval = specOptions.AllocInterval
+	}
+	if specOptions.WallInterval != "" {
+		options.Interval = specOptions.WallInterval
+	}
+	options.Threshold = specOptions.LockThreshold
+	if specOptions.SamplePeriod != nil {
+		period := *specOptions.SamplePeriod
+		options.SamplePeriod = &period
+	}
+	return options
+}
+
+// lockLanguages are the languages whose runtime exposes lock contention to the agent.
+var lockLanguages = []string{"java", "go"}
+
+// eventLanguages returns the languages event can be profiled in, nil when it
+// is supported for every language.
+func eventLanguages(event string) []string {
+	if event == EventLock {
+		return lockLanguages
+	}
+	return nil
+}
+
+// validateEventLanguage checks that event can be profiled in an application
+// written in language. An unknown language is accepted.
+func validateEventLanguage(event, language string) error {
+	languages := eventLanguages(event)
+	if languages == nil || language == "" {
+		return nil
+	}
+	for _, supported := range languages {
+		if strings.EqualFold(language, supported) {
+			return nil
+		}
+	}
+	return fmt.Errorf("The %s event is not supported for %s applications, supported languages are %s",
+		event, language, strings.Join(languages, ", "))
+}
+
+// perfUnavailableMessage explains why the node of target could not provide
+// the perf event, from the error reported by the agent.
+func perfUnavailableMessage(event string, target *profilepodiov1alpha1.TargetStatus, agentErr *agentv1.Error) string {
+	message := fmt.Sprintf("The %s event is unavailable on node %s", event, target.NodeName)
+	if paranoid, found := agentErr.Details[agentv1.DetailPerfEventParanoid]; found {
+		message += fmt.Sprintf(" (perf_event_paranoid=%s)", paranoid)
+	}
+	if agentErr.Message != "" {
+		message += ": " + agentErr.Message
+	}
+	return message
+}
+
+// eventVolumes returns the host paths the agent needs beside the container runtime
+// path to profile event. Off-CPU profiling traces scheduler events, which requires
+// the host tracefs and debugfs.
+func eventVolumes(event string) ([]corev1.Volume, []corev1.VolumeMount) {
+	if event != EventOffCPU {
+		return nil, nil
+	}
+	var volumes []corev1.Volume
+	var mounts []corev1.VolumeMount
+	for _, hostPath := range []struct{ name, path string }{{tracefsName, tracefsPath}, {debugfsName, debugfsPath}} {
+		name, path := hostPath.name, hostPath.path
+		volumes = append(volumes, corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: path,
+				},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: path,
+		})
+	}
+	return volumes, mounts
+}
+
+// eventUnits returns the unit of the sample values of a flame graph of event.
+func eventUnits(event string) string {
+	switch event {
+	case EventAlloc:
+		return UnitsBytes
+	case EventOffCPU:
+		return UnitsNanoseconds
+	}
+	if isPerfEvent(event) {
+		return UnitsEvents
+	}
+	return UnitsSamples
+}
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	agentv1 "github.com/profile-pod/profile-pod-operator/api/agent/v1"
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAgentConfigLanguages(t *testing.T) {
+	tests := []struct {
+		event    string
+		expected []string
+	}{
+		{event: EventLock, expected: lockLanguages},
+		{event: EventCPU},
+		{event: "perf:cache-misses"},
+	}
+	for _, test := range tests {
+		t.Run(test.event, func(t *testing.T) {
+			podflame := &profilepodiov1alpha1.PodFlame{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-app-flame", Namespace: "my-app-namespace"},
+				Spec:       profilepodiov1alpha1.PodFlameSpec{Event: test.event, Duration: "1m"},
+			}
+			configMap, err := defineAgentConfig(podflame, "agent", "profile-pod-operator-system", agentv1.Target{}, []string{"html"})
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			config := agentv1.Config{}
+			if err := json.Unmarshal([]byte(configMap.Data[agentv1.ConfigFileName]), &config); err != nil {
+				t.Fatalf("invalid config: %s", err)
+			}
+			if !reflect.DeepEqual(config.Languages, test.expected) {
+				t.Errorf("languages = %v, expected %v", config.Languages, test.expected)
+			}
+		})
+	}
+}
+
+func TestApplyAgentResultUnsupportedLanguage(t *testing.T) {
+	podflame := &profilepodiov1alpha1.PodFlame{Spec: profilepodiov1alpha1.PodFlameSpec{Event: EventLock}}
+	target := &profilepodiov1alpha1.TargetStatus{PodName: "my-app-0"}
+	applyAgentResult(podflame, target, &agentv1.Result{
+		Language: "python",
+		Error:    &agentv1.Error{Code: agentv1.ErrorUnsupportedLanguage, Message: "python is not in java, go"},
+	})
+	if target.Phase != profilepodiov1alpha1.PodFlameFailed || target.Reason != ReasonUnsupportedEvent {
+		t.Fatalf("target is %s with reason %s, expected Failed with %s", target.Phase, target.Reason, ReasonUnsupportedEvent)
+	}
+	if !strings.Contains(target.Message, "not supported for python applications") {
+		t.Errorf("message = %s", target.Message)
+	}
+
+	// Without the check of the agent, the language is still checked with the result
+	target = &profilepodiov1alpha1.TargetStatus{PodName: "my-app-0"}
+	applyAgentResult(podflame, target, &agentv1.Result{Language: "ruby"})
+	if target.Phase != profilepodiov1alpha1.PodFlameFailed || target.Reason != ReasonUnsupportedEvent {
+		t.Errorf("target is %s with reason %s, expected Failed with %s", target.Phase, target.Reason, ReasonUnsupportedEvent)
+	}
+}
+
+func TestValidateEvent(t *testing.T) {
+	period := int64(10000)
+	tests := []struct {
+		name    string
+		event   string
+		options *profilepodiov1alpha1.EventOptions
+		err     string
+	}{
+		{name: "perf event", event: "perf:cache-misses"},
+		{name: "perf event with sample period", event: "perf:cycles", options: &profilepodiov1alpha1.EventOptions{SamplePeriod: &period}},
+		{name: "unknown perf event", event: "perf:cache-hits", err: "Unknown perf event cache-hits"},
+		{name: "perf event names are case sensitive", event: "perf:L1-Dcache-load-misses", err: "Unknown perf event L1-Dcache-load-misses"},
+		{name: "empty perf event", event: "perf:", err: "Unknown perf event , known events are cycles"},
+		{name: "sample period of cpu", event: EventCPU, options: &profilepodiov1alpha1.EventOptions{SamplePeriod: &period}, err: "samplePeriod is only valid with perf:<event-name> events"},
+		{name: "sample period of an unknown perf event", event: "perf:cache-hits", options: &profilepodiov1alpha1.EventOptions{SamplePeriod: &period}, err: "Unknown perf event cache-hits"},
+		{name: "alloc interval of a perf event", event: "perf:cycles", options: &profilepodiov1alpha1.EventOptions{AllocInterval: "512k"}, err: "allocInterval is only valid with the alloc event"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateEvent(&profilepodiov1alpha1.PodFlameSpec{Event: test.event, EventOptions: test.options})
+			if test.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("error = %v, expected %s", err, test.err)
+			}
+		})
+	}
+}
+
+func TestValidatePerfEvent(t *testing.T) {
+	for _, event := range perfEvents {
+		if err := validatePerfEvent(event); err != nil {
+			t.Errorf("unexpected error %s", err)
+		}
+	}
+	if err := validatePerfEvent("perf:cycles"); err == nil {
+		t.Error("expected the event name to be validated without its prefix")
+	}
+}
+
+func TestEventOptionsSamplePeriod(t *testing.T) {
+	period := int64(10000)
+	spec := &profilepodiov1alpha1.PodFlameSpec{Event: "perf:cycles", EventOptions: &profilepodiov1alpha1.EventOptions{SamplePeriod: &period}}
+	options := eventOptions(spec)
+	if options.SamplePeriod == nil || *options.SamplePeriod != period {
+		t.Fatalf("sample period = %v, expected %d", options.SamplePeriod, period)
+	}
+	period = 1
+	if *options.SamplePeriod != 10000 {
+		t.Errorf("the agent options share the sample period of the spec")
+	}
+}
+
+func TestPerfUnavailableMessage(t *testing.T) {
+	target := &profilepodiov1alpha1.TargetStatus{PodName: "my-app-0", NodeName: "node-1"}
+	tests := []struct {
+		name     string
+		err      *agentv1.Error
+		expected string
+	}{
+		{
+			name:     "paranoid",
+			err:      &agentv1.Error{Message: "perf_event_open failed: EACCES", Details: map[string]string{agentv1.DetailPerfEventParanoid: "3"}},
+			expected: "The perf:cycles event is unavailable on node node-1 (perf_event_paranoid=3): perf_event_open failed: EACCES",
+		},
+		{
+			name:     "without details",
+			err:      &agentv1.Error{Message: "the PMU is not virtualized"},
+			expected: "The perf:cycles event is unavailable on node node-1: the PMU is not virtualized",
+		},
+		{
+			name:     "without message",
+			err:      &agentv1.Error{Details: map[string]string{agentv1.DetailPerfEventParanoid: "2"}},
+			expected: "The perf:cycles event is unavailable on node node-1 (perf_event_paranoid=2)",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if message := perfUnavailableMessage("perf:cycles", target, test.err); message != test.expected {
+				t.Errorf("message = %q, expected %q", message, test.expected)
+			}
+		})
+	}
+}
+
+func TestApplyAgentResultPerfUnavailable(t *testing.T) {
+	podflame := &profilepodiov1alpha1.PodFlame{Spec: profilepodiov1alpha1.PodFlameSpec{Event: "perf:cache-misses"}}
+	target := &profilepodiov1alpha1.TargetStatus{PodName: "my-app-0", NodeName: "node-1"}
+	applyAgentResult(podflame, target, &agentv1.Result{Error: &agentv1.Error{
+		Code:    agentv1.ErrorPerfEventUnavailable,
+		Message: "perf_event_open failed: EACCES",
+		Details: map[string]string{agentv1.DetailPerfEventParanoid: "3"},
+	}})
+	if target.Phase != profilepodiov1alpha1.PodFlameFailed || target.Reason != agentv1.ErrorPerfEventUnavailable {
+		t.Fatalf("target is %s with reason %s, expected Failed with %s", target.Phase, target.Reason, agentv1.ErrorPerfEventUnavailable)
+	}
+	if !strings.Contains(target.Message, "on node node-1 (perf_event_paranoid=3)") {
+		t.Errorf("message = %s", target.Message)
+	}
+}
@@ -0,0 +1,331 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	agentv1 "github.com/profile-pod/profile-pod-operator/api/agent/v1"
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"github.com/profile-pod/profile-pod-operator/controllers/exporter"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// ConditionExported is true once the profiles of every succeeded target were pushed to the configured exporters
+	ConditionExported = "Exported"
+
+	ReasonExportPending    = "ExportPending"
+	ReasonProfilesExported = "ProfilesExported"
+	ReasonExportFailed     = "ExportFailed"
+	ReasonExportLost       = "ExportLost"
+
+	// defaultExportTimeout is the timeout of an OTLP exporter only configured by a PodFlame
+	defaultExportTimeout = 30 * time.Second
+)
+
+// ExportOptions configures where the operator pushes completed profiles.
+type ExportOptions struct {
+	Pyroscope PyroscopeOptions
+	OTLP      OTLPOptions
+}
+
+// OTLPOptions configures the OTLP profiles exporter, which PodFlames can override.
+type OTLPOptions struct {
+	// Endpoint is the URL of the collector, the exporter is disabled when it is empty
+	Endpoint string
+	// Protocol is the transport to the collector, grpc or http
+	Protocol string
+	// Retries is the number of times a failed export is retried
+	Retries int
+	Timeout time.Duration
+	// AllowedEndpoints are the endpoints PodFlames may export to besides Endpoint
+	AllowedEndpoints []string
+}
+
+// PyroscopeOptions configures the Pyroscope exporter.
+type PyroscopeOptions struct {
+	// URL is the base URL of the Pyroscope-compatible server, the exporter is disabled when it is empty
+	URL string
+	// Format is the format of the pushed profiles, folded or pprof
+	Format string
+	// Retries is the number of times a failed push is retried
+	Retries int
+	Timeout time.Duration
+}
+
+// NewExporters returns the exporters configured by options.
+func NewExporters(options ExportOptions) ([]exporter.Exporter, error) {
+	var exporters []exporter.Exporter
+	if pyroscope := options.Pyroscope; pyroscope.URL != "" {
+		endpoint, err := url.Parse(pyroscope.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pyroscope url: %w", err)
+		}
+		switch pyroscope.Format {
+		case exporter.PyroscopeFolded, exporter.PyroscopePprof:
+		default:
+			return nil, fmt.Errorf("Unknown pyroscope format %s, known formats are %s, %s",
+				pyroscope.Format, exporter.PyroscopeFolded, exporter.PyroscopePprof)
+		}
+		retry := exporter.DefaultRetry
+		retry.Attempts = pyroscope.Retries + 1
+		exporters = append(exporters, &exporter.Pyroscope{
+			URL:        endpoint,
+			Format:     pyroscope.Format,
+			Retry:      retry,
+			HTTPClient: &http.Client{Timeout: pyroscope.Timeout},
+		})
+	}
+	for _, allowed := range options.OTLP.AllowedEndpoints {
+		if endpoint, err := url.Parse(allowed); err != nil || endpoint.Scheme != "http" && endpoint.Scheme != "https" || endpoint.Host == "" {
+			return nil, fmt.Errorf("allowed otlp endpoint %s must be an http or https URL", allowed)
+		}
+	}
+	if otlp := options.OTLP; otlp.Endpoint != "" {
+		endpoint, err := url.Parse(otlp.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid otlp endpoint: %w", err)
+		}
+		retry := exporter.DefaultRetry
+		retry.Attempts = otlp.Retries + 1
+		otlpExporter, err := exporter.NewOTLP(endpoint, otlp.Protocol, retry, otlp.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, otlpExporter)
+	}
+	return exporters, nil
+}
+
+// validateExport checks the exporter overrides of the PodFlame spec.
+func validateExport(spec *profilepodiov1alpha1.PodFlameSpec) error {
+	if spec.Export == nil || spec.Export.OTLP == nil || spec.Export.OTLP.Endpoint == "" {
+		return nil
+	}
+	endpoint, err := url.Parse(spec.Export.OTLP.Endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid export.otlp.endpoint: %w", err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" || endpoint.Host == "" {
+		return fmt.Errorf("export.otlp.endpoint %s must be an http or https URL", spec.Export.OTLP.Endpoint)
+	}
+	return nil
+}
+
+// podflameExporters returns the exporters of the profiles of podflame, the
+// exporters of the operator with the OTLP exporter overridden by its spec. A
+// PodFlame may only export to the endpoint of the operator or to one of
+// OTLPAllowedEndpoints.
+func (reconciler *PodFlameReconciler) podflameExporters(podflame *profilepodiov1alpha1.PodFlame) ([]exporter.Exporter, error) {
+	if podflame.Spec.Export == nil || podflame.Spec.Export.OTLP == nil {
+		return reconciler.Exporters, nil
+	}
+	override := podflame.Spec.Export.OTLP
+	var exporters []exporter.Exporter
+	var configured *exporter.OTLP
+	for _, operatorExporter := range reconciler.Exporters {
+		if otlp, ok := operatorExporter.(*exporter.OTLP); ok {
+			configured = otlp
+			continue
+		}
+		exporters = append(exporters, operatorExporter)
+	}
+	if override.Disabled {
+		return exporters, nil
+	}
+	if override.Endpoint == "" && override.Protocol == "" {
+		if configured != nil {
+			exporters = append(exporters, configured)
+		}
+		return exporters, nil
+	}
+
+	var endpoint *url.URL
+	protocol, retry, timeout := exporter.OTLPGRPC, exporter.DefaultRetry, defaultExportTimeout
+	if configured != nil {
+		endpoint, protocol, retry, timeout = configured.Endpoint, configured.Protocol, configured.Retry, configured.Timeout
+	}
+	if override.Endpoint != "" {
+		var err error
+		if endpoint, err = url.Parse(override.Endpoint); err != nil {
+			return nil, fmt.Errorf("invalid export.otlp.endpoint: %w", err)
+		}
+		if !reconciler.otlpEndpointAllowed(endpoint, configured) {
+			return nil, fmt.Errorf("export.otlp.endpoint %s is not allowed, the operator only exports to the endpoints listed by --otlp-allowed-endpoints", override.Endpoint)
+		}
+	}
+	if override.Protocol != "" {
+		protocol = string(override.Protocol)
+	}
+	if endpoint == nil {
+		return nil, fmt.Errorf("export.otlp.protocol requires an endpoint, none is configured on the operator")
+	}
+	otlp, err := reconciler.otlpExporter(endpoint, protocol, retry, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return append(exporters, otlp), nil
+}
+
+// otlpEndpointAllowed reports whether a PodFlame may export to endpoint, the
+// endpoint of the configured exporter or one of OTLPAllowedEndpoints.
+func (reconciler *PodFlameReconciler) otlpEndpointAllowed(endpoint *url.URL, configured *exporter.OTLP) bool {
+	if configured != nil && sameEndpoint(endpoint, configured.Endpoint) {
+		return true
+	}
+	for _, allowed := range reconciler.OTLPAllowedEndpoints {
+		if allowedURL, err := url.Parse(allowed); err == nil && sameEndpoint(endpoint, allowedURL) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameEndpoint reports whether a and b address the same collector, ignoring
+// the case of the host and a trailing slash.
+func sameEndpoint(a, b *url.URL) bool {
+	return a.Scheme == b.Scheme && strings.EqualFold(a.Host, b.Host) && a.User == nil && b.User == nil &&
+		strings.TrimSuffix(a.Path, "/") == strings.TrimSuffix(b.Path, "/") && a.RawQuery == b.RawQuery
+}
+
+// otlpExporter returns the OTLP exporter sending to endpoint over protocol,
+// which is created once and shared by every PodFlame overriding the operator
+// with them so that its connections are reused.
+func (reconciler *PodFlameReconciler) otlpExporter(endpoint *url.URL, protocol string, retry exporter.Retry, timeout time.Duration) (*exporter.OTLP, error) {
+	key := protocol + " " + endpoint.String()
+	reconciler.otlpMutex.Lock()
+	defer reconciler.otlpMutex.Unlock()
+	if otlp, found := reconciler.otlpExporters[key]; found {
+		return otlp, nil
+	}
+	otlp, err := exporter.NewOTLP(endpoint, protocol, retry, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if reconciler.otlpExporters == nil {
+		reconciler.otlpExporters = map[string]*exporter.OTLP{}
+	}
+	reconciler.otlpExporters[key] = otlp
+	return otlp, nil
+}
+
+// withExportFormats returns the agent formats extended with the collapsed
+// stacks pushed by the exporters of podflame.
+func (reconciler *PodFlameReconciler) withExportFormats(podflame *profilepodiov1alpha1.PodFlame, formats []string) []string {
+	if !reconciler.exports(podflame) {
+		return formats
+	}
+	for _, format := range formats {
+		if format == agentv1.FormatCollapsed {
+			return formats
+		}
+	}
+	return append(formats, agentv1.FormatCollapsed)
+}
+
+// exports reports whether the profiles of podflame are exported anywhere.
+func (reconciler *PodFlameReconciler) exports(podflame *profilepodiov1alpha1.PodFlame) bool {
+	exporters, err := reconciler.podflameExporters(podflame)
+	// An invalid override is reported when exporting
+	return len(exporters) > 0 || err != nil
+}
+
+// exportTarget holds the profile of a succeeded target for the exporters of
+// podflame, it is pushed in the background once the status recording the
+// target was written. A failed export does not fail profiling.
+func (reconciler *PodFlameReconciler) exportTarget(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, target *profilepodiov1alpha1.TargetStatus, result *agentv1.Result) {
+	exporters, err := reconciler.podflameExporters(podflame)
+	if err != nil {
+		reconciler.exportFailed(podflame, target, "otlp", err)
+		return
+	}
+	if len(exporters) == 0 {
+		return
+	}
+	collapsed, err := parseCollapsedArtifact(result)
+	if err != nil {
+		reconciler.exportFailed(podflame, target, "exporters", err)
+		return
+	}
+	profile := &exporter.Profile{
+		Name:   target.PodName,
+		Event:  podflame.Spec.Event,
+		Units:  eventUnits(podflame.Spec.Event),
+		Target: reconciler.exportedTarget(ctx, podflame, target),
+		Start:  exportTime(target.StartTime, podflame.Status.StartTime),
+		End:    exportTime(target.EndTime, nil),
+		Stacks: collapsed,
+	}
+	if profile.Target.Workload != "" {
+		profile.Name = profile.Target.Workload
+	}
+	reconciler.ExportQueue.add(podflame, &profileExport{
+		podflame:  types.NamespacedName{Namespace: podflame.Namespace, Name: podflame.Name},
+		uid:       podflame.UID,
+		run:       podflame.Status.Run,
+		target:    target.PodName,
+		profile:   profile,
+		exporters: exporters,
+	})
+	if condition := meta.FindStatusCondition(podflame.Status.Conditions, ConditionExported); condition == nil || condition.Status != metav1.ConditionFalse {
+		setCondition(podflame, ConditionExported, metav1.ConditionUnknown, ReasonExportPending,
+			fmt.Sprintf("Exporting profile of %s", target.PodName))
+	}
+}
+
+// exportFailed records that the profile of target could not be pushed to the exporter called name.
+func (reconciler *PodFlameReconciler) exportFailed(podflame *profilepodiov1alpha1.PodFlame, target *profilepodiov1alpha1.TargetStatus, name string, err error) {
+	message := fmt.Sprintf("Failed to export profile of %s to %s: %s", target.PodName, name, err)
+	setCondition(podflame, ConditionExported, metav1.ConditionFalse, ReasonExportFailed, message)
+	reconciler.Recorder.Event(podflame, "Warning", ReasonExportFailed, message)
+}
+
+// exportTime returns the first set time among times, or now.
+func exportTime(times ...*metav1.Time) time.Time {
+	for _, t := range times {
+		if t != nil {
+			return t.Time
+		}
+	}
+	return time.Now()
+}
+
+// exportedTarget describes target for the exporters. The container id and
+// workload are read from the target pod, and are left empty when it is gone.
+// The workload follows ReplicaSets up to their Deployment.
+func (reconciler *PodFlameReconciler) exportedTarget(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, target *profilepodiov1alpha1.TargetStatus) exporter.Target {
+	exported := exporter.Target{
+		Namespace: podflame.Namespace,
+		Pod:       target.PodName,
+		Container: target.ContainerName,
+		Node:      target.NodeName,
+	}
+	pod, err := GetTargetPod(reconciler.Clientset, target.PodName, podflame.Namespace, ctx)
+	if err != nil {
+		return exported
+	}
+	if _, containerID, err := GetContainerDetailes(target.ContainerName, pod); err == nil {
+		exported.ContainerID = containerID
+	}
+	controllerRef := metav1.GetControllerOf(pod)
+	if controllerRef == nil {
+		return exported
+	}
+	if controllerRef.Kind == "ReplicaSet" {
+		replicaSet, err := reconciler.Clientset.AppsV1().ReplicaSets(podflame.Namespace).Get(ctx, controllerRef.Name, metav1.GetOptions{})
+		if err == nil {
+			if owner := metav1.GetControllerOf(replicaSet); owner != nil && owner.Kind == "Deployment" {
+				controllerRef = owner
+			}
+		}
+	}
+	exported.WorkloadKind = strings.ToLower(controllerRef.Kind)
+	exported.Workload = controllerRef.Name
+	return exported
+}
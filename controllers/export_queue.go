@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"github.com/profile-pod/profile-pod-operator/controllers/exporter"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// exportWorkers is the number of profiles pushed at the same time
+	exportWorkers = 4
+
+	// DefaultExportDeadline bounds the push of a profile to every exporter, retries included
+	DefaultExportDeadline = 5 * time.Minute
+)
+
+// profileExport is the profile of a target waiting to be pushed to exporters.
+type profileExport struct {
+	podflame types.NamespacedName
+	uid      types.UID
+	run      int64
+	target   string
+	profile  *exporter.Profile
+	// exporters receive the profile
+	exporters []exporter.Exporter
+}
+
+// ExportQueue pushes profiles to the exporters in the background, so that a
+// slow or unreachable exporter does not hold the reconciler. The profiles of a
+// PodFlame are held back until the status recording the collected targets was
+// written, then pushed once and their outcome is written to the Exported
+// condition of the PodFlame.
+type ExportQueue struct {
+	Client   client.Client
+	Recorder record.EventRecorder
+	// Deadline bounds the push of a profile to every exporter, DefaultExportDeadline when zero
+	Deadline time.Duration
+
+	queue   workqueue.Interface
+	mutex   sync.Mutex
+	pending map[types.UID][]*profileExport
+	// created is when the queue was created, the exports pending since before
+	// were queued by a previous process of the operator
+	created time.Time
+}
+
+// NewExportQueue returns an export queue writing the outcome of the exports with client.
+func NewExportQueue(client client.Client, recorder record.EventRecorder, deadline time.Duration) *ExportQueue {
+	return &ExportQueue{
+		Client:   client,
+		Recorder: recorder,
+		Deadline: deadline,
+		queue:    workqueue.New(),
+		pending:  map[types.UID][]*profileExport{},
+		created:  time.Now(),
+	}
+}
+
+// Start pushes the queued profiles until ctx is done, it implements the
+// Runnable of the manager. The exports left pending by a previous process of
+// the operator are recorded as lost first.
+func (queue *ExportQueue) Start(ctx context.Context) error {
+	if err := queue.recordLost(ctx); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to record the exports lost on restart")
+	}
+	var workers sync.WaitGroup
+	for i := 0; i < exportWorkers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for queue.processNext(ctx) {
+			}
+		}()
+	}
+	<-ctx.Done()
+	queue.queue.ShutDown()
+	workers.Wait()
+	return nil
+}
+
+// add holds export until the status of podflame is written.
+func (queue *ExportQueue) add(podflame *profilepodiov1alpha1.PodFlame, export *profileExport) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.pending[podflame.UID] = append(queue.pending[podflame.UID], export)
+}
+
+// commit queues the profiles held for podflame, once its status was written.
+func (queue *ExportQueue) commit(podflame *profilepodiov1alpha1.PodFlame) {
+	queue.mutex.Lock()
+	exports := queue.pending[podflame.UID]
+	delete(queue.pending, podflame.UID)
+	queue.mutex.Unlock()
+	for _, export := range exports {
+		queue.queue.Add(export)
+	}
+}
+
+// discard drops the profiles held for podflame when its status could not be
+// written, they are collected and held again by the next reconcile.
+func (queue *ExportQueue) discard(podflame *profilepodiov1alpha1.PodFlame) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	delete(queue.pending, podflame.UID)
+}
+
+func (queue *ExportQueue) processNext(ctx context.Context) bool {
+	item, shutdown := queue.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer queue.queue.Done(item)
+	queue.push(ctx, item.(*profileExport))
+	return true
+}
+
+// push sends export to its exporters and records the outcome.
+func (queue *ExportQueue) push(ctx context.Context, export *profileExport) {
+	deadline := queue.Deadline
+	if deadline <= 0 {
+		deadline = DefaultExportDeadline
+	}
+	// The outcome is recorded with ctx, which outlives the deadline
+	pushCtx, cancel := context.WithTimeout(ctx, deadline)
+	defer cancel()
+	log := log.FromContext(ctx).WithValues("podflame", export.podflame, "target", export.target)
+
+	var failures []string
+	var exported []string
+	for _, profileExporter := range export.exporters {
+		if err := profileExporter.Export(pushCtx, export.profile); err != nil {
+			failures = append(failures, fmt.Sprintf("Failed to export profile of %s to %s: %s", export.target, profileExporter.Name(), err))
+			continue
+		}
+		log.Info(fmt.Sprintf("Exported profile of %s to %s", export.target, profileExporter.Name()))
+		exported = append(exported, profileExporter.Name())
+	}
+	if err := queue.recordExport(ctx, export, exported, failures); err != nil {
+		log.Error(err, "Failed to record the export of a profile")
+	}
+}
+
+// recordExport writes the outcome of export to the Exported condition of its
+// PodFlame, unless the PodFlame was deleted or started another run since. A
+// failed export is kept over the success of a later one.
+func (queue *ExportQueue) recordExport(ctx context.Context, export *profileExport, exported, failures []string) error {
+	podflame := &profilepodiov1alpha1.PodFlame{}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := queue.Client.Get(ctx, export.podflame, podflame); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		if podflame.UID != export.uid || podflame.Status.Run != export.run {
+			return nil
+		}
+		for _, message := range failures {
+			setCondition(podflame, ConditionExported, metav1.ConditionFalse, ReasonExportFailed, message)
+		}
+		condition := meta.FindStatusCondition(podflame.Status.Conditions, ConditionExported)
+		for _, name := range exported {
+			if condition == nil || condition.Status != metav1.ConditionFalse {
+				setCondition(podflame, ConditionExported, metav1.ConditionTrue, ReasonProfilesExported,
+					fmt.Sprintf("Exported profile of %s to %s", export.target, name))
+			}
+		}
+		if err := queue.Client.Status().Update(ctx, podflame); err != nil {
+			return err
+		}
+		for _, message := range failures {
+			queue.Recorder.Event(podflame, "Warning", ReasonExportFailed, message)
+		}
+		return nil
+	})
+}
+
+// recordLost fails the Exported condition of the PodFlames whose export was
+// pending before the queue was created. The queue is only held in memory, so
+// their profiles were lost when the operator restarted and are not exported.
+func (queue *ExportQueue) recordLost(ctx context.Context) error {
+	podflames := &profilepodiov1alpha1.PodFlameList{}
+	if err := queue.Client.List(ctx, podflames); err != nil {
+		return err
+	}
+	// Conditions are stored with a precision of a second
+	created := queue.created.Truncate(time.Second)
+	for i := range podflames.Items {
+		podflame := &podflames.Items[i]
+		condition := meta.FindStatusCondition(podflame.Status.Conditions, ConditionExported)
+		if condition == nil || condition.Status != metav1.ConditionUnknown || !condition.LastTransitionTime.Time.Before(created) {
+			continue
+		}
+		message := fmt.Sprintf("The operator restarted before the profiles of run %d were exported, they are not exported", podflame.Status.Run)
+		setCondition(podflame, ConditionExported, metav1.ConditionFalse, ReasonExportLost, message)
+		if err := queue.Client.Status().Update(ctx, podflame); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		queue.Recorder.Event(podflame, "Warning", ReasonExportLost, message)
+	}
+	return nil
+}
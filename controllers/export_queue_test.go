@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	agentv1 "github.com/profile-pod/profile-pod-operator/api/agent/v1"
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"github.com/profile-pod/profile-pod-operator/controllers/exporter"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// testExporter records the profiles it is asked to export.
+type testExporter struct {
+	name     string
+	err      error
+	block    bool
+	profiles []*exporter.Profile
+}
+
+func (testExporter *testExporter) Name() string { return testExporter.name }
+
+func (testExporter *testExporter) Export(ctx context.Context, profile *exporter.Profile) error {
+	if testExporter.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	testExporter.profiles = append(testExporter.profiles, profile)
+	return testExporter.err
+}
+
+// testClient returns a controller-runtime fake client holding objects.
+func testClient(objects ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	if err := profilepodiov1alpha1.AddToScheme(scheme); err != nil {
+		panic(err)
+	}
+	return clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+}
+
+func testCollapsedResult(collapsed string) *agentv1.Result {
+	return &agentv1.Result{Artifacts: []agentv1.Artifact{
+		{Format: agentv1.FormatCollapsed, Encoding: agentv1.EncodingIdentity, Data: []byte(collapsed)},
+	}}
+}
+
+func exportedCondition(t *testing.T, c client.Client, podflame *profilepodiov1alpha1.PodFlame) *metav1.Condition {
+	t.Helper()
+	stored := &profilepodiov1alpha1.PodFlame{}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: podflame.Namespace, Name: podflame.Name}, stored); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	return meta.FindStatusCondition(stored.Status.Conditions, ConditionExported)
+}
+
+func TestExportTargetWaitsForTheStatus(t *testing.T) {
+	podflame := testPodFlame("my-app-flame", "0123456789abcdef")
+	podflame.Spec.Event = "cpu"
+	c := testClient(podflame.DeepCopy())
+	pushed := &testExporter{name: "pyroscope"}
+	queue := NewExportQueue(c, record.NewFakeRecorder(10), time.Second)
+	reconciler := &PodFlameReconciler{
+		Clientset:   fake.NewSimpleClientset(),
+		Recorder:    record.NewFakeRecorder(10),
+		Exporters:   []exporter.Exporter{pushed},
+		ExportQueue: queue,
+	}
+	target := &profilepodiov1alpha1.TargetStatus{PodName: "my-app-0", Phase: profilepodiov1alpha1.PodFlameSucceeded}
+	ctx := context.Background()
+
+	// A status that could not be written drops the profile, the next reconcile
+	// collects it again
+	reconciler.exportTarget(ctx, podflame, target, testCollapsedResult("main;foo 3\n"))
+	expectConditions(t, podflame, map[string]metav1.ConditionStatus{ConditionExported: metav1.ConditionUnknown})
+	queue.discard(podflame)
+	queue.commit(podflame)
+	if queue.queue.Len() != 0 {
+		t.Fatalf("%d profiles queued after the status update failed", queue.queue.Len())
+	}
+
+	reconciler.exportTarget(ctx, podflame, target, testCollapsedResult("main;foo 3\n"))
+	if len(pushed.profiles) != 0 {
+		t.Fatal("profile pushed before the status was written")
+	}
+	queue.commit(podflame)
+	queue.commit(podflame)
+	if queue.queue.Len() != 1 {
+		t.Fatalf("%d profiles queued, expected 1", queue.queue.Len())
+	}
+	if !queue.processNext(ctx) {
+		t.Fatal("queue shut down")
+	}
+	if len(pushed.profiles) != 1 || pushed.profiles[0].Name != "my-app-0" || pushed.profiles[0].Stacks["main;foo"] != 3 {
+		t.Fatalf("pushed %+v", pushed.profiles)
+	}
+	condition := exportedCondition(t, c, podflame)
+	if condition == nil || condition.Status != metav1.ConditionTrue || condition.Reason != ReasonProfilesExported {
+		t.Errorf("Exported condition %+v, expected it true", condition)
+	}
+}
+
+func TestExportQueueRecordsFailures(t *testing.T) {
+	podflame := testPodFlame("my-app-flame", "0123456789abcdef")
+	c := testClient(podflame.DeepCopy())
+	queue := NewExportQueue(c, record.NewFakeRecorder(10), 10*time.Millisecond)
+	ctx := context.Background()
+	export := func(exporters ...exporter.Exporter) *profileExport {
+		return &profileExport{
+			podflame:  types.NamespacedName{Namespace: podflame.Namespace, Name: podflame.Name},
+			uid:       podflame.UID,
+			target:    "my-app-0",
+			profile:   &exporter.Profile{Name: "my-app-0"},
+			exporters: exporters,
+		}
+	}
+
+	// A hanging exporter is abandoned at the deadline and does not stop the others
+	slow, failing, working := &testExporter{name: "slow", block: true}, &testExporter{name: "failing", err: errors.New("503 Service Unavailable")}, &testExporter{name: "working"}
+	start := time.Now()
+	queue.push(ctx, export(slow, failing, working))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("push took %s, longer than its deadline", elapsed)
+	}
+	if len(working.profiles) != 1 {
+		t.Errorf("working exporter received %d profiles", len(working.profiles))
+	}
+	condition := exportedCondition(t, c, podflame)
+	if condition == nil || condition.Status != metav1.ConditionFalse || !strings.Contains(condition.Message, "to failing: 503") {
+		t.Fatalf("Exported condition %+v, expected the failure", condition)
+	}
+
+	// A later success does not hide the failure
+	queue.push(ctx, export(working))
+	if condition := exportedCondition(t, c, podflame); condition.Status != metav1.ConditionFalse {
+		t.Errorf("Exported condition %+v, expected the failure to be kept", condition)
+	}
+
+	// The outcome of an export of a previous run is not recorded
+	stored := &profilepodiov1alpha1.PodFlame{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: podflame.Namespace, Name: podflame.Name}, stored); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	stored.Status.Run = 1
+	stored.Status.Conditions = nil
+	if err := c.Status().Update(ctx, stored); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	queue.push(ctx, export(failing))
+	if condition := exportedCondition(t, c, podflame); condition != nil {
+		t.Errorf("Exported condition %+v recorded on the next run", condition)
+	}
+}
+
+func TestExportQueueRecordsLostExports(t *testing.T) {
+	pendingCondition := func(podflame *profilepodiov1alpha1.PodFlame, status metav1.ConditionStatus, transition time.Time) *profilepodiov1alpha1.PodFlame {
+		podflame.Status.Conditions = []metav1.Condition{{
+			Type:               ConditionExported,
+			Status:             status,
+			Reason:             ReasonExportPending,
+			LastTransitionTime: metav1.NewTime(transition),
+		}}
+		return podflame
+	}
+	queue := NewExportQueue(nil, record.NewFakeRecorder(10), time.Second)
+	before, after := queue.created.Add(-time.Hour), queue.created.Add(time.Second)
+	lost := pendingCondition(testPodFlame("lost", "0"), metav1.ConditionUnknown, before)
+	lost.Status.Run = 2
+	queued := pendingCondition(testPodFlame("queued", "1"), metav1.ConditionUnknown, after)
+	exported := pendingCondition(testPodFlame("exported", "2"), metav1.ConditionTrue, before)
+	c := testClient(lost, queued, exported)
+	queue.Client = c
+
+	if err := queue.recordLost(context.Background()); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	condition := exportedCondition(t, c, lost)
+	if condition.Status != metav1.ConditionFalse || condition.Reason != ReasonExportLost || !strings.Contains(condition.Message, "run 2") {
+		t.Errorf("Exported condition %+v, expected the export to be lost", condition)
+	}
+	if condition := exportedCondition(t, c, queued); condition.Status != metav1.ConditionUnknown {
+		t.Errorf("Exported condition %+v of an export queued by this process", condition)
+	}
+	if condition := exportedCondition(t, c, exported); condition.Status != metav1.ConditionTrue {
+		t.Errorf("Exported condition %+v of a finished export", condition)
+	}
+}
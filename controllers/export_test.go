@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"github.com/profile-pod/profile-pod-operator/controllers/exporter"
+)
+
+func TestPodFlameExporters(t *testing.T) {
+	operatorEndpoint, _ := url.Parse("http://otel-collector.monitoring:4317")
+	retry := exporter.Retry{Attempts: 5, Backoff: time.Second}
+	operatorOTLP, err := exporter.NewOTLP(operatorEndpoint, exporter.OTLPGRPC, retry, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	pyroscope := &exporter.Pyroscope{}
+
+	tests := []struct {
+		name      string
+		exporters []exporter.Exporter
+		override  *profilepodiov1alpha1.OTLPExportSpec
+		// expected are the pyroscope exporter and the endpoint and protocol of
+		// the OTLP exporter, if any
+		pyroscope bool
+		endpoint  string
+		protocol  string
+		shared    bool
+		err       string
+	}{
+		{
+			name: "no override", exporters: []exporter.Exporter{pyroscope, operatorOTLP},
+			pyroscope: true, endpoint: "http://otel-collector.monitoring:4317", protocol: exporter.OTLPGRPC, shared: true,
+		},
+		{
+			name: "empty override", exporters: []exporter.Exporter{pyroscope, operatorOTLP},
+			override:  &profilepodiov1alpha1.OTLPExportSpec{},
+			pyroscope: true, endpoint: "http://otel-collector.monitoring:4317", protocol: exporter.OTLPGRPC, shared: true,
+		},
+		{
+			name: "disabled", exporters: []exporter.Exporter{pyroscope, operatorOTLP},
+			override:  &profilepodiov1alpha1.OTLPExportSpec{Disabled: true, Endpoint: "http://otel-collector.team-a:4318"},
+			pyroscope: true,
+		},
+		{
+			name: "endpoint only", exporters: []exporter.Exporter{operatorOTLP},
+			override: &profilepodiov1alpha1.OTLPExportSpec{Endpoint: "http://otel-collector.team-a:4318"},
+			endpoint: "http://otel-collector.team-a:4318", protocol: exporter.OTLPGRPC,
+		},
+		{
+			name: "endpoint of the operator", exporters: []exporter.Exporter{operatorOTLP},
+			override: &profilepodiov1alpha1.OTLPExportSpec{Endpoint: "http://OTEL-collector.monitoring:4317/"},
+			endpoint: "http://OTEL-collector.monitoring:4317/", protocol: exporter.OTLPGRPC,
+		},
+		{
+			name: "endpoint not allowed", exporters: []exporter.Exporter{operatorOTLP},
+			override: &profilepodiov1alpha1.OTLPExportSpec{Endpoint: "http://169.254.169.254/latest/meta-data"},
+			err:      "is not allowed",
+		},
+		{
+			name: "protocol only", exporters: []exporter.Exporter{pyroscope, operatorOTLP},
+			override:  &profilepodiov1alpha1.OTLPExportSpec{Protocol: profilepodiov1alpha1.OTLPProtocolHTTP},
+			pyroscope: true, endpoint: "http://otel-collector.monitoring:4317", protocol: exporter.OTLPHTTP,
+		},
+		{
+			name: "no operator exporter", exporters: []exporter.Exporter{pyroscope},
+			override:  &profilepodiov1alpha1.OTLPExportSpec{Endpoint: "http://otel-collector.team-a:4318"},
+			pyroscope: true, endpoint: "http://otel-collector.team-a:4318", protocol: exporter.OTLPGRPC,
+		},
+		{
+			name: "protocol only without operator exporter", exporters: []exporter.Exporter{pyroscope},
+			override: &profilepodiov1alpha1.OTLPExportSpec{Protocol: profilepodiov1alpha1.OTLPProtocolHTTP},
+			err:      "requires an endpoint",
+		},
+		{
+			name: "empty override without operator exporter", exporters: []exporter.Exporter{pyroscope},
+			override:  &profilepodiov1alpha1.OTLPExportSpec{},
+			pyroscope: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reconciler := &PodFlameReconciler{
+				Exporters:            test.exporters,
+				OTLPAllowedEndpoints: []string{"http://otel-collector.team-a:4318/"},
+			}
+			podflame := testPodFlame("my-app-flame", "0123456789abcdef")
+			if test.override != nil {
+				podflame.Spec.Export = &profilepodiov1alpha1.ExportSpec{OTLP: test.override}
+			}
+			exporters, err := reconciler.podflameExporters(podflame)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			var otlp *exporter.OTLP
+			foundPyroscope := false
+			for _, profileExporter := range exporters {
+				switch profileExporter := profileExporter.(type) {
+				case *exporter.OTLP:
+					otlp = profileExporter
+				case *exporter.Pyroscope:
+					foundPyroscope = true
+				}
+			}
+			if foundPyroscope != test.pyroscope {
+				t.Errorf("pyroscope exporter returned: %t, expected %t", foundPyroscope, test.pyroscope)
+			}
+			if test.endpoint == "" {
+				if otlp != nil {
+					t.Errorf("unexpected otlp exporter to %s", otlp.Endpoint)
+				}
+				return
+			}
+			if otlp == nil {
+				t.Fatalf("no otlp exporter, expected one to %s", test.endpoint)
+			}
+			if otlp.Endpoint.String() != test.endpoint || otlp.Protocol != test.protocol {
+				t.Errorf("otlp exporter to %s over %s, expected %s over %s", otlp.Endpoint, otlp.Protocol, test.endpoint, test.protocol)
+			}
+			if (otlp == operatorOTLP) != test.shared {
+				t.Errorf("otlp exporter of the operator returned: %t, expected %t", otlp == operatorOTLP, test.shared)
+			}
+			if !test.shared && len(test.exporters) > 0 && test.exporters[len(test.exporters)-1] == operatorOTLP &&
+				(otlp.Retry != retry || otlp.Timeout != time.Minute) {
+				t.Errorf("otlp exporter retries %+v within %s, expected the settings of the operator", otlp.Retry, otlp.Timeout)
+			}
+		})
+	}
+}
+
+func TestPodFlameExportersShareConnections(t *testing.T) {
+	reconciler := &PodFlameReconciler{OTLPAllowedEndpoints: []string{"http://otel-collector.team-a:4318"}}
+	exportersOf := func(name string, protocol profilepodiov1alpha1.OTLPProtocol) exporter.Exporter {
+		podflame := testPodFlame(name, "0123456789abcdef")
+		podflame.Spec.Export = &profilepodiov1alpha1.ExportSpec{OTLP: &profilepodiov1alpha1.OTLPExportSpec{
+			Endpoint: "http://otel-collector.team-a:4318", Protocol: protocol,
+		}}
+		exporters, err := reconciler.podflameExporters(podflame)
+		if err != nil || len(exporters) != 1 {
+			t.Fatalf("exporters %v, error %v", exporters, err)
+		}
+		return exporters[0]
+	}
+	first, second := exportersOf("first", ""), exportersOf("second", "")
+	if first != second {
+		t.Error("PodFlames overriding the same endpoint got different exporters")
+	}
+	if exportersOf("third", profilepodiov1alpha1.OTLPProtocolHTTP) == first {
+		t.Error("PodFlames overriding the protocol share the exporter of another protocol")
+	}
+}
+
+func TestNewExportersRejectsInvalidAllowedEndpoints(t *testing.T) {
+	if _, err := NewExporters(ExportOptions{OTLP: OTLPOptions{AllowedEndpoints: []string{"otel-collector:4317"}}}); err == nil {
+		t.Error("expected an error for an allowed endpoint without scheme")
+	}
+}
@@ -0,0 +1,106 @@
+// Package exporter pushes completed profiles to continuous profiling servers.
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/profile-pod/profile-pod-operator/controllers/stacks"
+)
+
+// Profile is the profile of a single target pushed by an exporter.
+type Profile struct {
+	// Name is the name of the profiled application
+	Name string
+	// Event is the profiled event, e.g. cpu
+	Event string
+	// Units is the unit of the sample values, samples, bytes, nanoseconds or events
+	Units  string
+	Target Target
+	Start  time.Time
+	End    time.Time
+	Stacks stacks.Stacks
+}
+
+// Target describes where a profile was taken.
+type Target struct {
+	Namespace string
+	Pod       string
+	Container string
+	// ContainerID is the id of the container in its runtime, without the runtime prefix
+	ContainerID string
+	Node        string
+	// WorkloadKind is the lower case kind of the workload controlling the pod, e.g. deployment
+	WorkloadKind string
+	Workload     string
+}
+
+// Exporter pushes profiles to a profiling server.
+type Exporter interface {
+	// Name identifies the exporter in conditions and events.
+	Name() string
+	// Export pushes profile, retrying transient failures.
+	Export(ctx context.Context, profile *Profile) error
+}
+
+// HTTPError is an unexpected response of a profiling server.
+type HTTPError struct {
+	StatusCode int
+	Message    string
+}
+
+func (err *HTTPError) Error() string {
+	if err.Message == "" {
+		return fmt.Sprintf("%d %s", err.StatusCode, http.StatusText(err.StatusCode))
+	}
+	return fmt.Sprintf("%d %s: %s", err.StatusCode, http.StatusText(err.StatusCode), err.Message)
+}
+
+// Retry is how an exporter retries a failed push.
+type Retry struct {
+	// Attempts is the number of pushes before giving up, at least one
+	Attempts int
+	// Backoff is the wait before the first retry, doubled before every following one
+	Backoff time.Duration
+}
+
+// DefaultRetry is used by exporters with no retry configured.
+var DefaultRetry = Retry{Attempts: 3, Backoff: time.Second}
+
+// do calls push until it succeeds, fails permanently or runs out of attempts.
+func (retry Retry) do(ctx context.Context, push func() error) error {
+	if retry.Attempts < 1 {
+		retry = DefaultRetry
+	}
+	backoff := retry.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = push(); err == nil || !isTransient(err) || attempt >= retry.Attempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// isTransient reports whether a push failing with err may succeed later.
+func isTransient(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= http.StatusInternalServerError
+	}
+	var grpcErr *GRPCError
+	if errors.As(err, &grpcErr) {
+		return grpcErr.isTransient()
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,177 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/profiles/v1development"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// OTLPGRPC sends profiles to the ProfilesService of the collector over gRPC
+	OTLPGRPC = "grpc"
+	// OTLPHTTP posts binary protobuf profiles to the collector
+	OTLPHTTP = "http"
+
+	otlpHTTPPath = "/v1development/profiles"
+	// otlpMessageLimit bounds the part of an error response kept in errors
+	otlpMessageLimit = 512
+)
+
+// GRPCError is a non OK status returned by a gRPC server.
+type GRPCError struct {
+	Code    codes.Code
+	Message string
+}
+
+func (err *GRPCError) Error() string {
+	return fmt.Sprintf("grpc status %d: %s", err.Code, err.Message)
+}
+
+// isTransient reports whether the status of err may change on retry, following
+// the retryable codes of the OTLP specification.
+func (err *GRPCError) isTransient() bool {
+	switch err.Code {
+	case codes.Canceled, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted,
+		codes.OutOfRange, codes.Unavailable, codes.DataLoss:
+		return true
+	}
+	return false
+}
+
+// OTLP sends profiles to an OpenTelemetry collector as the OTLP profiles signal.
+type OTLP struct {
+	// Endpoint is the URL of the collector, e.g. http://otel-collector.monitoring:4317
+	Endpoint *url.URL
+	// Protocol is the transport to the collector, grpc or http
+	Protocol string
+	Retry    Retry
+	Timeout  time.Duration
+	client   *http.Client
+	conn     *grpc.ClientConn
+	profiles collectorpb.ProfilesServiceClient
+}
+
+// NewOTLP returns an exporter sending profiles to endpoint over protocol. gRPC
+// is spoken in clear text to an http endpoint and over TLS to an https one.
+// The gRPC connection is established on the first export.
+func NewOTLP(endpoint *url.URL, protocol string, retry Retry, timeout time.Duration) (*OTLP, error) {
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("the otlp endpoint %s must be an http or https URL", endpoint)
+	}
+	otlp := &OTLP{Endpoint: endpoint, Protocol: protocol, Retry: retry, Timeout: timeout}
+	switch protocol {
+	case OTLPHTTP:
+		otlp.client = &http.Client{Timeout: timeout}
+	case OTLPGRPC:
+		transport := insecure.NewCredentials()
+		if endpoint.Scheme == "https" {
+			transport = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+		}
+		conn, err := grpc.NewClient(grpcTarget(endpoint), grpc.WithTransportCredentials(transport))
+		if err != nil {
+			return nil, fmt.Errorf("invalid otlp endpoint %s: %w", endpoint, err)
+		}
+		otlp.conn = conn
+		otlp.profiles = collectorpb.NewProfilesServiceClient(conn)
+	default:
+		return nil, fmt.Errorf("Unknown otlp protocol %s, known protocols are %s, %s", protocol, OTLPGRPC, OTLPHTTP)
+	}
+	return otlp, nil
+}
+
+// grpcTarget returns the host and port of endpoint, the port defaulting to the
+// one of its scheme.
+func grpcTarget(endpoint *url.URL) string {
+	if endpoint.Port() != "" {
+		return endpoint.Host
+	}
+	port := "80"
+	if endpoint.Scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(endpoint.Hostname(), port)
+}
+
+func (otlp *OTLP) Name() string {
+	return "otlp"
+}
+
+// Export sends profile with the Kubernetes resource attributes of its target.
+func (otlp *OTLP) Export(ctx context.Context, profile *Profile) error {
+	request := otlpRequest(profile)
+	if otlp.Protocol == OTLPGRPC {
+		return otlp.Retry.do(ctx, func() error {
+			return otlp.exportGRPC(ctx, request)
+		})
+	}
+	message, err := proto.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode the otlp profile: %w", err)
+	}
+	return otlp.Retry.do(ctx, func() error {
+		return otlp.exportHTTP(ctx, message)
+	})
+}
+
+// Close closes the connections kept to the collector.
+func (otlp *OTLP) Close() error {
+	if otlp.conn != nil {
+		return otlp.conn.Close()
+	}
+	otlp.client.CloseIdleConnections()
+	return nil
+}
+
+func (otlp *OTLP) url(path string) string {
+	endpoint := *otlp.Endpoint
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + path
+	return endpoint.String()
+}
+
+func (otlp *OTLP) exportHTTP(ctx context.Context, message []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, otlp.url(otlpHTTPPath), bytes.NewReader(message))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-protobuf")
+	response, err := otlp.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, otlpMessageLimit))
+		return &HTTPError{StatusCode: response.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	_, err = io.Copy(io.Discard, response.Body)
+	return err
+}
+
+// exportGRPC calls the Export method of the ProfilesService with request.
+func (otlp *OTLP) exportGRPC(ctx context.Context, request *collectorpb.ExportProfilesServiceRequest) error {
+	if otlp.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, otlp.Timeout)
+		defer cancel()
+	}
+	if _, err := otlp.profiles.Export(ctx, request); err != nil {
+		grpcStatus := status.Convert(err)
+		return &GRPCError{Code: grpcStatus.Code(), Message: grpcStatus.Message()}
+	}
+	return nil
+}
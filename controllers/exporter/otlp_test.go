@@ -0,0 +1,225 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/profiles/v1development"
+	profilespb "go.opentelemetry.io/proto/otlp/profiles/v1development"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// resourceAttributesOf returns the resource attributes of request.
+func resourceAttributesOf(request *collectorpb.ExportProfilesServiceRequest) map[string]string {
+	attributes := map[string]string{}
+	for _, resourceProfiles := range request.ResourceProfiles {
+		for _, attribute := range resourceProfiles.Resource.Attributes {
+			attributes[attribute.Key] = attribute.Value.GetStringValue()
+		}
+	}
+	return attributes
+}
+
+func TestOTLPRequest(t *testing.T) {
+	request := otlpRequest(otlpTestProfile())
+	if len(request.ResourceProfiles) != 1 || len(request.ResourceProfiles[0].ScopeProfiles) != 1 {
+		t.Fatalf("expected a single resource and scope, got %v", request)
+	}
+	scopeProfiles := request.ResourceProfiles[0].ScopeProfiles[0]
+	if scopeProfiles.Scope.GetName() != otlpScopeName {
+		t.Errorf("scope = %s", scopeProfiles.Scope.GetName())
+	}
+	if len(scopeProfiles.Profiles) != 1 {
+		t.Fatalf("found %d profiles, expected 1", len(scopeProfiles.Profiles))
+	}
+	profile := scopeProfiles.Profiles[0]
+	str := func(index int32) string {
+		if index < 0 || int(index) >= len(profile.StringTable) {
+			t.Fatalf("string %d out of the %d strings of the table", index, len(profile.StringTable))
+		}
+		return profile.StringTable[index]
+	}
+	if profile.StringTable[0] != "" {
+		t.Errorf("the first string of the table is %q, expected it empty", profile.StringTable[0])
+	}
+
+	if len(profile.SampleType) != 1 {
+		t.Fatalf("found %d sample types, expected 1", len(profile.SampleType))
+	}
+	sampleType := profile.SampleType[0]
+	if str(sampleType.TypeStrindex) != "cpu" || str(sampleType.UnitStrindex) != "count" ||
+		sampleType.AggregationTemporality != profilespb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA {
+		t.Errorf("sample type %s %s %s", str(sampleType.TypeStrindex), str(sampleType.UnitStrindex), sampleType.AggregationTemporality)
+	}
+	if profile.TimeNanos != time.Unix(1672531200, 0).UnixNano() || profile.DurationNanos != (30*time.Second).Nanoseconds() {
+		t.Errorf("profile spans %d for %d", profile.TimeNanos, profile.DurationNanos)
+	}
+	if len(profile.ProfileId) != 16 {
+		t.Errorf("profile id of %d bytes", len(profile.ProfileId))
+	}
+
+	samples := map[string]int64{}
+	for _, sample := range profile.Sample {
+		start, length := int(sample.LocationsStartIndex), int(sample.LocationsLength)
+		if start+length > len(profile.LocationIndices) {
+			t.Fatalf("sample locations %d+%d out of %d", start, length, len(profile.LocationIndices))
+		}
+		var frames []string
+		// Locations are listed from the leaf to the root
+		for i := start + length - 1; i >= start; i-- {
+			location := profile.LocationTable[profile.LocationIndices[i]]
+			if len(location.Line) != 1 {
+				t.Fatalf("location with %d lines", len(location.Line))
+			}
+			function := profile.FunctionTable[location.Line[0].FunctionIndex]
+			if str(function.NameStrindex) != str(function.SystemNameStrindex) {
+				t.Errorf("function %s has system name %s", str(function.NameStrindex), str(function.SystemNameStrindex))
+			}
+			frames = append(frames, str(function.NameStrindex))
+		}
+		if len(sample.Value) != 1 {
+			t.Fatalf("sample with %d values", len(sample.Value))
+		}
+		samples[strings.Join(frames, ";")] += sample.Value[0]
+	}
+	if len(samples) != 2 || samples["main;serve"] != 3 || samples["main;gc"] != 1 {
+		t.Errorf("decoded samples %v", samples)
+	}
+}
+
+func otlpTestProfile() *Profile {
+	profile := testProfile()
+	profile.Target.ContainerID = "4f1c2a"
+	profile.Target.WorkloadKind = "deployment"
+	profile.Target.Workload = "checkout"
+	return profile
+}
+
+func TestOTLPExportHTTP(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1development/profiles" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	endpoint, _ := url.Parse(server.URL)
+	otlp, err := NewOTLP(endpoint, OTLPHTTP, DefaultRetry, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := otlp.Export(context.Background(), otlpTestProfile()); err != nil {
+		t.Fatalf("export failed: %s", err)
+	}
+
+	expected := map[string]string{
+		"service.name":        "checkout",
+		"k8s.namespace.name":  "shop",
+		"k8s.pod.name":        "checkout-7d9f",
+		"k8s.container.name":  "app",
+		"container.id":        "4f1c2a",
+		"k8s.node.name":       "node-1",
+		"k8s.deployment.name": "checkout",
+	}
+	request := &collectorpb.ExportProfilesServiceRequest{}
+	if err := proto.Unmarshal(body, request); err != nil {
+		t.Fatalf("invalid ExportProfilesServiceRequest: %s", err)
+	}
+	attributes := resourceAttributesOf(request)
+	for key, value := range expected {
+		if attributes[key] != value {
+			t.Errorf("attribute %s = %q, expected %q", key, attributes[key], value)
+		}
+	}
+}
+
+// profilesService is a collector recording the requests it receives, which
+// fails the first calls with the given statuses.
+type profilesService struct {
+	collectorpb.UnimplementedProfilesServiceServer
+	failures []error
+	requests []*collectorpb.ExportProfilesServiceRequest
+}
+
+func (service *profilesService) Export(ctx context.Context, request *collectorpb.ExportProfilesServiceRequest) (*collectorpb.ExportProfilesServiceResponse, error) {
+	service.requests = append(service.requests, request)
+	if len(service.requests) <= len(service.failures) {
+		return nil, service.failures[len(service.requests)-1]
+	}
+	return &collectorpb.ExportProfilesServiceResponse{}, nil
+}
+
+// grpcCollector serves service, or no service when it is nil, on a local port
+// and returns its endpoint.
+func grpcCollector(t *testing.T, service *profilesService) *url.URL {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	if service != nil {
+		collectorpb.RegisterProfilesServiceServer(server, service)
+	}
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return &url.URL{Scheme: "http", Host: listener.Addr().String()}
+}
+
+func TestOTLPExportGRPC(t *testing.T) {
+	service := &profilesService{failures: []error{status.Error(codes.Unavailable, "collector starting")}}
+	otlp, err := NewOTLP(grpcCollector(t, service), OTLPGRPC, Retry{Attempts: 2, Backoff: time.Millisecond}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer otlp.Close()
+	if err := otlp.Export(context.Background(), otlpTestProfile()); err != nil {
+		t.Fatalf("export failed: %s", err)
+	}
+	if len(service.requests) != 2 {
+		t.Fatalf("collector received %d calls, expected 2", len(service.requests))
+	}
+	if attributes := resourceAttributesOf(service.requests[1]); attributes["k8s.pod.name"] != "checkout-7d9f" {
+		t.Errorf("k8s.pod.name = %q", attributes["k8s.pod.name"])
+	}
+}
+
+func TestOTLPExportGRPCPermanentFailure(t *testing.T) {
+	otlp, err := NewOTLP(grpcCollector(t, nil), OTLPGRPC, Retry{Attempts: 3, Backoff: time.Millisecond}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer otlp.Close()
+	err = otlp.Export(context.Background(), otlpTestProfile())
+	var grpcErr *GRPCError
+	if !errors.As(err, &grpcErr) || grpcErr.Code != codes.Unimplemented {
+		t.Fatalf("export error = %v, expected grpc status %d", err, codes.Unimplemented)
+	}
+}
+
+func TestGRPCTarget(t *testing.T) {
+	for endpoint, expected := range map[string]string{
+		"http://otel-collector.monitoring:4317": "otel-collector.monitoring:4317",
+		"http://otel-collector.monitoring":      "otel-collector.monitoring:80",
+		"https://otel-collector.monitoring":     "otel-collector.monitoring:443",
+		"https://[::1]":                         "[::1]:443",
+	} {
+		parsed, _ := url.Parse(endpoint)
+		if target := grpcTarget(parsed); target != expected {
+			t.Errorf("grpcTarget(%s) = %s, expected %s", endpoint, target, expected)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package exporter
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"strings"
+
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/profiles/v1development"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	profilespb "go.opentelemetry.io/proto/otlp/profiles/v1development"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+// Kubernetes resource attributes of the OpenTelemetry semantic conventions.
+const (
+	AttributeNamespace   = "k8s.namespace.name"
+	AttributePod         = "k8s.pod.name"
+	AttributeContainer   = "k8s.container.name"
+	AttributeContainerID = "container.id"
+	AttributeNode        = "k8s.node.name"
+	AttributeServiceName = "service.name"
+
+	// otlpScopeName is the instrumentation scope of the exported profiles
+	otlpScopeName = "github.com/profile-pod/profile-pod-operator"
+)
+
+// otlpBuilder interns the strings and functions of an OTLP profile. A frame is
+// a function and a location sharing the same index.
+type otlpBuilder struct {
+	profile   *profilespb.Profile
+	stringIDs map[string]int32
+	ids       map[string]int32
+}
+
+func (builder *otlpBuilder) stringID(s string) int32 {
+	id, found := builder.stringIDs[s]
+	if !found {
+		id = int32(len(builder.profile.StringTable))
+		builder.profile.StringTable = append(builder.profile.StringTable, s)
+		builder.stringIDs[s] = id
+	}
+	return id
+}
+
+func (builder *otlpBuilder) frame(name string) int32 {
+	id, found := builder.ids[name]
+	if !found {
+		id = int32(len(builder.profile.FunctionTable))
+		nameID := builder.stringID(name)
+		builder.profile.FunctionTable = append(builder.profile.FunctionTable, &profilespb.Function{
+			NameStrindex:       nameID,
+			SystemNameStrindex: nameID,
+		})
+		builder.profile.LocationTable = append(builder.profile.LocationTable, &profilespb.Location{
+			Line: []*profilespb.Line{{FunctionIndex: id}},
+		})
+		builder.ids[name] = id
+	}
+	return id
+}
+
+// otlpRequest returns profile as an ExportProfilesServiceRequest, with the
+// Kubernetes resource attributes of its target.
+func otlpRequest(profile *Profile) *collectorpb.ExportProfilesServiceRequest {
+	return &collectorpb.ExportProfilesServiceRequest{
+		ResourceProfiles: []*profilespb.ResourceProfiles{{
+			Resource: otlpResource(otlpAttributes(profile)),
+			ScopeProfiles: []*profilespb.ScopeProfiles{{
+				Scope:    &commonpb.InstrumentationScope{Name: otlpScopeName},
+				Profiles: []*profilespb.Profile{otlpProfile(profile)},
+			}},
+		}},
+	}
+}
+
+// otlpAttributes returns the resource attributes of profile.
+func otlpAttributes(profile *Profile) map[string]string {
+	target := profile.Target
+	attributes := map[string]string{
+		AttributeServiceName: profile.Name,
+		AttributeNamespace:   target.Namespace,
+		AttributePod:         target.Pod,
+		AttributeContainer:   target.Container,
+		AttributeContainerID: target.ContainerID,
+		AttributeNode:        target.Node,
+	}
+	if target.WorkloadKind != "" {
+		// e.g. k8s.deployment.name
+		attributes[fmt.Sprintf("k8s.%s.name", target.WorkloadKind)] = target.Workload
+	}
+	return attributes
+}
+
+func otlpResource(attributes map[string]string) *resourcepb.Resource {
+	keys := make([]string, 0, len(attributes))
+	for key, value := range attributes {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	resource := &resourcepb.Resource{}
+	for _, key := range keys {
+		resource.Attributes = append(resource.Attributes, &commonpb.KeyValue{
+			Key:   key,
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: attributes[key]}},
+		})
+	}
+	return resource
+}
+
+// otlpProfile returns the stacks of profile as an OTLP Profile whose samples
+// hold a single value of the profiled event.
+func otlpProfile(profile *Profile) *profilespb.Profile {
+	builder := &otlpBuilder{
+		profile:   &profilespb.Profile{StringTable: []string{""}},
+		stringIDs: map[string]int32{"": 0},
+		ids:       map[string]int32{},
+	}
+	encoded := builder.profile
+	encoded.SampleType = []*profilespb.ValueType{{
+		TypeStrindex:           builder.stringID(profile.Event),
+		UnitStrindex:           builder.stringID(pprofUnit(profile.Units)),
+		AggregationTemporality: profilespb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+	}}
+
+	keys := make([]string, 0, len(profile.Stacks))
+	for stack := range profile.Stacks {
+		keys = append(keys, stack)
+	}
+	sort.Strings(keys)
+	for _, stack := range keys {
+		frames := strings.Split(stack, ";")
+		sample := &profilespb.Sample{
+			LocationsStartIndex: int32(len(encoded.LocationIndices)),
+			LocationsLength:     int32(len(frames)),
+			Value:               []int64{profile.Stacks[stack]},
+		}
+		// The locations of a sample are listed from the leaf to the root
+		for i := len(frames) - 1; i >= 0; i-- {
+			encoded.LocationIndices = append(encoded.LocationIndices, builder.frame(frames[i]))
+		}
+		encoded.Sample = append(encoded.Sample, sample)
+	}
+
+	encoded.TimeNanos = profile.Start.UnixNano()
+	if profile.End.After(profile.Start) {
+		encoded.DurationNanos = profile.End.Sub(profile.Start).Nanoseconds()
+	}
+	profileID := make([]byte, 16)
+	if _, err := rand.Read(profileID); err == nil {
+		encoded.ProfileId = profileID
+	}
+	return encoded
+}
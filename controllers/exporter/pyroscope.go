@@ -0,0 +1,169 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Labels of the profiles pushed to Pyroscope
+	PyroscopeLabelNamespace    = "namespace"
+	PyroscopeLabelPod          = "pod"
+	PyroscopeLabelContainer    = "container"
+	PyroscopeLabelNode         = "node"
+	PyroscopeLabelWorkload     = "workload"
+	PyroscopeLabelWorkloadKind = "workload_kind"
+
+	// PyroscopeFolded pushes the collapsed stacks of a profile
+	PyroscopeFolded = "folded"
+	// PyroscopePprof pushes a profile as a protobuf pprof profile
+	PyroscopePprof = "pprof"
+
+	pyroscopeIngestPath = "/ingest"
+	pyroscopeSpyName    = "profilepod"
+	// pyroscopeMessageLimit bounds the part of an error response kept in errors
+	pyroscopeMessageLimit = 512
+)
+
+var (
+	pyroscopeNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.\-]`)
+	// pyroscopeValueChars are the characters that end a label value in the application name
+	pyroscopeValueChars = regexp.MustCompile(`[{},=\s]`)
+)
+
+// Pyroscope pushes profiles to the /ingest endpoint of a Pyroscope-compatible server.
+type Pyroscope struct {
+	// URL is the base URL of the server, e.g. http://pyroscope.monitoring:4040
+	URL *url.URL
+	// Format is the format of the pushed profiles, folded or pprof
+	Format     string
+	Retry      Retry
+	HTTPClient *http.Client
+}
+
+func (pyroscope *Pyroscope) Name() string {
+	return "pyroscope"
+}
+
+// Export pushes profile, labelled with its target, as the application
+// <profile name>.<event>.
+func (pyroscope *Pyroscope) Export(ctx context.Context, profile *Profile) error {
+	var body bytes.Buffer
+	contentType := "text/plain"
+	switch pyroscope.Format {
+	case "", PyroscopeFolded:
+		// The folded format of Pyroscope shares the syntax of collapsed stacks
+		if _, err := profile.Stacks.WriteTo(&body); err != nil {
+			return err
+		}
+	case PyroscopePprof:
+		contentType = "application/octet-stream"
+		body.Write(profile.Stacks.MarshalPprof(profile.Event, pprofUnit(profile.Units)))
+	default:
+		return fmt.Errorf("unknown pyroscope format %s", pyroscope.Format)
+	}
+	ingestURL := pyroscope.ingestURL(profile)
+	return pyroscope.Retry.do(ctx, func() error {
+		return pyroscope.push(ctx, ingestURL, contentType, body.Bytes())
+	})
+}
+
+// ingestURL returns the URL profile is pushed to.
+func (pyroscope *Pyroscope) ingestURL(profile *Profile) string {
+	query := url.Values{}
+	query.Set("name", pyroscopeName(profile))
+	query.Set("from", strconv.FormatInt(profile.Start.Unix(), 10))
+	query.Set("until", strconv.FormatInt(profile.End.Unix(), 10))
+	query.Set("format", pyroscope.Format)
+	if pyroscope.Format == "" {
+		query.Set("format", PyroscopeFolded)
+	}
+	query.Set("spyName", pyroscopeSpyName)
+	query.Set("units", pyroscopeUnits(profile.Units))
+	query.Set("aggregationType", "sum")
+	ingestURL := *pyroscope.URL
+	ingestURL.Path = strings.TrimSuffix(ingestURL.Path, "/") + pyroscopeIngestPath
+	ingestURL.RawQuery = query.Encode()
+	return ingestURL.String()
+}
+
+func (pyroscope *Pyroscope) push(ctx context.Context, ingestURL, contentType string, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, ingestURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	client := pyroscope.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, pyroscopeMessageLimit))
+		return &HTTPError{StatusCode: response.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	_, err = io.Copy(io.Discard, response.Body)
+	return err
+}
+
+// pyroscopeName returns the application name of profile with its labels, e.g.
+// checkout.cpu{namespace=shop,pod=checkout-7d9f}.
+func pyroscopeName(profile *Profile) string {
+	name := pyroscopeNameChars.ReplaceAllString(profile.Name+"."+profile.Event, "_")
+	target := profile.Target
+	values := map[string]string{
+		PyroscopeLabelNamespace:    target.Namespace,
+		PyroscopeLabelPod:          target.Pod,
+		PyroscopeLabelContainer:    target.Container,
+		PyroscopeLabelNode:         target.Node,
+		PyroscopeLabelWorkload:     target.Workload,
+		PyroscopeLabelWorkloadKind: target.WorkloadKind,
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	labels := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := values[key]
+		if value == "" {
+			continue
+		}
+		labels = append(labels, key+"="+pyroscopeValueChars.ReplaceAllString(value, "_"))
+	}
+	return name + "{" + strings.Join(labels, ",") + "}"
+}
+
+// pyroscopeUnits returns the Pyroscope unit of sample values expressed in units.
+// Pyroscope has no plain duration unit, lock_nanoseconds is displayed as durations.
+func pyroscopeUnits(units string) string {
+	switch units {
+	case "bytes":
+		return "bytes"
+	case "nanoseconds":
+		return "lock_nanoseconds"
+	}
+	return "samples"
+}
+
+// pprofUnit returns the pprof unit of sample values expressed in units.
+func pprofUnit(units string) string {
+	switch units {
+	case "bytes", "nanoseconds":
+		return units
+	}
+	return "count"
+}
@@ -0,0 +1,110 @@
+package exporter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/profile-pod/profile-pod-operator/controllers/stacks"
+)
+
+func testProfile() *Profile {
+	return &Profile{
+		Name:  "checkout",
+		Event: "cpu",
+		Units: "samples",
+		Target: Target{
+			Namespace: "shop",
+			Pod:       "checkout-7d9f",
+			Container: "app",
+			Node:      "node-1",
+		},
+		Start:  time.Unix(1672531200, 0),
+		End:    time.Unix(1672531230, 0),
+		Stacks: stacks.Stacks{"main;serve": 3, "main;gc": 1},
+	}
+}
+
+func TestPyroscopeExportFolded(t *testing.T) {
+	var query url.Values
+	var body, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/ingest" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		query = r.URL.Query()
+		contentType = r.Header.Get("Content-Type")
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer server.Close()
+
+	endpoint, _ := url.Parse(server.URL)
+	pyroscope := &Pyroscope{URL: endpoint, Format: PyroscopeFolded}
+	if err := pyroscope.Export(context.Background(), testProfile()); err != nil {
+		t.Fatalf("export failed: %s", err)
+	}
+
+	expected := map[string]string{
+		"name":            "checkout.cpu{container=app,namespace=shop,node=node-1,pod=checkout-7d9f}",
+		"from":            "1672531200",
+		"until":           "1672531230",
+		"format":          "folded",
+		"units":           "samples",
+		"aggregationType": "sum",
+	}
+	for key, value := range expected {
+		if query.Get(key) != value {
+			t.Errorf("query %s = %q, expected %q", key, query.Get(key), value)
+		}
+	}
+	if contentType != "text/plain" {
+		t.Errorf("content type = %q, expected text/plain", contentType)
+	}
+	if body != "main;gc 1\nmain;serve 3\n" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestPyroscopeExportRetries(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			http.Error(w, "ingester unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	endpoint, _ := url.Parse(server.URL)
+	pyroscope := &Pyroscope{URL: endpoint, Retry: Retry{Attempts: 3, Backoff: time.Millisecond}}
+	if err := pyroscope.Export(context.Background(), testProfile()); err != nil {
+		t.Fatalf("export failed: %s", err)
+	}
+	if requests != 3 {
+		t.Errorf("server received %d requests, expected 3", requests)
+	}
+}
+
+func TestPyroscopeExportPermanentFailure(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "invalid name", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	endpoint, _ := url.Parse(server.URL)
+	pyroscope := &Pyroscope{URL: endpoint, Retry: Retry{Attempts: 3, Backoff: time.Millisecond}}
+	err := pyroscope.Export(context.Background(), testProfile())
+	if err == nil || err.Error() != "400 Bad Request: invalid name" {
+		t.Fatalf("export error = %v, expected 400 Bad Request: invalid name", err)
+	}
+	if requests != 1 {
+		t.Errorf("server received %d requests, expected a single one", requests)
+	}
+}
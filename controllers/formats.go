@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+
+	agentv1 "github.com/profile-pod/profile-pod-operator/api/agent/v1"
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"github.com/profile-pod/profile-pod-operator/controllers/stacks"
+	"github.com/profile-pod/profile-pod-operator/controllers/timeline"
+)
+
+// formatContentTypes are the media types of the results of every format.
+var formatContentTypes = map[profilepodiov1alpha1.OutputFormat]string{
+	profilepodiov1alpha1.FormatHTML:        "text/html; charset=utf-8",
+	profilepodiov1alpha1.FormatSVG:         "image/svg+xml",
+	profilepodiov1alpha1.FormatCollapsed:   "text/plain; charset=utf-8",
+	profilepodiov1alpha1.FormatPprof:       "application/vnd.google.protobuf",
+	profilepodiov1alpha1.FormatSpeedscope:  "application/json",
+	profilepodiov1alpha1.FormatChromeTrace: "application/json",
+}
+
+func formatContentType(format profilepodiov1alpha1.OutputFormat) string {
+	return formatContentTypes[format]
+}
+
+// requestedFormats returns the formats of the results of podflame.
+func requestedFormats(podflame *profilepodiov1alpha1.PodFlame) []profilepodiov1alpha1.OutputFormat {
+	if len(podflame.Spec.Formats) == 0 {
+		return []profilepodiov1alpha1.OutputFormat{profilepodiov1alpha1.FormatHTML}
+	}
+	return podflame.Spec.Formats
+}
+
+// targetFormats returns the formats of the results stored for every target of
+// podflame, which include the collapsed stacks merged by aggregation and by the
+// rolling aggregation of continuous windows.
+func targetFormats(podflame *profilepodiov1alpha1.PodFlame) []profilepodiov1alpha1.OutputFormat {
+	formats := requestedFormats(podflame)
+	merged := podflame.Spec.Aggregate != nil || (isContinuous(podflame) && podflame.Spec.Continuous.RollingAggregate)
+	if !merged || hasFormat(formats, profilepodiov1alpha1.FormatCollapsed) {
+		return formats
+	}
+	return append(append([]profilepodiov1alpha1.OutputFormat(nil), formats...), profilepodiov1alpha1.FormatCollapsed)
+}
+
+// agentFormats returns the formats the agents of podflame should produce. The
+// agent produces html, collapsed stacks and timestamped samples, the timeline
+// formats are converted from the samples and every other format from the
+// collapsed stacks by the operator.
+func agentFormats(podflame *profilepodiov1alpha1.PodFlame) []string {
+	var formats []string
+	targetFormats := targetFormats(podflame)
+	if hasFormat(targetFormats, profilepodiov1alpha1.FormatHTML) {
+		formats = append(formats, agentv1.FormatHTML)
+	}
+	collapsed, samples := false, false
+	for _, format := range targetFormats {
+		switch {
+		case isTimelineFormat(format):
+			samples = true
+		case format != profilepodiov1alpha1.FormatHTML:
+			collapsed = true
+		}
+	}
+	if collapsed {
+		formats = append(formats, agentv1.FormatCollapsed)
+	}
+	if samples {
+		formats = append(formats, agentv1.FormatSamples)
+	}
+	return formats
+}
+
+// isTimelineFormat returns whether format keeps the time order of the samples,
+// which is lost by merging stacks.
+func isTimelineFormat(format profilepodiov1alpha1.OutputFormat) bool {
+	return format == profilepodiov1alpha1.FormatSpeedscope || format == profilepodiov1alpha1.FormatChromeTrace
+}
+
+func hasFormat(formats []profilepodiov1alpha1.OutputFormat, format profilepodiov1alpha1.OutputFormat) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// findResult returns the result of format among results, or nil.
+func findResult(results []profilepodiov1alpha1.ResultReference, format profilepodiov1alpha1.OutputFormat) *profilepodiov1alpha1.ResultReference {
+	for i := range results {
+		if results[i].Format == format {
+			return &results[i]
+		}
+	}
+	return nil
+}
+
+// renderStacks converts collapsed stacks of podflame to format and gzips them.
+func renderStacks(podflame *profilepodiov1alpha1.PodFlame, collapsed stacks.Stacks, format profilepodiov1alpha1.OutputFormat, title string) ([]byte, error) {
+	units := eventUnits(podflame.Spec.Event)
+	var buffer bytes.Buffer
+	var err error
+	switch format {
+	case profilepodiov1alpha1.FormatCollapsed:
+		_, err = collapsed.WriteTo(&buffer)
+	case profilepodiov1alpha1.FormatSVG:
+		err = collapsed.WriteSVG(&buffer, title, units)
+	case profilepodiov1alpha1.FormatHTML:
+		err = collapsed.WriteHTML(&buffer, title, units)
+	case profilepodiov1alpha1.FormatPprof:
+		buffer.Write(collapsed.MarshalPprof(podflame.Spec.Event, pprofUnit(units)))
+	default:
+		return nil, fmt.Errorf("Unsupported output format %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stacks.Compress(buffer.Bytes())
+}
+
+// renderTimeline converts timestamped samples of podflame to format and gzips them.
+func renderTimeline(podflame *profilepodiov1alpha1.PodFlame, samples []timeline.Sample, format profilepodiov1alpha1.OutputFormat, title string) ([]byte, error) {
+	var buffer bytes.Buffer
+	var err error
+	switch format {
+	case profilepodiov1alpha1.FormatSpeedscope:
+		err = timeline.WriteSpeedscope(&buffer, samples, title, speedscopeUnit(eventUnits(podflame.Spec.Event)))
+	case profilepodiov1alpha1.FormatChromeTrace:
+		err = timeline.WriteChromeTrace(&buffer, samples, title)
+	default:
+		return nil, fmt.Errorf("Unsupported timeline format %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stacks.Compress(buffer.Bytes())
+}
+
+// speedscopeUnit returns the speedscope unit of sample values expressed in units.
+func speedscopeUnit(units string) string {
+	switch units {
+	case UnitsBytes, UnitsNanoseconds:
+		return units
+	}
+	return "none"
+}
+
+// pprofUnit returns the pprof unit of sample values expressed in units.
+func pprofUnit(units string) string {
+	switch units {
+	case UnitsBytes, UnitsNanoseconds:
+		return units
+	}
+	return "count"
+}
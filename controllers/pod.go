@@ -1,18 +1,26 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"regexp"
+	"time"
 
+	agentv1 "github.com/profile-pod/profile-pod-operator/api/agent/v1"
 	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
 	"github.com/profile-pod/profile-pod-operator/controllers/constants"
+	"github.com/profile-pod/profile-pod-operator/controllers/stacks"
+	"github.com/profile-pod/profile-pod-operator/controllers/timeline"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -26,39 +34,48 @@ const (
 	containerdRuntime     = "containerd"
 	DockerRuntimePath     = "/var/lib/docker"
 	containerdRuntimePath = "/run/containerd"
+	agentCommand          = "/app/agent"
 )
 
-func (reconciler *PodFlameReconciler) definePod(podflame *profilepodiov1alpha1.PodFlame, namespace, podName string, ctx context.Context) (*corev1.Pod, error) {
+// definePod returns the agent pod profiling target and the ConfigMap holding its config.
+func (reconciler *PodFlameReconciler) definePod(podflame *profilepodiov1alpha1.PodFlame, target *profilepodiov1alpha1.TargetStatus, namespace string, ctx context.Context) (*corev1.Pod, *corev1.ConfigMap, error) {
 	var volumeName = "runtime-path"
-	targetPod, err := GetTargetPod(reconciler.Clientset, podflame.Spec.TargetPod, podflame.Namespace, ctx)
+	targetPod, err := GetTargetPod(reconciler.Clientset, target.PodName, podflame.Namespace, ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	targetContainerName, err := getContainerName(targetPod, podflame)
+	targetContainerName, err := getContainerName(targetPod, podflame, reconciler.SidecarContainers)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	runtime, targetContainerId, err := GetContainerDetailes(targetContainerName, targetPod)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	hostpath, err := GetContainerRuntimePath(runtime)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	args := []string{
-		string(targetPod.UID), targetContainerName, targetContainerId, runtime,
-		podflame.Spec.Duration, podflame.Spec.Event,
+	configMap, err := defineAgentConfig(podflame, target.AgentPod, namespace, agentv1.Target{
+		PodUID:        string(targetPod.UID),
+		ContainerName: targetContainerName,
+		ContainerID:   targetContainerId,
+		Runtime:       runtime,
+		RuntimePath:   agentRuntimePath,
+	}, reconciler.withExportFormats(podflame, agentFormats(podflame)))
+	if err != nil {
+		return nil, nil, err
 	}
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      podName,
+			Name:      target.AgentPod,
 			Namespace: namespace,
 			Labels:    labelsForPodfalme(podflame),
 			Annotations: map[string]string{
 				"sidecar.istio.io/inject":     "false",
 				constants.AnnotationName:      podflame.Name,
 				constants.AnnotationNamespace: podflame.Namespace,
+				constants.AnnotationContainer: targetContainerName,
 			},
 		},
 		Spec: corev1.PodSpec{
@@ -74,18 +91,31 @@ func (reconciler *PodFlameReconciler) definePod(podflame *profilepodiov1alpha1.P
 						},
 					},
 				},
+				{
+					Name: agentConfigVolume,
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: configMap.Name},
+						},
+					},
+				},
 			},
 			Containers: []corev1.Container{
 				{
 					ImagePullPolicy: corev1.PullIfNotPresent,
 					Name:            ContainerName,
 					Image:           GetAgentImage(),
-					Command:         []string{"/app/agent"},
-					Args:            args,
+					Command:         []string{agentCommand},
+					Args:            []string{agentv1.ConfigFlag, path.Join(agentConfigDir, agentv1.ConfigFileName)},
 					VolumeMounts: []corev1.VolumeMount{
 						{
 							Name:      volumeName,
-							MountPath: "/runtimepath",
+							MountPath: agentRuntimePath,
+						},
+						{
+							Name:      agentConfigVolume,
+							MountPath: agentConfigDir,
+							ReadOnly:  true,
 						},
 					},
 					SecurityContext: &corev1.SecurityContext{
@@ -97,7 +127,10 @@ func (reconciler *PodFlameReconciler) definePod(podflame *profilepodiov1alpha1.P
 			},
 		},
 	}
-	return pod, nil
+	volumes, volumeMounts := eventVolumes(podflame.Spec.Event)
+	pod.Spec.Volumes = append(pod.Spec.Volumes, volumes...)
+	pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, volumeMounts...)
+	return pod, configMap, nil
 }
 
 func GetAgentImage() string {
@@ -109,102 +142,449 @@ func GetAgentImage() string {
 }
 
 func (reconciler *PodFlameReconciler) reconcilePod(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	if podflame.Status.Phase == "" || podflame.Status.Phase == profilepodiov1alpha1.PodFlamePending {
+		if meta.FindStatusCondition(podflame.Status.Conditions, ConditionScheduled) == nil {
+			startPending(podflame)
+		}
+		// A rerun annotation set before the run started does not start another one
+		podflame.Status.RerunNonce = podflame.Annotations[constants.AnnotationRerun]
+		if cancelRequested(podflame) {
+			recordCancel(podflame)
+			finish(podflame, profilepodiov1alpha1.PodFlameCancelled, ReasonCancelled, "Cancelled before profiling started")
+			if err := reconciler.updateStatus(ctx, podflame); err != nil {
+				log.Error(err, "Failed to update podflame status")
+				return ctrl.Result{}, err
+			}
+			reconciler.Recorder.Event(podflame, "Normal", ReasonCancelled, "Profiling cancelled before it started")
+			return ctrl.Result{}, nil
+		}
+		if specErr := validateSpec(&podflame.Spec); specErr != nil {
+			finish(podflame, profilepodiov1alpha1.PodFlameFailed, ReasonInvalidSpec, specErr.Error())
+			if err := reconciler.updateStatus(ctx, podflame); err != nil {
+				log.Error(err, "Failed to update podflame status")
+				return ctrl.Result{}, err
+			}
+			reconciler.Recorder.Event(podflame, "Warning", ReasonInvalidSpec,
+				fmt.Sprintf("Invalid spec: %s", specErr))
+			return ctrl.Result{}, nil
+		}
+		targetPods, err := reconciler.resolveTargetPods(ctx, podflame)
+		if err != nil {
+			log.Info("Failed to resolve target pods. Re-running reconcile.")
+			podflame.Status.Phase = profilepodiov1alpha1.PodFlamePending
+			setCondition(podflame, ConditionScheduled, metav1.ConditionFalse, ReasonTargetNotFound, err.Error())
+			if updateErr := reconciler.updateStatus(ctx, podflame); updateErr != nil {
+				log.Error(updateErr, "Failed to update podflame status")
+			}
+			return ctrl.Result{}, err
+		}
+		for _, targetPod := range targetPods {
+			target := profilepodiov1alpha1.TargetStatus{
+				PodName:  targetPod.Name,
+				NodeName: targetPod.Spec.NodeName,
+				AgentPod: agentPodName(podflame, targetPod.Name),
+				Phase:    profilepodiov1alpha1.PodFlamePending,
+			}
+			if isContinuous(podflame) {
+				target.AgentPod = windowAgentPodName(podflame, &target)
+			}
+			podflame.Status.Targets = append(podflame.Status.Targets, target)
+		}
+		if len(podflame.Status.Targets) == 1 {
+			podflame.Status.AgentPod = podflame.Status.Targets[0].AgentPod
+		}
+		now := metav1.Now()
+		podflame.Status.StartTime = &now
+		podflame.Status.Phase = profilepodiov1alpha1.PodFlameScheduling
+		podflame.Status.Event = podflame.Spec.Event
+		podflame.Status.Units = eventUnits(podflame.Spec.Event)
+		setCondition(podflame, ConditionScheduled, metav1.ConditionTrue, ReasonAgentsCreated,
+			fmt.Sprintf("Profiling %d target pods", len(podflame.Status.Targets)))
+		if err = reconciler.updateStatus(ctx, podflame); err != nil {
+			log.Error(err, "Failed to update podflame status")
+			return ctrl.Result{}, err
+		}
+	}
+
+	var errs []error
+	var finishedAgents []string
+	statusChanged, windowCompleted := false, false
+	for i := range podflame.Status.Targets {
+		target := &podflame.Status.Targets[i]
+		wasFinished, agentPod, window := targetFinished(target), target.AgentPod, target.Window
+		cancelled := false
+		if cancelRequested(podflame) {
+			recordCancel(podflame)
+			var err error
+			if cancelled, err = reconciler.cancelTarget(ctx, podflame, target); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		changed, err := reconciler.reconcileAgentPod(ctx, podflame, target)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		changed = changed || cancelled
+		if target.Window != window {
+			// The agent pod of a completed window is not reused by the next one
+			windowCompleted = true
+			finishedAgents = append(finishedAgents, agentPod)
+		} else if !wasFinished && targetFinished(target) {
+			finishedAgents = append(finishedAgents, agentPod)
+		}
+		statusChanged = statusChanged || changed
+	}
+	if statusChanged {
+		updatePhase(podflame)
+		if isContinuous(podflame) && len(podflame.Status.Targets) == 1 {
+			podflame.Status.AgentPod = podflame.Status.Targets[0].AgentPod
+		}
+		if isFinished(podflame) || windowCompleted {
+			summarizeTargets(podflame)
+			if podflame.Spec.Aggregate != nil {
+				if err := reconciler.aggregateTargets(ctx, podflame); err != nil {
+					log.Error(err, "Failed to aggregate profiles")
+					reconciler.Recorder.Event(podflame, "Warning", "AggregationFailed",
+						fmt.Sprintf("Failed to aggregate profiles: %s", err))
+				}
+			}
+		}
+		if err := reconciler.updateStatus(ctx, podflame); err != nil {
+			log.Error(err, "Failed to update podflame status")
+			reconciler.ExportQueue.discard(podflame)
+			return ctrl.Result{}, err
+		}
+		reconciler.ExportQueue.commit(podflame)
+		for _, agentPod := range finishedAgents {
+			if err := reconciler.deleteAgentPod(ctx, agentPod); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return earliestResult(nextWindowResult(podflame), agentStartResult(podflame)), utilerrors.NewAggregate(errs)
+}
+
+// reconcileAgentPod drives the agent pod profiling a single target and reports
+// whether the status of the target changed.
+func (reconciler *PodFlameReconciler) reconcileAgentPod(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, target *profilepodiov1alpha1.TargetStatus) (bool, error) {
 	var namespace = reconciler.OperatorNamesapce
-	var podName = podflame.Namespace + "-" + podflame.Name
+	var podName = target.AgentPod
 	log := log.FromContext(ctx)
 	var pod = &corev1.Pod{}
 	err := reconciler.Get(ctx, types.NamespacedName{Name: podName, Namespace: namespace}, pod)
 	if err != nil {
-		if apierrors.IsNotFound(err) {
-			if podflame.Status.Failed == "" && podflame.Status.FlameGraph == "" {
-				log.Info("Pod resource " + podName + " not found. Creating or re-creating pod")
-				podDefinition, err := reconciler.definePod(podflame, namespace, podName, ctx)
-				if err != nil {
-					log.Info("Failed to create Pod definition. Re-running reconcile.")
-					return ctrl.Result{}, err
-				}
-				err = reconciler.Create(ctx, podDefinition)
-				if err != nil {
-					log.Info("Failed to create Pod resource. Re-running reconcile.")
-					return ctrl.Result{}, err
-				}
-			}
-		} else {
+		if !apierrors.IsNotFound(err) {
 			log.Info("Failed to get Pod resource " + podName + ". Re-running reconcile.")
-			return ctrl.Result{}, err
+			return false, err
 		}
-	} else {
-		if podflame.Status.Failed != "" || podflame.Status.FlameGraph != "" {
-			log.Info("Pod resource " + podName + " found after profile finished. deleting Pod")
-			err = reconciler.Clientset.CoreV1().Pods(namespace).Delete(ctx, podName, metav1.DeleteOptions{})
-			if err != nil {
-				log.Info("Failed to delete pod resource. Re-running reconcile.")
-				return ctrl.Result{}, err
+		if targetFinished(target) || isFinished(podflame) {
+			return false, nil
+		}
+		if len(target.Windows) > 0 {
+			if waitingForWindow(target) {
+				return false, nil
 			}
-		} else {
-			switch pod.Status.Phase {
-			case corev1.PodFailed:
-				logs, err := getPodLogs(reconciler.Clientset, namespace, pod.Name)
-				if err != nil {
-					log.Info("Failed to get logs from failed profile pod. Re-running reconcile.")
-					return ctrl.Result{}, err
-				}
-				podflame.Status.Failed = logs
-				if err = reconciler.Status().Update(ctx, podflame); err != nil {
-					log.Error(err, "Failed to update podflame status")
-					return ctrl.Result{}, err
-				}
-				log.Info(fmt.Sprintf("Profiler pod %s failed: %s", podName, logs))
-				reconciler.Recorder.Event(podflame, "Warning", "Failed",
-					fmt.Sprintf("Profiler failed: %s",
-						logs))
-			case corev1.PodSucceeded:
-				log.Info(fmt.Sprintf("Profiler pod %s finished successfully", podName))
-				logs, err := getPodLogs(reconciler.Clientset, namespace, pod.Name)
-				if err != nil {
-					log.Info("Failed to get logs from succeeded profile pod. Re-running reconcile.")
-					return ctrl.Result{}, err
+			if ended, err := reconciler.targetEnded(ctx, podflame, target); ended || err != nil {
+				return ended, err
+			}
+		}
+		log.Info("Pod resource " + podName + " not found. Creating or re-creating pod")
+		podDefinition, configMap, err := reconciler.definePod(podflame, target, namespace, ctx)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				failTarget(target, ReasonTargetNotFound, fmt.Sprintf("Target pod %s not found", target.PodName))
+				reconciler.Recorder.Event(podflame, "Warning", target.Reason, target.Message)
+				return true, nil
+			}
+			log.Info("Failed to create Pod definition. Re-running reconcile.")
+			return false, err
+		}
+		if err = reconciler.applyAgentConfig(ctx, configMap); err != nil {
+			log.Info("Failed to create agent config. Re-running reconcile.")
+			return false, err
+		}
+		err = reconciler.Create(ctx, podDefinition)
+		if err != nil {
+			log.Info("Failed to create Pod resource. Re-running reconcile.")
+			return false, err
+		}
+		return setTargetPhase(target, schedulingPhase(target)), nil
+	}
+
+	if targetFinished(target) || isFinished(podflame) {
+		log.Info("Pod resource " + podName + " found after profile finished. deleting Pod")
+		return false, reconciler.deleteAgentPod(ctx, podName)
+	}
+
+	target.ContainerName = pod.Annotations[constants.AnnotationContainer]
+
+	switch pod.Status.Phase {
+	case corev1.PodFailed, corev1.PodSucceeded:
+		if isContinuous(podflame) {
+			return reconciler.collectWindow(ctx, podflame, target, pod)
+		}
+		return reconciler.collectAgentResult(ctx, podflame, target, pod)
+	case corev1.PodRunning:
+		log.Info(fmt.Sprintf("Profiler pod %s is running", podName))
+		changed := setTargetPhase(target, profilepodiov1alpha1.PodFlameRunning)
+		// The agent contract is checked as soon as the agent started, rather
+		// than once it profiled
+		acknowledged, err := reconciler.checkAgentVersion(ctx, target, pod)
+		if err != nil {
+			log.Info("Failed to read the agent logs. Re-running reconcile.")
+			return changed, err
+		}
+		if targetFinished(target) {
+			reconciler.Recorder.Event(podflame, "Warning", target.Reason, target.Message)
+			return true, nil
+		}
+		reconciler.Recorder.Event(podflame, "Normal", "Running",
+			fmt.Sprintf("Profiler for %s is running", target.PodName))
+		return changed || acknowledged, nil
+	default:
+		log.Info(fmt.Sprintf("Profiler %s initializing", podName))
+		reconciler.Recorder.Event(podflame, "Normal", "Running",
+			fmt.Sprintf("Profiler %s initializing", podName))
+		return setTargetPhase(target, schedulingPhase(target)), nil
+	}
+}
+
+// setTargetPhase sets the phase of target and reports whether it changed.
+func setTargetPhase(target *profilepodiov1alpha1.TargetStatus, phase profilepodiov1alpha1.PodFlamePhase) bool {
+	changed := target.Phase != phase
+	target.Phase = phase
+	return changed
+}
+
+func failTarget(target *profilepodiov1alpha1.TargetStatus, reason, message string) {
+	target.Phase = profilepodiov1alpha1.PodFlameFailed
+	target.Results = nil
+	target.Reason = reason
+	target.Message = message
+}
+
+// summarizeTargets copies the result reference of a single target to the top
+// level status once profiling finished.
+func summarizeTargets(podflame *profilepodiov1alpha1.PodFlame) {
+	if len(podflame.Status.Targets) == 1 {
+		podflame.Status.Results = append([]profilepodiov1alpha1.ResultReference(nil), podflame.Status.Targets[0].Results...)
+	}
+}
+
+// deleteAgentPod deletes the agent pod called podName and its config.
+func (reconciler *PodFlameReconciler) deleteAgentPod(ctx context.Context, podName string) error {
+	err := reconciler.Clientset.CoreV1().Pods(reconciler.OperatorNamesapce).Delete(ctx, podName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.FromContext(ctx).Info("Failed to delete pod resource. Re-running reconcile.")
+		return err
+	}
+	err = reconciler.Clientset.CoreV1().ConfigMaps(reconciler.OperatorNamesapce).Delete(ctx, podName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.FromContext(ctx).Info("Failed to delete agent config. Re-running reconcile.")
+		return err
+	}
+	return nil
+}
+
+// collectAgentResult reads the result envelope of a finished agent pod, stores
+// its artifact and records what the agent reported in target.
+func (reconciler *PodFlameReconciler) collectAgentResult(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, target *profilepodiov1alpha1.TargetStatus, pod *corev1.Pod) (bool, error) {
+	log := log.FromContext(ctx)
+	result, err := getAgentResult(ctx, reconciler.Clientset, pod.Namespace, pod.Name)
+	switch {
+	case err != nil && !isResultError(err):
+		log.Info("Failed to get result from profile pod. Re-running reconcile.")
+		return false, err
+	case err != nil && pod.Status.Phase == corev1.PodFailed && isUnreportedResult(err):
+		// The agent failed before it could report, keep the end of its logs instead
+		logs, err := getPodLogTail(ctx, reconciler.Clientset, pod.Namespace, pod.Name)
+		if err != nil {
+			log.Info("Failed to get logs from failed profile pod. Re-running reconcile.")
+			return false, err
+		}
+		failTarget(target, ReasonAgentFailed, logs)
+	case err != nil:
+		failTarget(target, resultErrorReason(err), err.Error())
+	default:
+		applyAgentResult(podflame, target, result)
+		if target.Phase == profilepodiov1alpha1.PodFlameFailed {
+			break
+		}
+		if pod.Status.Phase == corev1.PodFailed {
+			failTarget(target, ReasonAgentFailed, "Profiler failed without reporting an error")
+			break
+		}
+		refs, err := reconciler.storeArtifacts(ctx, podflame, target, result)
+		if isResultError(err) {
+			failTarget(target, resultErrorReason(err), err.Error())
+			break
+		}
+		if err != nil {
+			log.Info("Failed to store profiler result. Re-running reconcile.")
+			return false, err
+		}
+		target.Phase = profilepodiov1alpha1.PodFlameSucceeded
+		target.Results = refs
+		if result.Partial {
+			target.Phase = profilepodiov1alpha1.PodFlameCancelled
+			target.Reason = ReasonCancelled
+			target.Message = "Profiler stopped early, the results are partial"
+		} else if target.Reason == ReasonCancelled {
+			// The agent finished before it was asked to stop
+			target.Reason, target.Message = "", ""
+		}
+		reconciler.exportTarget(ctx, podflame, target, result)
+	}
+
+	if target.Phase == profilepodiov1alpha1.PodFlameFailed {
+		log.Info(fmt.Sprintf("Profiler pod %s failed: %s", pod.Name, target.Message))
+		reconciler.Recorder.Event(podflame, "Warning", target.Reason,
+			fmt.Sprintf("Profiler for %s failed: %s", target.PodName, target.Message))
+		return true, nil
+	}
+	if target.Phase == profilepodiov1alpha1.PodFlameCancelled {
+		log.Info(fmt.Sprintf("Profiler pod %s stopped early", pod.Name))
+		reconciler.Recorder.Event(podflame, "Normal", ReasonCancelled,
+			fmt.Sprintf("Profiler for %s stopped early, partial results stored", target.PodName))
+		return true, nil
+	}
+	log.Info(fmt.Sprintf("Profiler pod %s finished successfully", pod.Name))
+	reconciler.Recorder.Event(podflame, "Normal", "Success",
+		fmt.Sprintf("Profiler for %s finished successfully", target.PodName))
+	return true, nil
+}
+
+// storeArtifacts stores the result of target in every format, converting the
+// collapsed stacks and timestamped samples produced by the agent to the formats
+// it does not produce.
+func (reconciler *PodFlameReconciler) storeArtifacts(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, target *profilepodiov1alpha1.TargetStatus, result *agentv1.Result) ([]profilepodiov1alpha1.ResultReference, error) {
+	var refs []profilepodiov1alpha1.ResultReference
+	var collapsed stacks.Stacks
+	var samples []timeline.Sample
+	title := fmt.Sprintf("%s %s profile of %s/%s", podflame.Spec.Event, podflame.Spec.Duration,
+		podflame.Namespace, target.PodName)
+	for _, format := range targetFormats(podflame) {
+		var data []byte
+		var err error
+		switch {
+		case format == profilepodiov1alpha1.FormatHTML, format == profilepodiov1alpha1.FormatCollapsed:
+			artifact := result.Artifact(string(format))
+			if artifact == nil {
+				return nil, corruptResult("Profiler produced no %s artifact", format)
+			}
+			data, err = artifactData(artifact)
+		case isTimelineFormat(format):
+			if samples == nil {
+				if samples, err = parseSamplesArtifact(result); err != nil {
+					return nil, err
 				}
-				podflame.Status.FlameGraph = logs
-				if err = reconciler.Status().Update(ctx, podflame); err != nil {
-					log.Error(err, "Failed to update podflame status")
-					return ctrl.Result{}, err
+			}
+			data, err = renderTimeline(podflame, samples, format, title)
+		default:
+			if collapsed == nil {
+				if collapsed, err = parseCollapsedArtifact(result); err != nil {
+					return nil, err
 				}
-				reconciler.Recorder.Event(podflame, "Normal", "Success",
-					fmt.Sprintf("Profiler finished successfully"))
-			case corev1.PodRunning:
-				log.Info(fmt.Sprintf("Profiler pod %s is running", podName))
-				reconciler.Recorder.Event(podflame, "Normal", "Running",
-					fmt.Sprintf("Profiler is running"))
-			default:
-				log.Info(fmt.Sprintf("Profiler %s initializing", podName))
-				reconciler.Recorder.Event(podflame, "Normal", "Running",
-					fmt.Sprintf("Profiler %s initializing", podName))
 			}
+			data, err = renderStacks(podflame, collapsed, format, title)
+		}
+		if err != nil {
+			return nil, err
 		}
+		ref, err := reconciler.ResultStore.Save(ctx, podflame, artifactName(podflame, target, format), format, data)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, *ref)
 	}
-
-	return ctrl.Result{}, nil
+	return refs, nil
 }
 
-func getPodLogs(clientset *kubernetes.Clientset, namespace, podName string) (string, error) {
-	podLogs, err := clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{}).Stream(context.TODO())
+// parseCollapsedArtifact parses the collapsed stacks artifact of result.
+func parseCollapsedArtifact(result *agentv1.Result) (stacks.Stacks, error) {
+	artifact := result.Artifact(agentv1.FormatCollapsed)
+	if artifact == nil {
+		return nil, corruptResult("Profiler produced no %s artifact", agentv1.FormatCollapsed)
+	}
+	compressed, err := artifactData(artifact)
+	if err != nil {
+		return nil, err
+	}
+	data, err := stacks.Decompress(compressed)
 	if err != nil {
-		return "", err
+		return nil, corruptResult("Failed to decompress %s artifact: %s", agentv1.FormatCollapsed, err)
 	}
-	defer podLogs.Close()
+	parsed, err := stacks.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, corruptResult("Failed to parse %s artifact: %s", agentv1.FormatCollapsed, err)
+	}
+	return parsed, nil
+}
 
-	// Read the logs from the stream
-	logs := make([]byte, 4096)
-	readLen, err := podLogs.Read(logs)
+// parseSamplesArtifact parses the timestamped samples artifact of result.
+func parseSamplesArtifact(result *agentv1.Result) ([]timeline.Sample, error) {
+	artifact := result.Artifact(agentv1.FormatSamples)
+	if artifact == nil {
+		return nil, corruptResult("Profiler produced no %s artifact", agentv1.FormatSamples)
+	}
+	compressed, err := artifactData(artifact)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	data, err := stacks.Decompress(compressed)
+	if err != nil {
+		return nil, corruptResult("Failed to decompress %s artifact: %s", agentv1.FormatSamples, err)
+	}
+	parsed, err := timeline.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, corruptResult("Failed to parse %s artifact: %s", agentv1.FormatSamples, err)
+	}
+	return parsed, nil
+}
+
+// applyAgentResult records what the agent reported about target, fails target
+// with the error code of the agent when it failed, and when the profiled event
+// is not supported for the detected language.
+func applyAgentResult(podflame *profilepodiov1alpha1.PodFlame, target *profilepodiov1alpha1.TargetStatus, result *agentv1.Result) {
+	target.Language = result.Language
+	target.PID = result.PID
+	target.Profiler = result.Profiler
+	target.AgentAPIVersion = result.APIVersion
+	target.Samples = result.Samples
+	target.StartTime = metaTime(result.StartTime)
+	target.EndTime = metaTime(result.EndTime)
+	target.Warnings = result.Warnings
+	if agentErr := result.Error; agentErr != nil {
+		reason, message := agentErr.Code, agentErr.Message
+		if reason == "" {
+			reason = ReasonAgentFailed
+		}
+		if reason == agentv1.ErrorPerfEventUnavailable {
+			message = perfUnavailableMessage(podflame.Spec.Event, target, agentErr)
+		}
+		// The agent stops before profiling a language the event is not supported for
+		if err := validateEventLanguage(podflame.Spec.Event, target.Language); reason == agentv1.ErrorUnsupportedLanguage && err != nil {
+			reason, message = ReasonUnsupportedEvent, err.Error()
+		}
+		failTarget(target, reason, message)
+		return
+	}
+	if err := validateEventLanguage(podflame.Spec.Event, target.Language); err != nil {
+		failTarget(target, ReasonUnsupportedEvent, err.Error())
 	}
+}
 
-	return string(logs[:readLen]), nil
+func metaTime(t *time.Time) *metav1.Time {
+	if t == nil {
+		return nil
+	}
+	converted := metav1.NewTime(*t)
+	return &converted
 }
 
-func GetTargetPod(clientset *kubernetes.Clientset, podName, namespace string, ctx context.Context) (*corev1.Pod, error) {
+func GetTargetPod(clientset kubernetes.Interface, podName, namespace string, ctx context.Context) (*corev1.Pod, error) {
 	podObject, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
@@ -212,7 +592,10 @@ func GetTargetPod(clientset *kubernetes.Clientset, podName, namespace string, ct
 	return podObject, nil
 }
 
-func getContainerName(pod *corev1.Pod, podflame *profilepodiov1alpha1.PodFlame) (string, error) {
+// getContainerName returns the container of pod profiled by podflame: the
+// container set in its spec, the only container of pod, or the container chosen
+// by defaultContainer among the ones that are not in sidecars.
+func getContainerName(pod *corev1.Pod, podflame *profilepodiov1alpha1.PodFlame, sidecars []string) (string, error) {
 	if len(pod.Spec.Containers) != 1 {
 		var containerNames []string
 		for _, container := range pod.Spec.Containers {
@@ -222,6 +605,11 @@ func getContainerName(pod *corev1.Pod, podflame *profilepodiov1alpha1.PodFlame)
 
 			containerNames = append(containerNames, container.Name)
 		}
+		if podflame.Spec.ContainerName == "" {
+			if containerName, _ := defaultContainer(pod, sidecars); containerName != "" {
+				return containerName, nil
+			}
+		}
 
 		return "", fmt.Errorf("Could not determine container. please specify one of %v", containerNames)
 	}
@@ -19,6 +19,7 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -26,6 +27,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -43,6 +45,7 @@ import (
 
 	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
 	"github.com/profile-pod/profile-pod-operator/controllers/constants"
+	"github.com/profile-pod/profile-pod-operator/controllers/exporter"
 )
 
 const podflameFinalizer = "profilepod.io/finalizer"
@@ -50,10 +53,31 @@ const podflameFinalizer = "profilepod.io/finalizer"
 // PodFlameReconciler reconciles a PodFlame object
 type PodFlameReconciler struct {
 	client.Client
-	Scheme            *runtime.Scheme
-	Clientset         *kubernetes.Clientset
+	Scheme    *runtime.Scheme
+	Clientset kubernetes.Interface
+	// RestConfig connects to the agent pods to run commands in them
+	RestConfig        *rest.Config
 	OperatorNamesapce string
 	Recorder          record.EventRecorder
+	ResultStore       ResultStore
+	Exporters         []exporter.Exporter
+	// ExportQueue pushes the profiles to the exporters once the status recording them was written
+	ExportQueue *ExportQueue
+	// OTLPAllowedEndpoints are the OTLP endpoints PodFlames may export to besides the one of the operator
+	OTLPAllowedEndpoints []string
+	// SidecarContainers are the names of the containers injected next to the
+	// application, which are never profiled unless a PodFlame names them
+	SidecarContainers []string
+	// DefaultTTLSecondsAfterFinished is the time to live of the finished PodFlames
+	// that do not set theirs, nil keeps them
+	DefaultTTLSecondsAfterFinished *int32
+
+	// otlpExporters are the OTLP exporters created for the endpoints and
+	// protocols set by PodFlames, by protocol and endpoint
+	otlpMutex     sync.Mutex
+	otlpExporters map[string]*exporter.OTLP
+	// execStop replaces the exec of the stop command in the agent pods, in tests
+	execStop func(ctx context.Context, podName string) error
 }
 
 var (
@@ -75,7 +99,12 @@ var (
 //+kubebuilder:rbac:groups=profilepod.io,resources=podflames/finalizers,verbs=update
 //+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 //+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete;deletecollection
+//+kubebuilder:rbac:groups=core,namespace=system,resources=pods/exec,verbs=create
 //+kubebuilder:rbac:groups=core,resources=pods/log,verbs=get
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;create;update;delete;deletecollection
+//+kubebuilder:rbac:groups=core,namespace=system,resources=secrets,verbs=get
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets;replicasets,verbs=get;list
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -141,12 +170,23 @@ func (r *PodFlameReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, nil
 	}
 
-	_, err = r.reconcilePod(ctx, podflame)
+	if isFinished(podflame) && rerunRequested(podflame) {
+		log.Info("Starting a new run of podflame", "run", podflame.Status.Run+1)
+		if err := r.startRun(ctx, podflame); err != nil {
+			log.Error(err, "Failed to start a new run of podflame")
+			return ctrl.Result{}, err
+		}
+	}
+
+	result, err := r.reconcilePod(ctx, podflame)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
+	if isFinished(podflame) {
+		return r.expireFinished(ctx, podflame)
+	}
 
-	return ctrl.Result{}, nil
+	return result, nil
 }
 
 // finalizeMemcached will perform the required operations before delete the CR.
@@ -158,6 +198,13 @@ func (r *PodFlameReconciler) doFinalizerOperationsForPodflame(ctx context.Contex
 	if err != nil {
 		return err
 	}
+	err = r.Clientset.CoreV1().ConfigMaps(r.OperatorNamesapce).DeleteCollection(ctx, *deleteOptions, *listOptions)
+	if err != nil {
+		return err
+	}
+	if err = r.ResultStore.DeleteAll(ctx, podflame); err != nil {
+		return err
+	}
 	// The following implementation will raise an event
 	r.Recorder.Event(podflame, "Warning", "Deleting",
 		fmt.Sprintf("PodFlame %s is being deleted from the namespace %s",
@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"github.com/profile-pod/profile-pod-operator/controllers/constants"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// ContainerRuleSidecars is the rule choosing the only container of the target
+// pod that is not a known sidecar.
+const ContainerRuleSidecars = "sidecar-containers"
+
+// PodFlameWebhook defaults the profiled container of new PodFlames, and rejects
+// PodFlames whose target pod can not be profiled and changes to the spec of
+// existing PodFlames.
+type PodFlameWebhook struct {
+	Clientset kubernetes.Interface
+	// SidecarContainers are the names of the containers injected next to the
+	// application, which are never chosen as the default container
+	SidecarContainers []string
+}
+
+//+kubebuilder:webhook:path=/mutate-profilepod-io-v1alpha1-podflame,mutating=true,failurePolicy=fail,sideEffects=None,groups=profilepod.io,resources=podflames,verbs=create,versions=v1alpha1,name=mpodflame.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-profilepod-io-v1alpha1-podflame,mutating=false,failurePolicy=fail,sideEffects=None,groups=profilepod.io,resources=podflames,verbs=create;update,versions=v1alpha1,name=vpodflame.kb.io,admissionReviewVersions=v1
+
+var (
+	_ webhook.CustomDefaulter = &PodFlameWebhook{}
+	_ webhook.CustomValidator = &PodFlameWebhook{}
+)
+
+// SetupWebhookWithManager registers the defaulting and validating webhooks with the Manager.
+func (podflameWebhook *PodFlameWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&profilepodiov1alpha1.PodFlame{}).
+		WithDefaulter(podflameWebhook).
+		WithValidator(podflameWebhook).
+		Complete()
+}
+
+// Default sets the container of a new PodFlame that does not set one and
+// targets pods with several containers. The rule that chose the container is
+// recorded in the container-defaulted-by annotation.
+func (podflameWebhook *PodFlameWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	podflame, ok := obj.(*profilepodiov1alpha1.PodFlame)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a PodFlame but got a %T", obj))
+	}
+	if podflame.Spec.ContainerName != "" {
+		return nil
+	}
+	pod, err := podflameWebhook.samplePod(ctx, podflame)
+	if err != nil {
+		// The validation reports the target pods that can not be profiled
+		log.FromContext(ctx).V(1).Info("Not defaulting the container, the target pod is unknown", "error", err.Error())
+		return nil
+	}
+	if len(pod.Spec.Containers) < 2 {
+		return nil
+	}
+	containerName, rule := defaultContainer(pod, podflameWebhook.SidecarContainers)
+	if containerName == "" {
+		return nil
+	}
+	podflame.Spec.ContainerName = containerName
+	if podflame.Annotations == nil {
+		podflame.Annotations = map[string]string{}
+	}
+	podflame.Annotations[constants.AnnotationContainerDefaultedBy] = rule
+	return nil
+}
+
+// samplePod returns a pod targeted by podflame. The replicas of a workload or
+// the pods of a selector are expected to share their containers.
+func (podflameWebhook *PodFlameWebhook) samplePod(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame) (*corev1.Pod, error) {
+	var pods []corev1.Pod
+	var err error
+	switch {
+	case podflame.Spec.TargetPod != "":
+		return GetTargetPod(podflameWebhook.Clientset, podflame.Spec.TargetPod, podflame.Namespace, ctx)
+	case podflame.Spec.TargetSelector != nil:
+		pods, err = GetTargetPodsBySelector(podflameWebhook.Clientset, podflame.Spec.TargetSelector, podflame.Namespace, ctx)
+	case podflame.Spec.TargetRef != nil:
+		pods, err = GetWorkloadPods(podflameWebhook.Clientset, podflame.Spec.TargetRef, podflame.Namespace, ctx)
+	default:
+		err = errors.New("no target")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pods[0], nil
+}
+
+// defaultContainer returns the container of pod to profile and the rule that
+// chose it: the container named by the profilepod.io/default-container
+// annotation of pod, then by its kubectl.kubernetes.io/default-container
+// annotation, then the only container which is not a sidecar. It returns an
+// empty name when no rule applies.
+func defaultContainer(pod *corev1.Pod, sidecars []string) (string, string) {
+	for _, annotation := range []string{constants.AnnotationDefaultContainer, constants.AnnotationKubectlDefaultContainer} {
+		if name := pod.Annotations[annotation]; name != "" && hasContainer(pod, name) {
+			return name, annotation
+		}
+	}
+	var candidates []string
+	for _, container := range pod.Spec.Containers {
+		if !contains(sidecars, container.Name) {
+			candidates = append(candidates, container.Name)
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0], ContainerRuleSidecars
+	}
+	return "", ""
+}
+
+func hasContainer(pod *corev1.Pod, name string) bool {
+	for _, container := range pod.Spec.Containers {
+		if container.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateCreate runs the checks the reconciler runs before creating the
+// agent pods, so that a PodFlame that can not be profiled is rejected.
+func (podflameWebhook *PodFlameWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	podflame, ok := obj.(*profilepodiov1alpha1.PodFlame)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a PodFlame but got a %T", obj))
+	}
+	if err := validateSpec(&podflame.Spec); err != nil {
+		return invalidPodFlame(podflame, field.Forbidden(field.NewPath("spec"), err.Error()))
+	}
+	if podflame.Spec.TargetPod == "" {
+		// The pods of a selector or a workload are resolved once profiling starts
+		return nil
+	}
+	return podflameWebhook.validateTargetPod(ctx, podflame)
+}
+
+// validateTargetPod checks that the container of the target pod can be
+// determined and is running.
+func (podflameWebhook *PodFlameWebhook) validateTargetPod(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame) error {
+	specPath := field.NewPath("spec")
+	targetPod, err := GetTargetPod(podflameWebhook.Clientset, podflame.Spec.TargetPod, podflame.Namespace, ctx)
+	if apierrors.IsNotFound(err) {
+		return invalidPodFlame(podflame, field.Invalid(specPath.Child("targetPod"), podflame.Spec.TargetPod,
+			fmt.Sprintf("pod not found in namespace %s", podflame.Namespace)))
+	}
+	if err != nil {
+		return apierrors.NewInternalError(fmt.Errorf("failed to get target pod: %w", err))
+	}
+	containerName, err := getContainerName(targetPod, podflame, podflameWebhook.SidecarContainers)
+	if err != nil {
+		return invalidPodFlame(podflame, field.Invalid(specPath.Child("containerName"), podflame.Spec.ContainerName, err.Error()))
+	}
+	if _, _, err := GetContainerDetailes(containerName, targetPod); err != nil {
+		return invalidPodFlame(podflame, field.Invalid(specPath.Child("targetPod"), podflame.Spec.TargetPod, err.Error()))
+	}
+	return nil
+}
+
+// ValidateUpdate rejects changes to the spec, which is immutable but for
+// cancel. A cancelled PodFlame can not be resumed.
+func (podflameWebhook *PodFlameWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	oldPodFlame, ok := oldObj.(*profilepodiov1alpha1.PodFlame)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a PodFlame but got a %T", oldObj))
+	}
+	podflame, ok := newObj.(*profilepodiov1alpha1.PodFlame)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a PodFlame but got a %T", newObj))
+	}
+	if oldPodFlame.Spec.Cancel && !podflame.Spec.Cancel {
+		return invalidPodFlame(podflame, field.Forbidden(field.NewPath("spec", "cancel"),
+			"a cancelled PodFlame can not be resumed"))
+	}
+	oldSpec, spec := oldPodFlame.Spec, podflame.Spec
+	oldSpec.Cancel, spec.Cancel = false, false
+	if !equality.Semantic.DeepEqual(oldSpec, spec) {
+		return invalidPodFlame(podflame, field.Forbidden(field.NewPath("spec"),
+			"the spec of a PodFlame is immutable but for cancel, delete the PodFlame and create it again with the required changes"))
+	}
+	return nil
+}
+
+// ValidateDelete accepts every deletion.
+func (podflameWebhook *PodFlameWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func invalidPodFlame(podflame *profilepodiov1alpha1.PodFlame, err *field.Error) error {
+	return apierrors.NewInvalid(profilepodiov1alpha1.GroupVersion.WithKind("PodFlame").GroupKind(), podflame.Name, field.ErrorList{err})
+}
@@ -0,0 +1,256 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"github.com/profile-pod/profile-pod-operator/controllers/constants"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// webhookPod returns a pod of my-app-namespace with containers, running but
+// for the ones in waiting.
+func webhookPod(name string, annotations map[string]string, containers []string, waiting ...string) *corev1.Pod {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "my-app-namespace", Annotations: annotations}}
+	for _, container := range containers {
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: container})
+		state := corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+		if contains(waiting, container) {
+			state = corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}
+		}
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{
+			Name: container, State: state, ContainerID: "containerd://" + name + "-" + container,
+		})
+	}
+	return pod
+}
+
+func TestDefaultContainer(t *testing.T) {
+	sidecars := []string{"istio-proxy", "vault-agent"}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		containers  []string
+		// expected is the container chosen when the PodFlame does not set one
+		// and the rule that chose it, an empty container when none applies
+		expected string
+		rule     string
+	}{
+		{name: "single container", containers: []string{"app"}, expected: "app"},
+		{name: "single sidecar", containers: []string{"istio-proxy"}, expected: "istio-proxy"},
+		{
+			name: "profilepod annotation", containers: []string{"app", "worker", "istio-proxy"},
+			annotations: map[string]string{constants.AnnotationDefaultContainer: "worker", constants.AnnotationKubectlDefaultContainer: "app"},
+			expected:    "worker", rule: constants.AnnotationDefaultContainer,
+		},
+		{
+			name: "kubectl annotation", containers: []string{"app", "worker", "istio-proxy"},
+			annotations: map[string]string{constants.AnnotationKubectlDefaultContainer: "app"},
+			expected:    "app", rule: constants.AnnotationKubectlDefaultContainer,
+		},
+		{
+			name: "annotation naming a sidecar", containers: []string{"app", "istio-proxy"},
+			annotations: map[string]string{constants.AnnotationDefaultContainer: "istio-proxy"},
+			expected:    "istio-proxy", rule: constants.AnnotationDefaultContainer,
+		},
+		{
+			name: "annotation naming a missing container", containers: []string{"app", "istio-proxy"},
+			annotations: map[string]string{constants.AnnotationDefaultContainer: "worker", constants.AnnotationKubectlDefaultContainer: "web"},
+			expected:    "app", rule: ContainerRuleSidecars,
+		},
+		{name: "one non-sidecar container", containers: []string{"istio-proxy", "app", "vault-agent"}, expected: "app", rule: ContainerRuleSidecars},
+		{name: "sidecars only", containers: []string{"istio-proxy", "vault-agent"}},
+		{name: "two non-sidecar containers", containers: []string{"app", "worker", "istio-proxy"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pod := webhookPod("my-app-0", test.annotations, test.containers)
+			podflameWebhook := &PodFlameWebhook{Clientset: fake.NewSimpleClientset(pod), SidecarContainers: sidecars}
+			podflame := testPodFlame("my-app-flame", "0123456789abcdef")
+			podflame.Spec.TargetPod = "my-app-0"
+
+			// The webhook only sets the container of pods with several containers
+			if err := podflameWebhook.Default(context.Background(), podflame); err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			defaulted := test.expected
+			if len(test.containers) == 1 {
+				defaulted = ""
+			}
+			if podflame.Spec.ContainerName != defaulted || podflame.Annotations[constants.AnnotationContainerDefaultedBy] != test.rule {
+				t.Errorf("defaulted container %q by %q, expected %q by %q", podflame.Spec.ContainerName,
+					podflame.Annotations[constants.AnnotationContainerDefaultedBy], defaulted, test.rule)
+			}
+
+			// The reconciler chooses the same container when the webhook did not run
+			unset := testPodFlame("my-app-flame", "0123456789abcdef")
+			containerName, err := getContainerName(pod, unset, sidecars)
+			if test.expected == "" {
+				if err == nil || !strings.Contains(err.Error(), "please specify one of") {
+					t.Errorf("chose container %q, expected the containers to be listed, got %v", containerName, err)
+				}
+				return
+			}
+			if err != nil || containerName != test.expected {
+				t.Errorf("chose container %q (error %v), expected %q", containerName, err, test.expected)
+			}
+		})
+	}
+}
+
+func TestDefaultKeepsTheContainer(t *testing.T) {
+	pod := webhookPod("my-app-0", map[string]string{constants.AnnotationDefaultContainer: "app"}, []string{"app", "worker"})
+	podflameWebhook := &PodFlameWebhook{Clientset: fake.NewSimpleClientset(pod)}
+	podflame := testPodFlame("my-app-flame", "0123456789abcdef")
+	podflame.Spec = profilepodiov1alpha1.PodFlameSpec{TargetPod: "my-app-0", ContainerName: "worker"}
+	if err := podflameWebhook.Default(context.Background(), podflame); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if podflame.Spec.ContainerName != "worker" || len(podflame.Annotations) != 0 {
+		t.Errorf("container %q with annotations %v, expected the container of the spec", podflame.Spec.ContainerName, podflame.Annotations)
+	}
+	containerName, err := getContainerName(pod, podflame, nil)
+	if err != nil || containerName != "worker" {
+		t.Errorf("chose container %q (error %v), expected worker", containerName, err)
+	}
+
+	// A missing target pod is left to the validation
+	podflame.Spec = profilepodiov1alpha1.PodFlameSpec{TargetPod: "my-app-9"}
+	if err := podflameWebhook.Default(context.Background(), podflame); err != nil || podflame.Spec.ContainerName != "" {
+		t.Errorf("defaulted container %q (error %v) of a missing pod", podflame.Spec.ContainerName, err)
+	}
+}
+
+func TestValidateCreate(t *testing.T) {
+	tests := []struct {
+		name string
+		spec profilepodiov1alpha1.PodFlameSpec
+		// err is expected in the message of the rejection, with the field rejected
+		err   string
+		field string
+	}{
+		{name: "single container", spec: profilepodiov1alpha1.PodFlameSpec{TargetPod: "my-app-0"}},
+		{name: "named container", spec: profilepodiov1alpha1.PodFlameSpec{TargetPod: "my-app-1", ContainerName: "app"}},
+		{
+			name: "no target", spec: profilepodiov1alpha1.PodFlameSpec{},
+			err: "one of targetPod, targetSelector and targetRef must be set", field: "spec",
+		},
+		{
+			name: "several targets", spec: profilepodiov1alpha1.PodFlameSpec{TargetPod: "my-app-0", TargetRef: &profilepodiov1alpha1.TargetReference{Kind: "Deployment", Name: "my-app"}},
+			err: "only one of targetPod, targetSelector and targetRef may be set", field: "spec",
+		},
+		{
+			name: "missing pod", spec: profilepodiov1alpha1.PodFlameSpec{TargetPod: "my-app-9"},
+			err: "pod not found in namespace my-app-namespace", field: "spec.targetPod",
+		},
+		{
+			name: "container not given", spec: profilepodiov1alpha1.PodFlameSpec{TargetPod: "my-app-1"},
+			err: "please specify one of [app istio-proxy]", field: "spec.containerName",
+		},
+		{
+			name: "unknown container", spec: profilepodiov1alpha1.PodFlameSpec{TargetPod: "my-app-1", ContainerName: "worker"},
+			err: "please specify one of [app istio-proxy]", field: "spec.containerName",
+		},
+		{
+			name: "container not running", spec: profilepodiov1alpha1.PodFlameSpec{TargetPod: "my-app-2"},
+			err: "Container is not running: app", field: "spec.targetPod",
+		},
+		{
+			// The pods of a workload are only resolved once profiling starts
+			name: "workload", spec: profilepodiov1alpha1.PodFlameSpec{TargetRef: &profilepodiov1alpha1.TargetReference{Kind: "Deployment", Name: "my-app"}},
+		},
+	}
+	podflameWebhook := &PodFlameWebhook{Clientset: fake.NewSimpleClientset(
+		webhookPod("my-app-0", nil, []string{"app"}),
+		webhookPod("my-app-1", nil, []string{"app", "istio-proxy"}),
+		webhookPod("my-app-2", nil, []string{"app"}, "app"),
+	)}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			podflame := testPodFlame("my-app-flame", "0123456789abcdef")
+			podflame.Spec = test.spec
+			err := podflameWebhook.ValidateCreate(context.Background(), podflame)
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error %s", err)
+				}
+				return
+			}
+			expectInvalid(t, err, test.field, test.err)
+		})
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	podflame := testPodFlame("my-app-flame", "0123456789abcdef")
+	podflame.Spec = profilepodiov1alpha1.PodFlameSpec{TargetPod: "my-app-0", Duration: "30s"}
+	cancelled := podflame.DeepCopy()
+	cancelled.Spec.Cancel = true
+	longer := podflame.DeepCopy()
+	longer.Spec.Duration = "1m"
+	retargeted := cancelled.DeepCopy()
+	retargeted.Spec.TargetPod = "my-app-1"
+	relabelled := podflame.DeepCopy()
+	relabelled.Labels = map[string]string{"team": "a"}
+	tests := []struct {
+		name     string
+		old, new *profilepodiov1alpha1.PodFlame
+		err      string
+		field    string
+	}{
+		{name: "unchanged", old: podflame, new: podflame},
+		{name: "metadata", old: podflame, new: relabelled},
+		{name: "cancel", old: podflame, new: cancelled},
+		{name: "cancel again", old: cancelled, new: cancelled},
+		{name: "resume", old: cancelled, new: podflame, err: "a cancelled PodFlame can not be resumed", field: "spec.cancel"},
+		{name: "duration", old: podflame, new: longer, err: "delete the PodFlame and create it again", field: "spec"},
+		{name: "target with cancel", old: podflame, new: retargeted, err: "the spec of a PodFlame is immutable but for cancel", field: "spec"},
+	}
+	podflameWebhook := &PodFlameWebhook{Clientset: fake.NewSimpleClientset()}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := podflameWebhook.ValidateUpdate(context.Background(), test.old.DeepCopy(), test.new.DeepCopy())
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error %s", err)
+				}
+				return
+			}
+			expectInvalid(t, err, test.field, test.err)
+		})
+	}
+}
+
+func TestValidateWrongKind(t *testing.T) {
+	podflameWebhook := &PodFlameWebhook{Clientset: fake.NewSimpleClientset()}
+	var pod runtime.Object = &corev1.Pod{}
+	if err := podflameWebhook.ValidateCreate(context.Background(), pod); !apierrors.IsBadRequest(err) {
+		t.Errorf("expected a bad request, got %v", err)
+	}
+	if err := podflameWebhook.ValidateUpdate(context.Background(), pod, testPodFlame("my-app-flame", "0123456789abcdef")); !apierrors.IsBadRequest(err) {
+		t.Errorf("expected a bad request, got %v", err)
+	}
+}
+
+// expectInvalid checks that err rejects the PodFlame as invalid, naming field
+// and a message containing message.
+func expectInvalid(t *testing.T, err error, field, message string) {
+	t.Helper()
+	if !apierrors.IsInvalid(err) {
+		t.Fatalf("expected an invalid PodFlame, got %v", err)
+	}
+	status, ok := err.(apierrors.APIStatus)
+	if !ok || status.Status().Details == nil || len(status.Status().Details.Causes) != 1 {
+		t.Fatalf("expected one cause, got %v", err)
+	}
+	cause := status.Status().Details.Causes[0]
+	if cause.Field != field || !strings.Contains(cause.Message, message) {
+		t.Errorf("rejected %s: %q, expected %s: %q", cause.Field, cause.Message, field, message)
+	}
+}
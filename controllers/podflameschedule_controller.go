@@ -0,0 +1,339 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ref "k8s.io/client-go/tools/reference"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"github.com/profile-pod/profile-pod-operator/controllers/constants"
+	"github.com/profile-pod/profile-pod-operator/controllers/cron"
+)
+
+const (
+	// podflameOwnerKey indexes PodFlames by the name of their controlling PodFlameSchedule
+	podflameOwnerKey = ".metadata.controller"
+	// maxMissedRuns is the number of missed runs counted, above which a
+	// schedule is reported as too late like a CronJob
+	maxMissedRuns = 100
+)
+
+// PodFlameScheduleReconciler reconciles a PodFlameSchedule object, creating a
+// PodFlame for every run of its schedule the way a CronJob creates Jobs.
+type PodFlameScheduleReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=profilepod.io,resources=podflameschedules,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=profilepod.io,resources=podflameschedules/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=profilepod.io,resources=podflameschedules/finalizers,verbs=update
+//+kubebuilder:rbac:groups=profilepod.io,resources=podflames,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
+// Reconcile updates the status of a PodFlameSchedule from its PodFlames, prunes
+// their history and creates the PodFlame of the latest missed run.
+func (r *PodFlameScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	schedule := &profilepodiov1alpha1.PodFlameSchedule{}
+	if err := r.Get(ctx, req.NamespacedName, schedule); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info("podflameschedule resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get podflameschedule")
+		return ctrl.Result{}, err
+	}
+
+	var runs profilepodiov1alpha1.PodFlameList
+	if err := r.List(ctx, &runs, client.InNamespace(req.Namespace), client.MatchingFields{podflameOwnerKey: req.Name}); err != nil {
+		log.Error(err, "Failed to list the podflames of the podflameschedule")
+		return ctrl.Result{}, err
+	}
+
+	var active, successful, failed []*profilepodiov1alpha1.PodFlame
+	var lastScheduleTime *time.Time
+	for i := range runs.Items {
+		run := &runs.Items[i]
+		switch {
+		case !isFinished(run):
+			active = append(active, run)
+		case run.Status.Phase == profilepodiov1alpha1.PodFlameSucceeded:
+			successful = append(successful, run)
+		default:
+			failed = append(failed, run)
+		}
+		if scheduledAt, err := scheduledTime(run); err != nil {
+			log.Error(err, "Invalid scheduled time annotation", "podflame", run.Name)
+		} else if scheduledAt != nil && (lastScheduleTime == nil || scheduledAt.After(*lastScheduleTime)) {
+			lastScheduleTime = scheduledAt
+		}
+	}
+
+	if lastScheduleTime != nil && (schedule.Status.LastScheduleTime == nil || lastScheduleTime.After(schedule.Status.LastScheduleTime.Time)) {
+		schedule.Status.LastScheduleTime = &metav1.Time{Time: *lastScheduleTime}
+	}
+	for _, run := range successful {
+		completion := run.Status.CompletionTime
+		if completion != nil && (schedule.Status.LastSuccessfulTime == nil || completion.After(schedule.Status.LastSuccessfulTime.Time)) {
+			schedule.Status.LastSuccessfulTime = completion
+		}
+	}
+	schedule.Status.Active = nil
+	for _, run := range active {
+		reference, err := ref.GetReference(r.Scheme, run)
+		if err != nil {
+			log.Error(err, "Failed to make a reference to the active podflame", "podflame", run.Name)
+			continue
+		}
+		schedule.Status.Active = append(schedule.Status.Active, *reference)
+	}
+	if err := r.Status().Update(ctx, schedule); err != nil {
+		log.Error(err, "Failed to update podflameschedule status")
+		return ctrl.Result{}, err
+	}
+
+	r.pruneHistory(ctx, successful, schedule.Spec.SuccessfulRunsHistoryLimit)
+	r.pruneHistory(ctx, failed, schedule.Spec.FailedRunsHistoryLimit)
+
+	if schedule.Spec.Suspend != nil && *schedule.Spec.Suspend {
+		log.V(1).Info("podflameschedule suspended, skipping")
+		return ctrl.Result{}, nil
+	}
+
+	cronSchedule, err := cron.Parse(schedule.Spec.Schedule)
+	if err != nil {
+		r.Recorder.Event(schedule, "Warning", "InvalidSchedule", err.Error())
+		return ctrl.Result{}, nil
+	}
+	location := time.Local
+	if schedule.Spec.TimeZone != nil {
+		if location, err = time.LoadLocation(*schedule.Spec.TimeZone); err != nil {
+			r.Recorder.Event(schedule, "Warning", "UnknownTimeZone",
+				fmt.Sprintf("Unknown time zone %s: %s", *schedule.Spec.TimeZone, err))
+			return ctrl.Result{}, nil
+		}
+	}
+
+	now := time.Now().In(location)
+	missedRun, nextRun, missed := nextSchedule(schedule, cronSchedule, now)
+	if missed > maxMissedRuns {
+		r.Recorder.Event(schedule, "Warning", "TooManyMissedRuns",
+			fmt.Sprintf("Missed more than %d runs, set or decrease startingDeadlineSeconds or check the clock of the operator", maxMissedRuns))
+	}
+	result := ctrl.Result{}
+	if !nextRun.IsZero() {
+		result.RequeueAfter = nextRun.Sub(now)
+	}
+	if missedRun.IsZero() {
+		return result, nil
+	}
+
+	if deadline := schedule.Spec.StartingDeadlineSeconds; deadline != nil &&
+		missedRun.Add(time.Duration(*deadline)*time.Second).Before(now) {
+		r.Recorder.Event(schedule, "Warning", "MissedSchedule",
+			fmt.Sprintf("Missed the run scheduled at %s, it is past the starting deadline", missedRun.Format(time.RFC3339)))
+		return result, nil
+	}
+
+	switch schedule.Spec.ConcurrencyPolicy {
+	case profilepodiov1alpha1.ForbidConcurrent:
+		if len(active) > 0 {
+			r.Recorder.Event(schedule, "Normal", "SkippedRun",
+				fmt.Sprintf("Skipped the run scheduled at %s, %d runs are still profiling", missedRun.Format(time.RFC3339), len(active)))
+			return result, nil
+		}
+	case profilepodiov1alpha1.ReplaceConcurrent:
+		for _, run := range active {
+			if err := r.Delete(ctx, run, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+				log.Error(err, "Failed to delete active podflame", "podflame", run.Name)
+				return ctrl.Result{}, err
+			}
+			r.Recorder.Event(schedule, "Normal", "ReplacedRun", fmt.Sprintf("Deleted active PodFlame %s", run.Name))
+		}
+	}
+
+	run, err := r.podflameForRun(schedule, missedRun)
+	if err != nil {
+		log.Error(err, "Failed to construct podflame from template")
+		return ctrl.Result{}, err
+	}
+	if err := r.Create(ctx, run); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return result, nil
+		}
+		r.Recorder.Event(schedule, "Warning", "FailedCreate", fmt.Sprintf("Failed to create PodFlame %s: %s", run.Name, err))
+		return ctrl.Result{}, err
+	}
+	r.Recorder.Event(schedule, "Normal", "SuccessfulCreate", fmt.Sprintf("Created PodFlame %s", run.Name))
+	log.Info("Created podflame for scheduled run", "podflame", run.Name, "scheduledAt", missedRun)
+
+	schedule.Status.LastScheduleTime = &metav1.Time{Time: missedRun}
+	if err := r.Status().Update(ctx, schedule); err != nil {
+		log.Error(err, "Failed to update podflameschedule status")
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+// scheduledTime returns the scheduled time of the run of podflame, nil when it
+// was not created by a schedule.
+func scheduledTime(podflame *profilepodiov1alpha1.PodFlame) (*time.Time, error) {
+	value, found := podflame.Annotations[constants.AnnotationScheduledAt]
+	if !found {
+		return nil, nil
+	}
+	scheduledAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &scheduledAt, nil
+}
+
+// nextSchedule returns the latest run of schedule missed before now, zero when
+// none was missed, the next run after now and the number of missed runs. The
+// missed runs are only counted up to maxMissedRuns+1.
+func nextSchedule(schedule *profilepodiov1alpha1.PodFlameSchedule, cronSchedule *cron.Schedule, now time.Time) (time.Time, time.Time, int) {
+	earliest := schedule.CreationTimestamp.Time
+	if schedule.Status.LastScheduleTime != nil {
+		earliest = schedule.Status.LastScheduleTime.Time
+	}
+	if deadline := schedule.Spec.StartingDeadlineSeconds; deadline != nil {
+		// Runs past the deadline are never started, no need to look at them
+		if start := now.Add(-time.Duration(*deadline) * time.Second); start.After(earliest) {
+			earliest = start
+		}
+	}
+	if earliest.After(now) {
+		return time.Time{}, cronSchedule.Next(now), 0
+	}
+
+	var missedRun time.Time
+	missed := 0
+	for run := cronSchedule.Next(earliest.In(now.Location())); !run.IsZero() && !run.After(now); run = cronSchedule.Next(run) {
+		missedRun = run
+		missed++
+		if missed > maxMissedRuns {
+			missedRun = latestRun(cronSchedule, earliest, now)
+			break
+		}
+	}
+	return missedRun, cronSchedule.Next(now), missed
+}
+
+// latestRun returns the latest run of cronSchedule after earliest and before
+// now, looking back from now twice as far every time no run is found so that
+// the runs between earliest and now are not all walked through.
+func latestRun(cronSchedule *cron.Schedule, earliest, now time.Time) time.Time {
+	for lookback := time.Minute; ; lookback *= 2 {
+		start := now.Add(-lookback)
+		if start.Before(earliest) {
+			start = earliest
+		}
+		var latest time.Time
+		for run := cronSchedule.Next(start.In(now.Location())); !run.IsZero() && !run.After(now); run = cronSchedule.Next(run) {
+			latest = run
+		}
+		if !latest.IsZero() || !start.After(earliest) {
+			return latest
+		}
+	}
+}
+
+// podflameForRun returns the PodFlame of the run of schedule at scheduledAt. Its
+// name is derived from the scheduled time so that a run is created only once.
+func (r *PodFlameScheduleReconciler) podflameForRun(schedule *profilepodiov1alpha1.PodFlameSchedule, scheduledAt time.Time) (*profilepodiov1alpha1.PodFlame, error) {
+	template := &schedule.Spec.PodFlameTemplate
+	podflame := &profilepodiov1alpha1.PodFlame{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s-%d", schedule.Name, scheduledAt.Unix()/60),
+			Namespace:   schedule.Namespace,
+			Labels:      map[string]string{},
+			Annotations: map[string]string{},
+		},
+		Spec: *template.Spec.DeepCopy(),
+	}
+	for key, value := range template.Labels {
+		podflame.Labels[key] = value
+	}
+	for key, value := range template.Annotations {
+		podflame.Annotations[key] = value
+	}
+	podflame.Labels[constants.Schedule] = schedule.Name
+	podflame.Annotations[constants.AnnotationScheduledAt] = scheduledAt.UTC().Format(time.RFC3339)
+	if err := ctrl.SetControllerReference(schedule, podflame, r.Scheme); err != nil {
+		return nil, err
+	}
+	return podflame, nil
+}
+
+// pruneHistory deletes the oldest finished runs above limit.
+func (r *PodFlameScheduleReconciler) pruneHistory(ctx context.Context, runs []*profilepodiov1alpha1.PodFlame, limit *int32) {
+	if limit == nil || len(runs) <= int(*limit) {
+		return
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		if runs[i].Status.CompletionTime == nil {
+			return runs[j].Status.CompletionTime != nil
+		}
+		if runs[j].Status.CompletionTime == nil {
+			return false
+		}
+		return runs[i].Status.CompletionTime.Before(runs[j].Status.CompletionTime)
+	})
+	for _, run := range runs[:len(runs)-int(*limit)] {
+		if err := r.Delete(ctx, run, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			log.FromContext(ctx).Error(err, "Failed to delete old podflame", "podflame", run.Name)
+		}
+	}
+}
+
+// podflameSchedule returns the name of the PodFlameSchedule controlling object,
+// it indexes PodFlames under podflameOwnerKey.
+func podflameSchedule(object client.Object) []string {
+	owner := metav1.GetControllerOf(object)
+	if owner == nil || owner.APIVersion != profilepodiov1alpha1.GroupVersion.String() || owner.Kind != "PodFlameSchedule" {
+		return nil
+	}
+	return []string{owner.Name}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PodFlameScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &profilepodiov1alpha1.PodFlame{}, podflameOwnerKey, podflameSchedule); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&profilepodiov1alpha1.PodFlameSchedule{}, IgnoreStatusChange).
+		Owns(&profilepodiov1alpha1.PodFlame{}).
+		Complete(r)
+}
@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"github.com/profile-pod/profile-pod-operator/controllers/constants"
+	"github.com/profile-pod/profile-pod-operator/controllers/cron"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNextSchedule(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 30, 30, 0, time.UTC)
+	tests := []struct {
+		name         string
+		schedule     string
+		created      time.Time
+		lastSchedule *time.Time
+		deadline     *int64
+		missedRun    time.Time
+		nextRun      time.Time
+		missed       int
+	}{
+		{
+			name: "no missed run", schedule: "0 * * * *", created: now.Add(-10 * time.Minute),
+			nextRun: time.Date(2023, 3, 1, 13, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "missed run", schedule: "*/10 * * * *", created: now.Add(-15 * time.Minute),
+			missedRun: time.Date(2023, 3, 1, 12, 30, 0, 0, time.UTC), nextRun: time.Date(2023, 3, 1, 12, 40, 0, 0, time.UTC), missed: 2,
+		},
+		{
+			name: "since the last scheduled run", schedule: "*/10 * * * *", created: now.Add(-time.Hour),
+			lastSchedule: timePointer(time.Date(2023, 3, 1, 12, 20, 0, 0, time.UTC)),
+			missedRun:    time.Date(2023, 3, 1, 12, 30, 0, 0, time.UTC), nextRun: time.Date(2023, 3, 1, 12, 40, 0, 0, time.UTC), missed: 1,
+		},
+		{
+			name: "past the starting deadline", schedule: "*/10 * * * *", created: now.Add(-time.Hour), deadline: int64Pointer(60),
+			missedRun: time.Date(2023, 3, 1, 12, 30, 0, 0, time.UTC), nextRun: time.Date(2023, 3, 1, 12, 40, 0, 0, time.UTC), missed: 1,
+		},
+		{
+			name: "starting deadline without missed run", schedule: "*/10 * * * *", created: now.Add(-time.Hour), deadline: int64Pointer(20),
+			nextRun: time.Date(2023, 3, 1, 12, 40, 0, 0, time.UTC),
+		},
+		{
+			name: "too many missed runs", schedule: "* * * * *", created: now.AddDate(-1, 0, 0),
+			missedRun: time.Date(2023, 3, 1, 12, 30, 0, 0, time.UTC), nextRun: time.Date(2023, 3, 1, 12, 31, 0, 0, time.UTC), missed: maxMissedRuns + 1,
+		},
+		{
+			name: "too many missed runs of a sparse schedule", schedule: "0 0 * * *", created: now.AddDate(-1, 0, 0),
+			missedRun: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), nextRun: time.Date(2023, 3, 2, 0, 0, 0, 0, time.UTC), missed: maxMissedRuns + 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cronSchedule, err := cron.Parse(test.schedule)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			schedule := &profilepodiov1alpha1.PodFlameSchedule{
+				ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(test.created)},
+				Spec:       profilepodiov1alpha1.PodFlameScheduleSpec{Schedule: test.schedule, StartingDeadlineSeconds: test.deadline},
+			}
+			if test.lastSchedule != nil {
+				schedule.Status.LastScheduleTime = &metav1.Time{Time: *test.lastSchedule}
+			}
+			missedRun, nextRun, missed := nextSchedule(schedule, cronSchedule, now)
+			if !missedRun.Equal(test.missedRun) || !nextRun.Equal(test.nextRun) || missed != test.missed {
+				t.Errorf("nextSchedule = %s, %s, %d, expected %s, %s, %d", missedRun, nextRun, missed, test.missedRun, test.nextRun, test.missed)
+			}
+		})
+	}
+}
+
+func timePointer(t time.Time) *time.Time { return &t }
+
+func int64Pointer(i int64) *int64 { return &i }
+
+// testScheduleReconciler returns a reconciler of schedule, whose runs are
+// created as runs, with the fake client and recorder it uses.
+func testScheduleReconciler(t *testing.T, schedule *profilepodiov1alpha1.PodFlameSchedule, runs ...*profilepodiov1alpha1.PodFlame) (*PodFlameScheduleReconciler, client.Client, *record.FakeRecorder) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := profilepodiov1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	objects := []client.Object{schedule}
+	for _, run := range runs {
+		if err := ctrl.SetControllerReference(schedule, run, scheme); err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+		objects = append(objects, run)
+	}
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).
+		WithIndex(&profilepodiov1alpha1.PodFlame{}, podflameOwnerKey, podflameSchedule).Build()
+	recorder := record.NewFakeRecorder(20)
+	return &PodFlameScheduleReconciler{Client: c, Scheme: scheme, Recorder: recorder}, c, recorder
+}
+
+func testSchedule(policy profilepodiov1alpha1.ConcurrencyPolicy) *profilepodiov1alpha1.PodFlameSchedule {
+	return &profilepodiov1alpha1.PodFlameSchedule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "nightly", Namespace: "my-app-namespace", UID: "5c1e9f0a-0000-4d0e-9c5c-1b2b3c4d5e6f",
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+		},
+		Spec: profilepodiov1alpha1.PodFlameScheduleSpec{
+			Schedule:          "* * * * *",
+			ConcurrencyPolicy: policy,
+			PodFlameTemplate: profilepodiov1alpha1.PodFlameTemplateSpec{
+				Spec: profilepodiov1alpha1.PodFlameSpec{TargetPod: "my-app-0", Event: "cpu", Duration: "1m"},
+			},
+		},
+	}
+}
+
+// testRun returns a run of a schedule scheduled age ago, finished in phase
+// unless phase is Running.
+func testRun(name string, age time.Duration, phase profilepodiov1alpha1.PodFlamePhase) *profilepodiov1alpha1.PodFlame {
+	scheduledAt := time.Now().Add(-age).Truncate(time.Minute)
+	run := &profilepodiov1alpha1.PodFlame{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: "my-app-namespace",
+			Annotations: map[string]string{constants.AnnotationScheduledAt: scheduledAt.UTC().Format(time.RFC3339)},
+		},
+		Status: profilepodiov1alpha1.PodFlameStatus{Phase: phase},
+	}
+	if phase != profilepodiov1alpha1.PodFlameRunning {
+		completion := metav1.NewTime(scheduledAt.Add(time.Minute))
+		run.Status.CompletionTime = &completion
+	}
+	return run
+}
+
+func scheduleRuns(t *testing.T, c client.Client) map[string]bool {
+	t.Helper()
+	var runs profilepodiov1alpha1.PodFlameList
+	if err := c.List(context.Background(), &runs, client.InNamespace("my-app-namespace")); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	names := map[string]bool{}
+	for _, run := range runs.Items {
+		names[run.Name] = true
+	}
+	return names
+}
+
+func reconcileSchedule(t *testing.T, reconciler *PodFlameScheduleReconciler) {
+	t.Helper()
+	result, err := reconciler.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "my-app-namespace", Name: "nightly"}})
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if result.RequeueAfter <= 0 || result.RequeueAfter > time.Minute {
+		t.Errorf("requeued after %s, expected the next minute", result.RequeueAfter)
+	}
+}
+
+func hasEvent(recorder *record.FakeRecorder, reason string) bool {
+	for {
+		select {
+		case event := <-recorder.Events:
+			if strings.Contains(event, " "+reason+" ") {
+				return true
+			}
+		default:
+			return false
+		}
+	}
+}
+
+func TestScheduleConcurrencyPolicy(t *testing.T) {
+	tests := []struct {
+		policy profilepodiov1alpha1.ConcurrencyPolicy
+		// created and deleted report whether a run is created and the active one deleted
+		created, deleted bool
+		event            string
+	}{
+		{policy: profilepodiov1alpha1.AllowConcurrent, created: true, event: "SuccessfulCreate"},
+		{policy: profilepodiov1alpha1.ForbidConcurrent, event: "SkippedRun"},
+		{policy: profilepodiov1alpha1.ReplaceConcurrent, created: true, deleted: true, event: "ReplacedRun"},
+	}
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			reconciler, c, recorder := testScheduleReconciler(t, testSchedule(test.policy),
+				testRun("nightly-active", 3*time.Minute, profilepodiov1alpha1.PodFlameRunning))
+			before := time.Now()
+			reconcileSchedule(t, reconciler)
+
+			runs := scheduleRuns(t, c)
+			if runs["nightly-active"] == test.deleted {
+				t.Errorf("active run kept: %t, expected %t", runs["nightly-active"], !test.deleted)
+			}
+			created := len(runs)
+			if runs["nightly-active"] {
+				created--
+			}
+			if (created == 1) != test.created || created > 1 {
+				t.Errorf("created %d runs, expected a run: %t", created, test.created)
+			}
+			if !hasEvent(recorder, test.event) {
+				t.Errorf("no %s event", test.event)
+			}
+
+			schedule := &profilepodiov1alpha1.PodFlameSchedule{}
+			if err := c.Get(context.Background(), types.NamespacedName{Namespace: "my-app-namespace", Name: "nightly"}, schedule); err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if test.created && (schedule.Status.LastScheduleTime == nil || schedule.Status.LastScheduleTime.Before(&metav1.Time{Time: before.Add(-time.Minute)})) {
+				t.Errorf("last schedule time %v, expected the latest minute", schedule.Status.LastScheduleTime)
+			}
+			if !test.created && len(schedule.Status.Active) != 1 {
+				t.Errorf("%d active runs in the status, expected the running one", len(schedule.Status.Active))
+			}
+		})
+	}
+}
+
+func TestScheduleHistory(t *testing.T) {
+	schedule := testSchedule(profilepodiov1alpha1.AllowConcurrent)
+	suspend, successful, failed := true, int32(1), int32(0)
+	schedule.Spec.Suspend = &suspend
+	schedule.Spec.SuccessfulRunsHistoryLimit = &successful
+	schedule.Spec.FailedRunsHistoryLimit = &failed
+	reconciler, c, _ := testScheduleReconciler(t, schedule,
+		testRun("nightly-1", 30*time.Minute, profilepodiov1alpha1.PodFlameSucceeded),
+		testRun("nightly-2", 20*time.Minute, profilepodiov1alpha1.PodFlameSucceeded),
+		testRun("nightly-3", 10*time.Minute, profilepodiov1alpha1.PodFlameSucceeded),
+		testRun("nightly-4", 5*time.Minute, profilepodiov1alpha1.PodFlameFailed),
+		testRun("nightly-5", 2*time.Minute, profilepodiov1alpha1.PodFlameRunning),
+	)
+	if _, err := reconciler.Reconcile(context.Background(), ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "my-app-namespace", Name: "nightly"}}); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	runs := scheduleRuns(t, c)
+	if len(runs) != 2 || !runs["nightly-3"] || !runs["nightly-5"] {
+		t.Errorf("runs %v kept, expected the latest succeeded and the running runs", runs)
+	}
+	stored := &profilepodiov1alpha1.PodFlameSchedule{}
+	if err := c.Get(context.Background(), types.NamespacedName{Namespace: "my-app-namespace", Name: "nightly"}, stored); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if stored.Status.LastSuccessfulTime == nil || len(stored.Status.Active) != 1 || stored.Status.Active[0].Name != "nightly-5" {
+		t.Errorf("status %+v", stored.Status)
+	}
+}
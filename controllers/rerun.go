@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"github.com/profile-pod/profile-pod-operator/controllers/constants"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// ReasonRerun is the reason of the event of a PodFlame started again by the rerun annotation
+	ReasonRerun = "Rerun"
+
+	// runHistoryLimit is the number of previous runs kept in the status of a PodFlame
+	runHistoryLimit = 10
+)
+
+// rerunRequested reports whether the rerun annotation of podflame holds a
+// nonce that did not start a run yet.
+func rerunRequested(podflame *profilepodiov1alpha1.PodFlame) bool {
+	nonce := podflame.Annotations[constants.AnnotationRerun]
+	return nonce != "" && nonce != podflame.Status.RerunNonce
+}
+
+// runName returns name made unique to the current run of podflame, the names
+// of the first run are left as they are.
+func runName(podflame *profilepodiov1alpha1.PodFlame, name string) string {
+	if podflame.Status.Run == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s-r%d", name, podflame.Status.Run)
+}
+
+// startRun moves the outcome of the finished run of podflame to its history
+// and resets its status so that the next reconcile profiles the targets
+// again. Once the status is written, the results of the runs dropped from the
+// history, and of the windows the history does not reference, are deleted.
+func (reconciler *PodFlameReconciler) startRun(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame) error {
+	status := &podflame.Status
+	run := archiveRun(podflame)
+	unreferenced := unreferencedWindowResults(status.Targets, &run)
+
+	status.History = append(status.History, run)
+	if len(status.History) > runHistoryLimit {
+		dropped := status.History[:len(status.History)-runHistoryLimit]
+		status.History = append([]profilepodiov1alpha1.RunStatus(nil), status.History[len(dropped):]...)
+		for i := range dropped {
+			unreferenced = append(unreferenced, runResults(&dropped[i])...)
+		}
+	}
+
+	// A cancel that could not be unset does not stop the next runs
+	recordCancel(podflame)
+	status.Run++
+	status.RerunNonce = podflame.Annotations[constants.AnnotationRerun]
+	status.Phase = profilepodiov1alpha1.PodFlamePending
+	status.Conditions = nil
+	status.StartTime = nil
+	status.CompletionTime = nil
+	status.AgentPod = ""
+	status.Results = nil
+	status.AggregatedResults = nil
+	status.Targets = nil
+	// The results are still referenced by the stored status until it is written
+	if err := reconciler.updateStatus(ctx, podflame); err != nil {
+		return err
+	}
+	reconciler.deleteResults(ctx, podflame, unreferenced)
+	reconciler.Recorder.Event(podflame, "Normal", ReasonRerun,
+		fmt.Sprintf("Starting run %d, run %d moved to the history", status.Run, run.Run))
+	return nil
+}
+
+// archiveRun returns the history entry of the finished run of podflame.
+func archiveRun(podflame *profilepodiov1alpha1.PodFlame) profilepodiov1alpha1.RunStatus {
+	status := &podflame.Status
+	run := profilepodiov1alpha1.RunStatus{
+		Run:               status.Run,
+		RerunNonce:        status.RerunNonce,
+		Phase:             status.Phase,
+		StartTime:         status.StartTime,
+		CompletionTime:    status.CompletionTime,
+		Results:           status.Results,
+		AggregatedResults: status.AggregatedResults,
+	}
+	for _, conditionType := range []string{ConditionSucceeded, ConditionFailed, ConditionCancelled} {
+		if condition := meta.FindStatusCondition(status.Conditions, conditionType); condition != nil {
+			run.Reason, run.Message = condition.Reason, condition.Message
+			break
+		}
+	}
+	for i := range status.Targets {
+		target := &status.Targets[i]
+		run.Targets = append(run.Targets, profilepodiov1alpha1.RunTargetStatus{
+			PodName:        target.PodName,
+			Phase:          target.Phase,
+			Results:        target.Results,
+			RollingResults: target.RollingResults,
+		})
+	}
+	return run
+}
+
+// runResults returns every result referenced by run.
+func runResults(run *profilepodiov1alpha1.RunStatus) []profilepodiov1alpha1.ResultReference {
+	refs := append(append([]profilepodiov1alpha1.ResultReference(nil), run.Results...), run.AggregatedResults...)
+	for i := range run.Targets {
+		refs = append(refs, run.Targets[i].Results...)
+		refs = append(refs, run.Targets[i].RollingResults...)
+	}
+	return refs
+}
+
+// unreferencedWindowResults returns the results of the windows of targets
+// that run does not reference.
+func unreferencedWindowResults(targets []profilepodiov1alpha1.TargetStatus, run *profilepodiov1alpha1.RunStatus) []profilepodiov1alpha1.ResultReference {
+	referenced := map[string]bool{}
+	for _, ref := range runResults(run) {
+		referenced[ref.Name] = true
+	}
+	var refs []profilepodiov1alpha1.ResultReference
+	for i := range targets {
+		for _, window := range targets[i].Windows {
+			for _, ref := range window.Results {
+				if !referenced[ref.Name] {
+					refs = append(refs, ref)
+				}
+			}
+		}
+	}
+	return refs
+}
+
+// deleteResults deletes refs from the result store, a result that can not be
+// deleted is left behind for the finalizer.
+func (reconciler *PodFlameReconciler) deleteResults(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, refs []profilepodiov1alpha1.ResultReference) {
+	for i := range refs {
+		if err := reconciler.ResultStore.Delete(ctx, podflame, &refs[i]); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to delete the result of a previous run", "result", refs[i].Name)
+		}
+	}
+}
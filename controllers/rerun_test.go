@@ -0,0 +1,239 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"github.com/profile-pod/profile-pod-operator/controllers/constants"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRerunAfterCancel(t *testing.T) {
+	podflame := testPodFlame("my-app-flame", "0123456789abcdef")
+	podflame.Spec = profilepodiov1alpha1.PodFlameSpec{TargetPod: "my-app-0", Event: "cpu", Duration: "30s", Cancel: true}
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if err := profilepodiov1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(podflame).Build()
+	recorder := record.NewFakeRecorder(20)
+	reconciler := &PodFlameReconciler{
+		Client:            c,
+		Clientset:         fake.NewSimpleClientset(webhookPod("my-app-0", nil, []string{"app"})),
+		OperatorNamesapce: "profile-pod",
+		Recorder:          recorder,
+		ExportQueue:       NewExportQueue(c, recorder, 0),
+	}
+	ctx := context.Background()
+	stored := func() *profilepodiov1alpha1.PodFlame {
+		t.Helper()
+		stored := &profilepodiov1alpha1.PodFlame{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: podflame.Namespace, Name: podflame.Name}, stored); err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+		return stored
+	}
+
+	// The first run is cancelled before it starts
+	podflame = stored()
+	if _, err := reconciler.reconcilePod(ctx, podflame); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	podflame = stored()
+	if podflame.Status.Phase != profilepodiov1alpha1.PodFlameCancelled {
+		t.Fatalf("phase = %s, expected the first run cancelled", podflame.Status.Phase)
+	}
+	if podflame.Status.CancelledRun == nil || *podflame.Status.CancelledRun != 0 {
+		t.Fatalf("cancelled run %v, expected run 0", podflame.Status.CancelledRun)
+	}
+
+	// A rerun profiles the target although cancel can not be unset
+	podflame.Annotations = map[string]string{constants.AnnotationRerun: "1700000000"}
+	if !rerunRequested(podflame) {
+		t.Fatal("rerun not requested")
+	}
+	if err := reconciler.startRun(ctx, podflame); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if cancelRequested(podflame) {
+		t.Fatal("cancel of run 0 requested on run 1")
+	}
+	if _, err := reconciler.reconcilePod(ctx, podflame); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	podflame = stored()
+	if podflame.Status.Run != 1 || podflame.Status.Phase != profilepodiov1alpha1.PodFlameScheduling {
+		t.Fatalf("run %d %s, expected run 1 scheduling", podflame.Status.Run, podflame.Status.Phase)
+	}
+	if len(podflame.Status.History) != 1 || podflame.Status.History[0].Phase != profilepodiov1alpha1.PodFlameCancelled {
+		t.Errorf("history %+v, expected the cancelled run 0", podflame.Status.History)
+	}
+	if len(podflame.Status.Targets) != 1 || podflame.Status.Targets[0].Phase != profilepodiov1alpha1.PodFlameScheduling {
+		t.Fatalf("targets %+v, expected my-app-0 scheduling", podflame.Status.Targets)
+	}
+	agentPod := &corev1.Pod{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "profile-pod", Name: podflame.Status.Targets[0].AgentPod}, agentPod); err != nil {
+		t.Errorf("agent pod of run 1: %s", err)
+	}
+
+	// The stop annotation still stops the next runs
+	podflame.Annotations[constants.AnnotationStop] = ""
+	if !cancelRequested(podflame) {
+		t.Error("stop annotation ignored on run 1")
+	}
+	expectConditions(t, podflame, map[string]metav1.ConditionStatus{ConditionScheduled: metav1.ConditionTrue})
+}
+
+// runHistoryPodFlame returns a finished PodFlame with a full history, whose
+// runs and window results are saved in the store of reconciler.
+func runHistoryPodFlame(t *testing.T, reconciler *PodFlameReconciler) *profilepodiov1alpha1.PodFlame {
+	t.Helper()
+	podflame := testPodFlame("my-app-flame", "0123456789abcdef")
+	podflame.Annotations = map[string]string{constants.AnnotationRerun: "1700000000"}
+	save := func(name string) profilepodiov1alpha1.ResultReference {
+		t.Helper()
+		ref, err := reconciler.ResultStore.Save(context.Background(), podflame, name, profilepodiov1alpha1.FormatHTML, []byte(name))
+		if err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+		return *ref
+	}
+	for run := int64(0); run < runHistoryLimit; run++ {
+		podflame.Status.History = append(podflame.Status.History, profilepodiov1alpha1.RunStatus{
+			Run:     run,
+			Phase:   profilepodiov1alpha1.PodFlameSucceeded,
+			Results: []profilepodiov1alpha1.ResultReference{save(fmt.Sprintf("run-%d-html", run))},
+		})
+	}
+	latest := save("window-1-html")
+	podflame.Status.Run = runHistoryLimit
+	podflame.Status.Phase = profilepodiov1alpha1.PodFlameSucceeded
+	podflame.Status.Targets = []profilepodiov1alpha1.TargetStatus{{
+		PodName: "my-app-0",
+		Phase:   profilepodiov1alpha1.PodFlameSucceeded,
+		Results: []profilepodiov1alpha1.ResultReference{latest},
+		Windows: []profilepodiov1alpha1.WindowStatus{
+			{Index: 0, Results: []profilepodiov1alpha1.ResultReference{save("window-0-html")}},
+			{Index: 1, Results: []profilepodiov1alpha1.ResultReference{latest}},
+		},
+	}}
+	return podflame
+}
+
+func TestStartRunTrimsTheHistory(t *testing.T) {
+	reconciler, clientset := testContinuousReconciler(nil)
+	podflame := runHistoryPodFlame(t, reconciler)
+	reconciler.Client = testClient(podflame.DeepCopy())
+	ctx := context.Background()
+	if err := reconciler.Get(ctx, types.NamespacedName{Namespace: podflame.Namespace, Name: podflame.Name}, podflame); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	results := storedResults(t, clientset)
+
+	if err := reconciler.startRun(ctx, podflame); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	history := podflame.Status.History
+	if len(history) != runHistoryLimit || history[0].Run != 1 || history[len(history)-1].Run != runHistoryLimit {
+		t.Fatalf("history of %d runs from %d, expected the last %d runs", len(history), history[0].Run, runHistoryLimit)
+	}
+	if podflame.Status.Run != runHistoryLimit+1 || podflame.Status.Phase != profilepodiov1alpha1.PodFlamePending || podflame.Status.Targets != nil {
+		t.Errorf("run %d %s with %d targets, expected the next run pending", podflame.Status.Run, podflame.Status.Phase, len(podflame.Status.Targets))
+	}
+
+	// The dropped run and the window the history does not reference are deleted
+	deleted := map[string]bool{
+		resultName(podflame, "run-0-html"):    true,
+		resultName(podflame, "window-0-html"): true,
+	}
+	remaining := storedResults(t, clientset)
+	for name := range results {
+		if remaining[name] == deleted[name] {
+			t.Errorf("result %s stored %t, expected %t", name, remaining[name], !deleted[name])
+		}
+	}
+	if !hasEvent(reconciler.Recorder.(*record.FakeRecorder), ReasonRerun) {
+		t.Errorf("expected a %s event", ReasonRerun)
+	}
+}
+
+func TestStartRunKeepsTheResultsUntilTheStatusIsWritten(t *testing.T) {
+	reconciler, clientset := testContinuousReconciler(nil)
+	podflame := runHistoryPodFlame(t, reconciler)
+	// The PodFlame was deleted, its status can not be written
+	reconciler.Client = testClient()
+	results := storedResults(t, clientset)
+
+	if err := reconciler.startRun(context.Background(), podflame); err == nil {
+		t.Fatal("expected the status update to fail")
+	}
+	if remaining := storedResults(t, clientset); len(remaining) != len(results) {
+		t.Errorf("%d results left of %d, expected them all to be kept", len(remaining), len(results))
+	}
+}
+
+func TestArchiveRun(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition *metav1.Condition
+		reason    string
+		message   string
+	}{
+		{
+			name:      "succeeded",
+			condition: &metav1.Condition{Type: ConditionSucceeded, Status: metav1.ConditionTrue, Reason: "ProfilingSucceeded", Message: "Profiled 1 target"},
+			reason:    "ProfilingSucceeded",
+			message:   "Profiled 1 target",
+		},
+		{
+			name:      "failed",
+			condition: &metav1.Condition{Type: ConditionFailed, Status: metav1.ConditionTrue, Reason: ReasonAgentFailed, Message: "agent exited with 1"},
+			reason:    ReasonAgentFailed,
+			message:   "agent exited with 1",
+		},
+		{
+			name:      "cancelled",
+			condition: &metav1.Condition{Type: ConditionCancelled, Status: metav1.ConditionTrue, Reason: "Cancelled", Message: "Cancelled by spec.cancel"},
+			reason:    "Cancelled",
+			message:   "Cancelled by spec.cancel",
+		},
+		{
+			name:      "without terminal condition",
+			condition: &metav1.Condition{Type: ConditionScheduled, Status: metav1.ConditionTrue, Reason: "Scheduled", Message: "Agent scheduled"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			podflame := testPodFlame("my-app-flame", "0123456789abcdef")
+			podflame.Status.Run = 3
+			podflame.Status.RerunNonce = "1700000000"
+			podflame.Status.Phase = profilepodiov1alpha1.PodFlameSucceeded
+			podflame.Status.Conditions = []metav1.Condition{*test.condition}
+			ref := profilepodiov1alpha1.ResultReference{Name: "my-app-html", Format: profilepodiov1alpha1.FormatHTML}
+			podflame.Status.Targets = []profilepodiov1alpha1.TargetStatus{{PodName: "my-app-0", Phase: profilepodiov1alpha1.PodFlameSucceeded, Results: []profilepodiov1alpha1.ResultReference{ref}}}
+
+			run := archiveRun(podflame)
+			if run.Reason != test.reason || run.Message != test.message {
+				t.Errorf("run reason %q message %q, expected %q %q", run.Reason, run.Message, test.reason, test.message)
+			}
+			if run.Run != 3 || run.RerunNonce != "1700000000" || run.Phase != profilepodiov1alpha1.PodFlameSucceeded {
+				t.Errorf("archived run %d nonce %s %s", run.Run, run.RerunNonce, run.Phase)
+			}
+			if len(run.Targets) != 1 || run.Targets[0].PodName != "my-app-0" || len(run.Targets[0].Results) != 1 || run.Targets[0].Results[0] != ref {
+				t.Errorf("archived targets %+v", run.Targets)
+			}
+		})
+	}
+}
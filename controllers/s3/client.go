@@ -0,0 +1,177 @@
+// Package s3 is a minimal client for S3-compatible object storage, such as AWS
+// S3 or MinIO. It signs requests with AWS Signature Version 4 and addresses
+// buckets in the path style, which every S3-compatible endpoint supports.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client reads and writes the objects of an S3-compatible endpoint.
+type Client struct {
+	// Endpoint is the base URL of the endpoint, e.g. https://s3.us-east-1.amazonaws.com
+	Endpoint *url.URL
+	// Region is the region requests are signed for
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is the optional token of temporary credentials
+	SessionToken string
+	HTTPClient   *http.Client
+}
+
+// Error is an error response of the endpoint.
+type Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (err *Error) Error() string {
+	if err.Code == "" {
+		return fmt.Sprintf("s3: %s", http.StatusText(err.StatusCode))
+	}
+	return fmt.Sprintf("s3: %s: %s", err.Code, err.Message)
+}
+
+// IsNotFound reports whether err is returned for a missing bucket or object.
+func IsNotFound(err error) bool {
+	s3Err, ok := err.(*Error)
+	return ok && s3Err.StatusCode == http.StatusNotFound
+}
+
+// PutObject uploads data as the object key of bucket, with the optional
+// contentType and contentEncoding of data.
+func (client *Client) PutObject(ctx context.Context, bucket, key string, data []byte, contentType, contentEncoding string) error {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	if contentEncoding != "" {
+		header.Set("Content-Encoding", contentEncoding)
+	}
+	response, err := client.do(ctx, http.MethodPut, client.objectURL(bucket, key, nil), header, data)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// GetObject downloads the object key of bucket, as it was uploaded. The data
+// of an object uploaded with a content encoding is not decoded.
+func (client *Client) GetObject(ctx context.Context, bucket, key string) ([]byte, error) {
+	// Without an Accept-Encoding header the transport of Go would ask for gzip and
+	// decode the objects stored with Content-Encoding gzip
+	header := http.Header{"Accept-Encoding": {"identity"}}
+	response, err := client.do(ctx, http.MethodGet, client.objectURL(bucket, key, nil), header, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	return io.ReadAll(response.Body)
+}
+
+// DeleteObject deletes the object key of bucket. Deleting a missing object succeeds.
+func (client *Client) DeleteObject(ctx context.Context, bucket, key string) error {
+	response, err := client.do(ctx, http.MethodDelete, client.objectURL(bucket, key, nil), nil, nil)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// ListObjects returns the keys of the objects of bucket starting with prefix.
+func (client *Client) ListObjects(ctx context.Context, bucket, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		response, err := client.do(ctx, http.MethodGet, client.objectURL(bucket, "", query), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(response.Body).Decode(&result)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// PresignGetObject returns a URL downloading the object key of bucket without
+// credentials until expiry elapsed.
+func (client *Client) PresignGetObject(bucket, key string, expiry time.Duration) string {
+	target := client.objectURL(bucket, key, nil)
+	client.presign(http.MethodGet, target, expiry, time.Now())
+	return target.String()
+}
+
+// objectURL returns the path style URL of the object key of bucket.
+func (client *Client) objectURL(bucket, key string, query url.Values) *url.URL {
+	target := *client.Endpoint
+	target.Path = strings.TrimSuffix(target.Path, "/") + "/" + bucket
+	if key != "" {
+		target.Path += "/" + key
+	}
+	target.RawPath = escapePath(target.Path)
+	target.RawQuery = encodeQuery(query)
+	return &target
+}
+
+// do sends a signed request and turns error responses into an *Error.
+func (client *Client) do(ctx context.Context, method string, target *url.URL, header http.Header, body []byte) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	request.ContentLength = int64(len(body))
+	client.sign(request, body, time.Now())
+
+	httpClient := client.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 300 {
+		defer response.Body.Close()
+		s3Err := &Error{StatusCode: response.StatusCode}
+		if data, err := io.ReadAll(response.Body); err == nil && len(data) > 0 {
+			_ = xml.Unmarshal(data, s3Err)
+		}
+		return nil, s3Err
+	}
+	return response, nil
+}
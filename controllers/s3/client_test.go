@@ -0,0 +1,88 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// verifySignature recomputes the signature of a request received by a server.
+func verifySignature(t *testing.T, client *Client, request *http.Request, body []byte) {
+	t.Helper()
+	if hash := request.Header.Get("X-Amz-Content-Sha256"); hash != hashHex(body) {
+		t.Errorf("payload hash %s does not match the body", hash)
+	}
+	now, err := time.Parse(amzDateFormat, request.Header.Get("X-Amz-Date"))
+	if err != nil {
+		t.Fatalf("invalid date: %s", err)
+	}
+	received := request.Clone(context.Background())
+	received.URL = &url.URL{Path: request.URL.Path, RawQuery: request.URL.RawQuery}
+	received.Header.Set("Host", request.Host)
+	canonical, signedHeaders := canonicalRequest(received, hashHex(body))
+	scope := client.scope(now)
+	expected := "AWS4-HMAC-SHA256 Credential=" + client.AccessKeyID + "/" + scope +
+		", SignedHeaders=" + signedHeaders + ", Signature=" + client.signature(now, scope, canonical)
+	if authorization := request.Header.Get("Authorization"); authorization != expected {
+		t.Errorf("authorization:\n%s\nexpected:\n%s", authorization, expected)
+	}
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	objects := map[string][]byte{}
+	var client *Client
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verifySignature(t, client, r, body)
+		switch r.Method {
+		case http.MethodPut:
+			if r.Header.Get("Content-Encoding") != "gzip" || r.Header.Get("Content-Type") != "text/html" {
+				t.Errorf("unexpected headers %v", r.Header)
+			}
+			objects[r.URL.Path] = body
+		case http.MethodGet:
+			data, found := objects[r.URL.Path]
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = io.WriteString(w, "<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>")
+				return
+			}
+			if r.Header.Get("Accept-Encoding") != "identity" {
+				t.Errorf("object requested with Accept-Encoding %q", r.Header.Get("Accept-Encoding"))
+			}
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(data)
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+	endpoint, _ := url.Parse(server.URL + "/minio")
+	client = &Client{Endpoint: endpoint, Region: "us-east-1", AccessKeyID: "minio", SecretAccessKey: "minio123", SessionToken: "token"}
+	ctx := context.Background()
+
+	key := "results/my-app namespace/my-app-flame/pod$1-html.gz"
+	if err := client.PutObject(ctx, "profiles", key, []byte("profile"), "text/html", "gzip"); err != nil {
+		t.Fatalf("put failed: %s", err)
+	}
+	if _, found := objects["/minio/profiles/"+key]; !found {
+		t.Fatalf("object stored under %v", objects)
+	}
+	data, err := client.GetObject(ctx, "profiles", key)
+	if err != nil || string(data) != "profile" {
+		t.Fatalf("get returned %q, %v", data, err)
+	}
+	if err := client.DeleteObject(ctx, "profiles", key); err != nil {
+		t.Fatalf("delete failed: %s", err)
+	}
+	_, err = client.GetObject(ctx, "profiles", key)
+	if !IsNotFound(err) || !strings.Contains(err.Error(), "NoSuchKey") {
+		t.Errorf("expected a NoSuchKey error, got %v", err)
+	}
+}
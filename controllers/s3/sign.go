@@ -0,0 +1,172 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm       = "AWS4-HMAC-SHA256"
+	service         = "s3"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat   = "20060102T150405Z"
+	shortDateFormat = "20060102"
+)
+
+// sign adds the Signature Version 4 authorization of body to request.
+func (client *Client) sign(request *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	payloadHash := hashHex(body)
+	request.Header.Set("Host", request.URL.Host)
+	request.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if client.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", client.SessionToken)
+	}
+
+	canonicalRequest, signedHeaders := canonicalRequest(request, payloadHash)
+	scope := client.scope(now)
+	signature := client.signature(now, scope, canonicalRequest)
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, client.AccessKeyID, scope, signedHeaders, signature))
+	// Go sends the Host header from the URL
+	request.Header.Del("Host")
+}
+
+// canonicalRequest returns the canonical request of request and the names of
+// its signed headers: host, content-type and the x-amz- headers.
+func canonicalRequest(request *http.Request, payloadHash string) (string, string) {
+	var names []string
+	for name := range request.Header {
+		lower := strings.ToLower(name)
+		if lower == "host" || lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(request.Header.Get(name)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	return strings.Join([]string{
+		request.Method,
+		escapePath(request.URL.Path),
+		encodeQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n"), signedHeaders
+}
+
+// presign adds the query parameters authorizing a request of method to target
+// for expiry, signing only its host.
+func (client *Client) presign(method string, target *url.URL, expiry time.Duration, now time.Time) {
+	now = now.UTC()
+	scope := client.scope(now)
+	query := target.Query()
+	query.Set("X-Amz-Algorithm", algorithm)
+	query.Set("X-Amz-Credential", client.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", now.Format(amzDateFormat))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expiry/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if client.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", client.SessionToken)
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		escapePath(target.Path),
+		encodeQuery(query),
+		"host:" + target.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	query.Set("X-Amz-Signature", client.signature(now, scope, canonicalRequest))
+	target.RawQuery = encodeQuery(query)
+}
+
+func (client *Client) scope(now time.Time) string {
+	return strings.Join([]string{now.Format(shortDateFormat), client.Region, service, "aws4_request"}, "/")
+}
+
+// stringToSign returns the string signed for canonicalRequest.
+func stringToSign(now time.Time, scope, canonicalRequest string) string {
+	return strings.Join([]string{
+		algorithm,
+		now.Format(amzDateFormat),
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+}
+
+// signature returns the hex encoded signature of canonicalRequest.
+func (client *Client) signature(now time.Time, scope, canonicalRequest string) string {
+	key := hmacSHA256([]byte("AWS4"+client.SecretAccessKey), now.Format(shortDateFormat))
+	key = hmacSHA256(key, client.Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign(now, scope, canonicalRequest)))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// escapePath URI encodes every byte of path except the unreserved characters and '/'.
+func escapePath(path string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c == '/' || isUnreserved(c) {
+			escaped.WriteByte(c)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
+
+// encodeQuery encodes query sorted by key, URI encoding every byte except the
+// unreserved characters.
+func encodeQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, escape(key)+"="+escape(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func escape(value string) string {
+	return strings.ReplaceAll(escapePath(value), "/", "%2F")
+}
+
+func isUnreserved(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '_' || c == '.' || c == '~'
+}
@@ -0,0 +1,142 @@
+package stacks
+
+import (
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the pprof profile.proto messages.
+const (
+	profileSampleType  = 1
+	profileSample      = 2
+	profileLocation    = 4
+	profileFunction    = 5
+	profileStringTable = 6
+	profilePeriodType  = 11
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+)
+
+// pprofBuilder interns the strings and functions of a pprof profile.
+type pprofBuilder struct {
+	strings   []string
+	stringIDs map[string]int64
+	functions []string
+	ids       map[string]uint64
+}
+
+func (builder *pprofBuilder) stringID(s string) int64 {
+	id, found := builder.stringIDs[s]
+	if !found {
+		id = int64(len(builder.strings))
+		builder.strings = append(builder.strings, s)
+		builder.stringIDs[s] = id
+	}
+	return id
+}
+
+// function returns the id of the function called name, which is also the id
+// of its single location.
+func (builder *pprofBuilder) function(name string) uint64 {
+	id, found := builder.ids[name]
+	if !found {
+		builder.functions = append(builder.functions, name)
+		id = uint64(len(builder.functions))
+		builder.ids[name] = id
+	}
+	return id
+}
+
+// MarshalPprof encodes stacks as an uncompressed pprof profile, whose samples
+// hold a single value of sampleType expressed in unit, e.g. cpu and count.
+func (stacks Stacks) MarshalPprof(sampleType, unit string) []byte {
+	builder := &pprofBuilder{
+		strings:   []string{""},
+		stringIDs: map[string]int64{"": 0},
+		ids:       map[string]uint64{},
+	}
+	typeID, unitID := builder.stringID(sampleType), builder.stringID(unit)
+
+	var profile []byte
+	valueType := valueTypeMessage(typeID, unitID)
+	profile = protowire.AppendTag(profile, profileSampleType, protowire.BytesType)
+	profile = protowire.AppendBytes(profile, valueType)
+
+	keys := make([]string, 0, len(stacks))
+	for stack := range stacks {
+		keys = append(keys, stack)
+	}
+	sort.Strings(keys)
+	for _, stack := range keys {
+		frames := strings.Split(stack, ";")
+		var locations []byte
+		// pprof lists the locations of a sample from the leaf to the root
+		for i := len(frames) - 1; i >= 0; i-- {
+			locations = protowire.AppendVarint(locations, builder.function(frames[i]))
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, sampleLocationID, protowire.BytesType)
+		sample = protowire.AppendBytes(sample, locations)
+		sample = protowire.AppendTag(sample, sampleValue, protowire.BytesType)
+		sample = protowire.AppendBytes(sample, protowire.AppendVarint(nil, uint64(stacks[stack])))
+		profile = protowire.AppendTag(profile, profileSample, protowire.BytesType)
+		profile = protowire.AppendBytes(profile, sample)
+	}
+
+	for i, name := range builder.functions {
+		id := uint64(i + 1)
+		var line []byte
+		line = protowire.AppendTag(line, lineFunctionID, protowire.VarintType)
+		line = protowire.AppendVarint(line, id)
+		var location []byte
+		location = protowire.AppendTag(location, locationID, protowire.VarintType)
+		location = protowire.AppendVarint(location, id)
+		location = protowire.AppendTag(location, locationLine, protowire.BytesType)
+		location = protowire.AppendBytes(location, line)
+		profile = protowire.AppendTag(profile, profileLocation, protowire.BytesType)
+		profile = protowire.AppendBytes(profile, location)
+
+		nameID := uint64(builder.stringID(name))
+		var function []byte
+		function = protowire.AppendTag(function, functionID, protowire.VarintType)
+		function = protowire.AppendVarint(function, id)
+		function = protowire.AppendTag(function, functionName, protowire.VarintType)
+		function = protowire.AppendVarint(function, nameID)
+		function = protowire.AppendTag(function, functionSystemName, protowire.VarintType)
+		function = protowire.AppendVarint(function, nameID)
+		profile = protowire.AppendTag(profile, profileFunction, protowire.BytesType)
+		profile = protowire.AppendBytes(profile, function)
+	}
+
+	profile = protowire.AppendTag(profile, profilePeriodType, protowire.BytesType)
+	profile = protowire.AppendBytes(profile, valueType)
+	for _, s := range builder.strings {
+		profile = protowire.AppendTag(profile, profileStringTable, protowire.BytesType)
+		profile = protowire.AppendString(profile, s)
+	}
+	return profile
+}
+
+func valueTypeMessage(typeID, unitID int64) []byte {
+	var valueType []byte
+	valueType = protowire.AppendTag(valueType, valueTypeType, protowire.VarintType)
+	valueType = protowire.AppendVarint(valueType, uint64(typeID))
+	valueType = protowire.AppendTag(valueType, valueTypeUnit, protowire.VarintType)
+	valueType = protowire.AppendVarint(valueType, uint64(unitID))
+	return valueType
+}
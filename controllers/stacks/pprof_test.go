@@ -0,0 +1,80 @@
+package stacks
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+func TestMarshalPprof(t *testing.T) {
+	stacks := Stacks{
+		"main;handle;parse":        42,
+		"main;handle;write":        8,
+		"main;gc":                  1,
+		"java.lang.Thread.run;run": 3,
+	}
+	parsed, err := profile.ParseData(stacks.MarshalPprof("cpu", "count"))
+	if err != nil {
+		t.Fatalf("the pprof library can not parse the profile: %s", err)
+	}
+	if err := parsed.CheckValid(); err != nil {
+		t.Fatalf("invalid profile: %s", err)
+	}
+	if len(parsed.SampleType) != 1 || parsed.SampleType[0].Type != "cpu" || parsed.SampleType[0].Unit != "count" {
+		t.Errorf("sample types = %v", parsed.SampleType)
+	}
+	if parsed.PeriodType == nil || parsed.PeriodType.Type != "cpu" || parsed.PeriodType.Unit != "count" {
+		t.Errorf("period type = %v", parsed.PeriodType)
+	}
+
+	decoded := Stacks{}
+	for _, sample := range parsed.Sample {
+		if len(sample.Value) != 1 {
+			t.Fatalf("sample holds %d values", len(sample.Value))
+		}
+		var frames []string
+		// pprof lists the locations from the leaf to the root
+		for i := len(sample.Location) - 1; i >= 0; i-- {
+			lines := sample.Location[i].Line
+			if len(lines) != 1 {
+				t.Fatalf("location %d holds %d lines", sample.Location[i].ID, len(lines))
+			}
+			frames = append(frames, lines[0].Function.Name)
+		}
+		decoded[strings.Join(frames, ";")] += sample.Value[0]
+	}
+	if len(decoded) != len(stacks) {
+		t.Fatalf("decoded %v, expected %v", decoded, stacks)
+	}
+	for stack, count := range stacks {
+		if decoded[stack] != count {
+			t.Errorf("value of %s = %d, expected %d", stack, decoded[stack], count)
+		}
+	}
+
+	// Every function is listed once, whatever the number of stacks it appears in
+	names := map[string]bool{}
+	for _, function := range parsed.Function {
+		if names[function.Name] {
+			t.Errorf("function %s is listed twice", function.Name)
+		}
+		names[function.Name] = true
+		if function.SystemName != function.Name {
+			t.Errorf("system name of %s = %s", function.Name, function.SystemName)
+		}
+	}
+	if len(names) != 7 {
+		t.Errorf("functions = %v, expected 7", names)
+	}
+}
+
+func TestMarshalPprofEmpty(t *testing.T) {
+	parsed, err := profile.ParseData(Stacks{}.MarshalPprof("alloc", "bytes"))
+	if err != nil {
+		t.Fatalf("the pprof library can not parse the profile: %s", err)
+	}
+	if len(parsed.Sample) != 0 || parsed.SampleType[0].Unit != "bytes" {
+		t.Errorf("unexpected profile %v", parsed)
+	}
+}
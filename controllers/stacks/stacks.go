@@ -0,0 +1,120 @@
+// Package stacks handles profiles in the collapsed stack format produced by
+// the agent, where every line holds a semicolon separated stack followed by
+// its sample count, e.g. "main;foo;bar 42".
+package stacks
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Stacks maps a collapsed stack to its sample count.
+type Stacks map[string]int64
+
+// Parse reads collapsed stacks from r. Frames may contain spaces, the sample
+// count is the text after the last space of a line. The counts of repeated
+// stacks are summed.
+func Parse(r io.Reader) (Stacks, error) {
+	stacks := Stacks{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		separator := strings.LastIndexByte(text, ' ')
+		if separator < 0 {
+			return nil, fmt.Errorf("line %d: missing sample count", line)
+		}
+		count, err := strconv.ParseInt(text[separator+1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid sample count: %w", line, err)
+		}
+		if count < 0 {
+			return nil, fmt.Errorf("line %d: negative sample count %d", line, count)
+		}
+		stacks.add(text[:separator], count)
+	}
+	return stacks, scanner.Err()
+}
+
+// Add merges other into stacks, prefixing every stack of other with rootFrames.
+func (stacks Stacks) Add(other Stacks, rootFrames ...string) {
+	prefix := ""
+	for _, frame := range rootFrames {
+		prefix += frame + ";"
+	}
+	for stack, count := range other {
+		stacks.add(prefix+stack, count)
+	}
+}
+
+// add adds count to the count of stack, saturating instead of overflowing.
+func (stacks Stacks) add(stack string, count int64) {
+	if stacks[stack] > math.MaxInt64-count {
+		stacks[stack] = math.MaxInt64
+		return
+	}
+	stacks[stack] += count
+}
+
+// Total returns the sum of all sample counts, saturating instead of overflowing.
+func (stacks Stacks) Total() int64 {
+	var total int64
+	for _, count := range stacks {
+		if total > math.MaxInt64-count {
+			return math.MaxInt64
+		}
+		total += count
+	}
+	return total
+}
+
+// WriteTo writes stacks to w in the collapsed format, sorted by stack.
+func (stacks Stacks) WriteTo(w io.Writer) (int64, error) {
+	keys := make([]string, 0, len(stacks))
+	for stack := range stacks {
+		keys = append(keys, stack)
+	}
+	sort.Strings(keys)
+	var written int64
+	for _, stack := range keys {
+		n, err := fmt.Fprintf(w, "%s %d\n", stack, stacks[stack])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Decompress gunzips data, the way the agent compresses its results.
+func Decompress(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// Compress gzips data, the way the agent compresses its results.
+func Compress(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
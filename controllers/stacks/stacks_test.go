@@ -0,0 +1,123 @@
+package stacks
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Stacks
+		err      string
+	}{
+		{
+			name:     "stacks",
+			input:    "main;foo;bar 42\nmain;foo 8\n",
+			expected: Stacks{"main;foo;bar": 42, "main;foo": 8},
+		},
+		{
+			name:     "repeated stacks are summed",
+			input:    "main;foo 1\n\n  main;foo 2  \n",
+			expected: Stacks{"main;foo": 3},
+		},
+		{
+			name:     "frames containing spaces",
+			input:    "java.lang.Thread.run;void com.example.App.handle(Request req) 7\n",
+			expected: Stacks{"java.lang.Thread.run;void com.example.App.handle(Request req)": 7},
+		},
+		{name: "missing count", input: "main;foo\n", err: "line 1: missing sample count"},
+		{name: "invalid count", input: "main 1\nmain;foo bar\n", err: "line 2: invalid sample count"},
+		{name: "negative count", input: "main -1\n", err: "line 1: negative sample count"},
+		{name: "count out of range", input: "main 9223372036854775808\n", err: "line 1: invalid sample count"},
+		{name: "count without stack", input: "main 1\n\t 2\n", err: "line 2: missing sample count"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stacks, err := Parse(strings.NewReader(test.input))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if len(stacks) != len(test.expected) {
+				t.Fatalf("parsed %v, expected %v", stacks, test.expected)
+			}
+			for stack, count := range test.expected {
+				if stacks[stack] != count {
+					t.Errorf("count of %q = %d, expected %d", stack, stacks[stack], count)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSaturates(t *testing.T) {
+	stacks, err := Parse(strings.NewReader("main 9223372036854775807\nmain 1\n"))
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if stacks["main"] != math.MaxInt64 {
+		t.Errorf("count = %d, expected it to saturate", stacks["main"])
+	}
+}
+
+func TestAdd(t *testing.T) {
+	merged := Stacks{"main;foo": 1}
+	merged.Add(Stacks{"main;foo": 2, "main;bar": 3})
+	merged.Add(Stacks{"main;foo": 4}, "my-app-0", "app")
+	merged.Add(Stacks{"main": math.MaxInt64}, "my-app-0", "app")
+	merged.Add(Stacks{"main": 1}, "my-app-0", "app")
+
+	expected := Stacks{"main;foo": 3, "main;bar": 3, "my-app-0;app;main;foo": 4, "my-app-0;app;main": math.MaxInt64}
+	if len(merged) != len(expected) {
+		t.Fatalf("merged %v, expected %v", merged, expected)
+	}
+	for stack, count := range expected {
+		if merged[stack] != count {
+			t.Errorf("count of %q = %d, expected %d", stack, merged[stack], count)
+		}
+	}
+	if total := merged.Total(); total != math.MaxInt64 {
+		t.Errorf("total = %d, expected it to saturate", total)
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	stacks := Stacks{"main;foo bar": 2, "main": 1}
+	var buffer bytes.Buffer
+	written, err := stacks.WriteTo(&buffer)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	expected := "main 1\nmain;foo bar 2\n"
+	if buffer.String() != expected || written != int64(len(expected)) {
+		t.Errorf("wrote %q (%d bytes), expected %q", buffer.String(), written, expected)
+	}
+
+	parsed, err := Parse(&buffer)
+	if err != nil || len(parsed) != 2 || parsed["main;foo bar"] != 2 {
+		t.Errorf("round trip parsed %v, %v", parsed, err)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	compressed, err := Compress([]byte("main 1\n"))
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	data, err := Decompress(compressed)
+	if err != nil || string(data) != "main 1\n" {
+		t.Errorf("decompressed %q, %v", data, err)
+	}
+	if _, err := Decompress([]byte("main 1\n")); err == nil {
+		t.Error("expected an error for data that is not gzipped")
+	}
+}
@@ -0,0 +1,144 @@
+package stacks
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	svgWidth       = 1200
+	svgFrameHeight = 16
+	svgPadding     = 10
+	svgTitleHeight = 40
+	svgFontSize    = 12
+	// svgCharWidth is the approximate width of a character of the frame labels
+	svgCharWidth = 7
+	// svgMinWidth is the narrowest frame drawn, in pixels
+	svgMinWidth = 0.1
+)
+
+// frame is a node of the tree of stacks, holding the samples of every stack
+// going through it.
+type frame struct {
+	name     string
+	value    int64
+	children map[string]*frame
+}
+
+func (parent *frame) child(name string) *frame {
+	if parent.children == nil {
+		parent.children = map[string]*frame{}
+	}
+	node, found := parent.children[name]
+	if !found {
+		node = &frame{name: name}
+		parent.children[name] = node
+	}
+	return node
+}
+
+// sortedChildren returns the children of parent sorted by name, the way
+// flamegraph.pl orders frames.
+func (parent *frame) sortedChildren() []*frame {
+	children := make([]*frame, 0, len(parent.children))
+	for _, child := range parent.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].name < children[j].name })
+	return children
+}
+
+func (parent *frame) depth() int {
+	depth := 0
+	for _, child := range parent.children {
+		if childDepth := child.depth() + 1; childDepth > depth {
+			depth = childDepth
+		}
+	}
+	return depth
+}
+
+// tree builds the tree of stacks under a root frame called "all".
+func (stacks Stacks) tree() *frame {
+	root := &frame{name: "all"}
+	for stack, count := range stacks {
+		root.value += count
+		node := root
+		for _, name := range strings.Split(stack, ";") {
+			node = node.child(name)
+			node.value += count
+		}
+	}
+	return root
+}
+
+// WriteSVG renders stacks as a flame graph, with the sample values expressed in units.
+func (stacks Stacks) WriteSVG(w io.Writer, title, units string) error {
+	root := stacks.tree()
+	height := svgTitleHeight + (root.depth()+1)*svgFrameHeight + 2*svgPadding
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, `<?xml version="1.0" standalone="no"?>`+"\n")
+	fmt.Fprintf(out, `<svg version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg">`+"\n",
+		svgWidth, height, svgWidth, height)
+	fmt.Fprintf(out, `<rect x="0" y="0" width="100%%" height="100%%" fill="#f8f8f8"/>`+"\n")
+	fmt.Fprintf(out, `<text x="%d" y="24" font-size="17" font-family="Verdana" text-anchor="middle">%s</text>`+"\n",
+		svgWidth/2, html.EscapeString(title))
+	if root.value > 0 {
+		scale := float64(svgWidth-2*svgPadding) / float64(root.value)
+		writeFrame(out, root, root.value, units, float64(svgPadding), height-svgPadding-svgFrameHeight, scale)
+	}
+	fmt.Fprintf(out, "</svg>\n")
+	return out.Flush()
+}
+
+// writeFrame draws node at x, y and its children above it.
+func writeFrame(out *bufio.Writer, node *frame, total int64, units string, x float64, y int, scale float64) {
+	width := float64(node.value) * scale
+	if width < svgMinWidth {
+		return
+	}
+	name := html.EscapeString(node.name)
+	fmt.Fprintf(out, `<g><title>%s (%d %s, %.2f%%)</title>`, name, node.value, units, 100*float64(node.value)/float64(total))
+	fmt.Fprintf(out, `<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s" rx="2" ry="2"/>`,
+		x, y, width, svgFrameHeight-1, frameColor(node.name))
+	if chars := int(width) / svgCharWidth; chars >= 3 {
+		label := node.name
+		if len(label) > chars {
+			label = label[:chars-2] + ".."
+		}
+		fmt.Fprintf(out, `<text x="%.1f" y="%d" font-size="%d" font-family="Verdana">%s</text>`,
+			x+3, y+svgFontSize, svgFontSize, html.EscapeString(label))
+	}
+	fmt.Fprintf(out, "</g>\n")
+	for _, child := range node.sortedChildren() {
+		writeFrame(out, child, total, units, x, y-svgFrameHeight, scale)
+		x += float64(child.value) * scale
+	}
+}
+
+// frameColor returns a warm color derived from name, so a function keeps its
+// color across flame graphs.
+func frameColor(name string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(name))
+	sum := hash.Sum32()
+	return fmt.Sprintf("rgb(%d,%d,%d)", 205+sum%50, (sum>>8)%230, (sum>>16)%55)
+}
+
+// WriteHTML renders stacks as a flame graph embedded in an HTML page.
+func (stacks Stacks) WriteHTML(w io.Writer, title, units string) error {
+	escaped := html.EscapeString(title)
+	if _, err := fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n", escaped); err != nil {
+		return err
+	}
+	if err := stacks.WriteSVG(w, title, units); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "</body>\n</html>\n")
+	return err
+}
@@ -0,0 +1,130 @@
+package stacks
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// svgFrame is a frame drawn in a flame graph.
+type svgFrame struct {
+	Title string `xml:"title"`
+	Rect  struct {
+		X     float64 `xml:"x,attr"`
+		Y     int     `xml:"y,attr"`
+		Width float64 `xml:"width,attr"`
+	} `xml:"rect"`
+	Text string `xml:"text"`
+}
+
+// parseSVG returns the frames of the flame graph svg, keyed by title.
+func parseSVG(t *testing.T, svg []byte) map[string]svgFrame {
+	t.Helper()
+	decoder := xml.NewDecoder(bytes.NewReader(svg))
+	frames := map[string]svgFrame{}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return frames
+		}
+		if err != nil {
+			t.Fatalf("invalid svg: %s", err)
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "g" {
+			var frame svgFrame
+			if err := decoder.DecodeElement(&frame, &start); err != nil {
+				t.Fatalf("invalid frame: %s", err)
+			}
+			frames[frame.Title] = frame
+		}
+	}
+}
+
+func TestWriteSVG(t *testing.T) {
+	stacks := Stacks{
+		"main;handle;parse": 30,
+		"main;handle;write": 10,
+		"main;<lambda>":     40,
+		"main;tiny":         0,
+	}
+	var buffer bytes.Buffer
+	if err := stacks.WriteSVG(&buffer, "CPU <my-app>", "samples"); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	frames := parseSVG(t, buffer.Bytes())
+	if !strings.Contains(buffer.String(), "CPU &lt;my-app&gt;") {
+		t.Error("the title is not escaped")
+	}
+
+	expected := []struct {
+		title string
+		width float64
+		depth int
+	}{
+		{title: "all (80 samples, 100.00%)", width: 1180, depth: 0},
+		{title: "main (80 samples, 100.00%)", width: 1180, depth: 1},
+		{title: "<lambda> (40 samples, 50.00%)", width: 590, depth: 2},
+		{title: "handle (40 samples, 50.00%)", width: 590, depth: 2},
+		{title: "parse (30 samples, 37.50%)", width: 442.5, depth: 3},
+		{title: "write (10 samples, 12.50%)", width: 147.5, depth: 3},
+	}
+	if len(frames) != len(expected) {
+		t.Errorf("drew %d frames, expected %d without the empty one", len(frames), len(expected))
+	}
+	bottom := frames[expected[0].title].Rect.Y
+	for _, e := range expected {
+		frame, found := frames[e.title]
+		if !found {
+			t.Errorf("frame %q is missing", e.title)
+			continue
+		}
+		if frame.Rect.Width != e.width {
+			t.Errorf("width of %q = %.1f, expected %.1f", e.title, frame.Rect.Width, e.width)
+		}
+		if y := bottom - e.depth*svgFrameHeight; frame.Rect.Y != y {
+			t.Errorf("y of %q = %d, expected %d", e.title, frame.Rect.Y, y)
+		}
+	}
+	// Children are laid out by name from the left of their parent
+	if lambda, handle := frames[expected[2].title], frames[expected[3].title]; lambda.Rect.X != svgPadding || handle.Rect.X != svgPadding+590 {
+		t.Errorf("x of <lambda> = %.1f, of handle = %.1f", lambda.Rect.X, handle.Rect.X)
+	}
+	if parse, write := frames[expected[4].title], frames[expected[5].title]; write.Rect.X != parse.Rect.X+parse.Rect.Width {
+		t.Errorf("write starts at %.1f, expected after parse", write.Rect.X)
+	}
+}
+
+func TestWriteSVGLabels(t *testing.T) {
+	long := strings.Repeat("x", 200)
+	var buffer bytes.Buffer
+	if err := (Stacks{"main;" + long: 99, "main;short": 1}).WriteSVG(&buffer, "labels", "samples"); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	frames := parseSVG(t, buffer.Bytes())
+	frame := frames[long+" (99 samples, 99.00%)"]
+	chars := int(frame.Rect.Width) / svgCharWidth
+	if frame.Text != strings.Repeat("x", chars-2)+".." {
+		t.Errorf("label = %q, expected %d characters ending with ..", frame.Text, chars)
+	}
+	// A frame too narrow for 3 characters has no label
+	if short := frames["short (1 samples, 1.00%)"]; short.Text != "" {
+		t.Errorf("label of a narrow frame = %q", short.Text)
+	}
+}
+
+func TestWriteSVGEmpty(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := (Stacks{}).WriteSVG(&buffer, "empty", "samples"); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if frames := parseSVG(t, buffer.Bytes()); len(frames) != 0 {
+		t.Errorf("drew %d frames for no samples", len(frames))
+	}
+	height := strconv.Itoa(svgTitleHeight + svgFrameHeight + 2*svgPadding)
+	if !strings.Contains(buffer.String(), `height="`+height+`"`) {
+		t.Errorf("unexpected svg %s", buffer.String())
+	}
+}
@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ConditionScheduled is true once the targets are resolved and their agent pods created
+	ConditionScheduled = "Scheduled"
+	// ConditionRunning is true while at least one agent pod is profiling its target
+	ConditionRunning = "Running"
+	// ConditionSucceeded is true once a flame graph was produced
+	ConditionSucceeded = "Succeeded"
+	// ConditionFailed is true once profiling failed for every target
+	ConditionFailed = "Failed"
+	// ConditionCancelled is true once profiling was cancelled
+	ConditionCancelled = "Cancelled"
+
+	ReasonPending            = "Pending"
+	ReasonInvalidSpec        = "InvalidSpec"
+	ReasonTargetNotFound     = "TargetNotFound"
+	ReasonAgentsCreated      = "AgentsCreated"
+	ReasonAgentsRunning      = "AgentsRunning"
+	ReasonAgentFailed        = "AgentFailed"
+	ReasonProfileSucceeded   = "ProfileSucceeded"
+	ReasonPartiallySucceeded = "PartiallySucceeded"
+	ReasonProfileFailed      = "ProfileFailed"
+	ReasonResultCorrupt      = "ResultCorrupt"
+	ReasonCancelled          = "Cancelled"
+)
+
+// updateStatus writes the status of podflame, recording the generation it was derived from.
+func (reconciler *PodFlameReconciler) updateStatus(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame) error {
+	podflame.Status.ObservedGeneration = podflame.Generation
+	return reconciler.Status().Update(ctx, podflame)
+}
+
+func setCondition(podflame *profilepodiov1alpha1.PodFlame, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&podflame.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: podflame.Generation,
+	})
+}
+
+// isFinished reports whether podflame reached a terminal phase.
+func isFinished(podflame *profilepodiov1alpha1.PodFlame) bool {
+	switch podflame.Status.Phase {
+	case profilepodiov1alpha1.PodFlameSucceeded, profilepodiov1alpha1.PodFlameFailed, profilepodiov1alpha1.PodFlameCancelled:
+		return true
+	}
+	return false
+}
+
+func targetFinished(target *profilepodiov1alpha1.TargetStatus) bool {
+	switch target.Phase {
+	case profilepodiov1alpha1.PodFlameSucceeded, profilepodiov1alpha1.PodFlameFailed, profilepodiov1alpha1.PodFlameCancelled:
+		return true
+	}
+	return false
+}
+
+// terminalConditions are the conditions that are true in the terminal phases.
+var terminalConditions = []struct {
+	phase         profilepodiov1alpha1.PodFlamePhase
+	conditionType string
+}{
+	{profilepodiov1alpha1.PodFlameSucceeded, ConditionSucceeded},
+	{profilepodiov1alpha1.PodFlameFailed, ConditionFailed},
+	{profilepodiov1alpha1.PodFlameCancelled, ConditionCancelled},
+}
+
+// startPending moves podflame to the Pending phase, with every condition false
+// until its targets are resolved.
+func startPending(podflame *profilepodiov1alpha1.PodFlame) {
+	podflame.Status.Phase = profilepodiov1alpha1.PodFlamePending
+	message := "Resolving the target pods"
+	for _, conditionType := range []string{ConditionScheduled, ConditionRunning, ConditionSucceeded, ConditionFailed, ConditionCancelled} {
+		setCondition(podflame, conditionType, metav1.ConditionFalse, ReasonPending, message)
+	}
+}
+
+// finish moves podflame to a terminal phase. The condition of phase becomes
+// true and the conditions of the other terminal phases false.
+func finish(podflame *profilepodiov1alpha1.PodFlame, phase profilepodiov1alpha1.PodFlamePhase, reason, message string) {
+	now := metav1.Now()
+	podflame.Status.Phase = phase
+	podflame.Status.CompletionTime = &now
+	setCondition(podflame, ConditionRunning, metav1.ConditionFalse, reason, message)
+	if meta.FindStatusCondition(podflame.Status.Conditions, ConditionScheduled) == nil {
+		setCondition(podflame, ConditionScheduled, metav1.ConditionFalse, reason, message)
+	}
+	for _, terminal := range terminalConditions {
+		status := metav1.ConditionFalse
+		if terminal.phase == phase {
+			status = metav1.ConditionTrue
+		}
+		setCondition(podflame, terminal.conditionType, status, reason, message)
+	}
+}
+
+// updatePhase derives the phase and conditions of podflame from the phases of its targets.
+func updatePhase(podflame *profilepodiov1alpha1.PodFlame) {
+	if isFinished(podflame) {
+		return
+	}
+	targets := podflame.Status.Targets
+	var running, succeeded, failed, cancelled, partial int
+	for i := range targets {
+		switch targets[i].Phase {
+		case profilepodiov1alpha1.PodFlameRunning:
+			running++
+		case profilepodiov1alpha1.PodFlameSucceeded:
+			succeeded++
+		case profilepodiov1alpha1.PodFlameFailed:
+			failed++
+		case profilepodiov1alpha1.PodFlameCancelled:
+			cancelled++
+			if len(targets[i].Results) > 0 {
+				partial++
+			}
+		}
+	}
+
+	switch {
+	case succeeded+failed+cancelled < len(targets) && running > 0:
+		podflame.Status.Phase = profilepodiov1alpha1.PodFlameRunning
+		setCondition(podflame, ConditionRunning, metav1.ConditionTrue, ReasonAgentsRunning,
+			fmt.Sprintf("%d of %d agent pods are running", running, len(targets)))
+	case succeeded+failed+cancelled < len(targets):
+		podflame.Status.Phase = profilepodiov1alpha1.PodFlameScheduling
+		setCondition(podflame, ConditionRunning, metav1.ConditionFalse, ReasonAgentsCreated,
+			"Waiting for the agent pods to start")
+	case cancelled > 0:
+		finish(podflame, profilepodiov1alpha1.PodFlameCancelled, ReasonCancelled,
+			fmt.Sprintf("Profiling cancelled, results stored for %d of %d target pods", succeeded+partial, len(targets)))
+	case len(targets) == 1 && failed == 1:
+		reason := targets[0].Reason
+		if reason == "" {
+			reason = ReasonProfileFailed
+		}
+		finish(podflame, profilepodiov1alpha1.PodFlameFailed, reason, targets[0].Message)
+	case succeeded == 0:
+		finish(podflame, profilepodiov1alpha1.PodFlameFailed, ReasonProfileFailed,
+			fmt.Sprintf("Profiler failed for all %d target pods", len(targets)))
+	case failed > 0:
+		finish(podflame, profilepodiov1alpha1.PodFlameSucceeded, ReasonPartiallySucceeded,
+			fmt.Sprintf("Profiler failed for %d of %d target pods", failed, len(targets)))
+	default:
+		finish(podflame, profilepodiov1alpha1.PodFlameSucceeded, ReasonProfileSucceeded,
+			"Profiler finished successfully")
+	}
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"testing"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// expectConditions checks the status of the conditions of podflame.
+func expectConditions(t *testing.T, podflame *profilepodiov1alpha1.PodFlame, expected map[string]metav1.ConditionStatus) {
+	t.Helper()
+	for conditionType, status := range expected {
+		condition := meta.FindStatusCondition(podflame.Status.Conditions, conditionType)
+		if condition == nil {
+			t.Errorf("condition %s is missing", conditionType)
+			continue
+		}
+		if condition.Status != status {
+			t.Errorf("condition %s is %s, expected %s", conditionType, condition.Status, status)
+		}
+	}
+}
+
+func TestStartPending(t *testing.T) {
+	podflame := &profilepodiov1alpha1.PodFlame{}
+	startPending(podflame)
+	if podflame.Status.Phase != profilepodiov1alpha1.PodFlamePending {
+		t.Errorf("phase = %s, expected Pending", podflame.Status.Phase)
+	}
+	expectConditions(t, podflame, map[string]metav1.ConditionStatus{
+		ConditionScheduled: metav1.ConditionFalse,
+		ConditionRunning:   metav1.ConditionFalse,
+		ConditionSucceeded: metav1.ConditionFalse,
+		ConditionFailed:    metav1.ConditionFalse,
+		ConditionCancelled: metav1.ConditionFalse,
+	})
+}
+
+func TestFinish(t *testing.T) {
+	tests := []struct {
+		phase    profilepodiov1alpha1.PodFlamePhase
+		expected map[string]metav1.ConditionStatus
+	}{
+		{
+			phase: profilepodiov1alpha1.PodFlameSucceeded,
+			expected: map[string]metav1.ConditionStatus{
+				ConditionSucceeded: metav1.ConditionTrue, ConditionFailed: metav1.ConditionFalse, ConditionCancelled: metav1.ConditionFalse,
+			},
+		},
+		{
+			phase: profilepodiov1alpha1.PodFlameFailed,
+			expected: map[string]metav1.ConditionStatus{
+				ConditionSucceeded: metav1.ConditionFalse, ConditionFailed: metav1.ConditionTrue, ConditionCancelled: metav1.ConditionFalse,
+			},
+		},
+		{
+			phase: profilepodiov1alpha1.PodFlameCancelled,
+			expected: map[string]metav1.ConditionStatus{
+				ConditionSucceeded: metav1.ConditionFalse, ConditionFailed: metav1.ConditionFalse, ConditionCancelled: metav1.ConditionTrue,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(string(test.phase), func(t *testing.T) {
+			// A PodFlame failing validation finishes without being scheduled
+			podflame := &profilepodiov1alpha1.PodFlame{}
+			finish(podflame, test.phase, "Reason", "message")
+			if podflame.Status.Phase != test.phase || podflame.Status.CompletionTime == nil {
+				t.Errorf("phase = %s, completion time = %v", podflame.Status.Phase, podflame.Status.CompletionTime)
+			}
+			test.expected[ConditionRunning] = metav1.ConditionFalse
+			test.expected[ConditionScheduled] = metav1.ConditionFalse
+			expectConditions(t, podflame, test.expected)
+			if condition := meta.FindStatusCondition(podflame.Status.Conditions, ConditionSucceeded); condition.Reason != "Reason" {
+				t.Errorf("reason = %s, expected the reason of the phase", condition.Reason)
+			}
+		})
+	}
+}
+
+func TestUpdatePhase(t *testing.T) {
+	target := func(phase profilepodiov1alpha1.PodFlamePhase) profilepodiov1alpha1.TargetStatus {
+		return profilepodiov1alpha1.TargetStatus{PodName: "my-app", Phase: phase}
+	}
+	tests := []struct {
+		name    string
+		targets []profilepodiov1alpha1.TargetStatus
+		phase   profilepodiov1alpha1.PodFlamePhase
+		reason  string
+		message string
+	}{
+		{name: "scheduling", targets: []profilepodiov1alpha1.TargetStatus{target(profilepodiov1alpha1.PodFlamePending)}, phase: profilepodiov1alpha1.PodFlameScheduling},
+		{
+			name:    "running",
+			targets: []profilepodiov1alpha1.TargetStatus{target(profilepodiov1alpha1.PodFlameRunning), target(profilepodiov1alpha1.PodFlameSucceeded)},
+			phase:   profilepodiov1alpha1.PodFlameRunning,
+			reason:  ReasonAgentsRunning,
+		},
+		{name: "succeeded", targets: []profilepodiov1alpha1.TargetStatus{target(profilepodiov1alpha1.PodFlameSucceeded)}, phase: profilepodiov1alpha1.PodFlameSucceeded, reason: ReasonProfileSucceeded},
+		{
+			name:    "partially succeeded",
+			targets: []profilepodiov1alpha1.TargetStatus{target(profilepodiov1alpha1.PodFlameSucceeded), target(profilepodiov1alpha1.PodFlameFailed)},
+			phase:   profilepodiov1alpha1.PodFlameSucceeded,
+			reason:  ReasonPartiallySucceeded,
+		},
+		{
+			name:    "failed",
+			targets: []profilepodiov1alpha1.TargetStatus{target(profilepodiov1alpha1.PodFlameFailed), target(profilepodiov1alpha1.PodFlameFailed)},
+			phase:   profilepodiov1alpha1.PodFlameFailed,
+			reason:  ReasonProfileFailed,
+		},
+		{
+			name:    "cancelling",
+			targets: []profilepodiov1alpha1.TargetStatus{target(profilepodiov1alpha1.PodFlameRunning), target(profilepodiov1alpha1.PodFlameCancelled)},
+			phase:   profilepodiov1alpha1.PodFlameRunning,
+			reason:  ReasonAgentsRunning,
+		},
+		{
+			name: "cancelled",
+			targets: []profilepodiov1alpha1.TargetStatus{
+				target(profilepodiov1alpha1.PodFlameSucceeded),
+				{PodName: "my-app", Phase: profilepodiov1alpha1.PodFlameCancelled, Results: []profilepodiov1alpha1.ResultReference{{Name: "my-app-partial"}}},
+				target(profilepodiov1alpha1.PodFlameCancelled),
+				target(profilepodiov1alpha1.PodFlameFailed),
+			},
+			phase:   profilepodiov1alpha1.PodFlameCancelled,
+			reason:  ReasonCancelled,
+			message: "Profiling cancelled, results stored for 2 of 4 target pods",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			podflame := &profilepodiov1alpha1.PodFlame{}
+			startPending(podflame)
+			podflame.Status.Phase = profilepodiov1alpha1.PodFlameScheduling
+			podflame.Status.Targets = test.targets
+			updatePhase(podflame)
+			if podflame.Status.Phase != test.phase {
+				t.Fatalf("phase = %s, expected %s", podflame.Status.Phase, test.phase)
+			}
+			if test.reason == "" {
+				return
+			}
+			conditionType := ConditionRunning
+			if isFinished(podflame) {
+				conditionType = terminalCondition(test.phase)
+			}
+			if condition := meta.FindStatusCondition(podflame.Status.Conditions, conditionType); condition.Status != metav1.ConditionTrue || condition.Reason != test.reason {
+				t.Errorf("condition %s is %s with reason %s, expected True with %s", conditionType, condition.Status, condition.Reason, test.reason)
+			}
+			if condition := meta.FindStatusCondition(podflame.Status.Conditions, conditionType); test.message != "" && condition.Message != test.message {
+				t.Errorf("condition %s message %q, expected %q", conditionType, condition.Message, test.message)
+			}
+		})
+	}
+}
+
+func terminalCondition(phase profilepodiov1alpha1.PodFlamePhase) string {
+	for _, terminal := range terminalConditions {
+		if terminal.phase == phase {
+			return terminal.conditionType
+		}
+	}
+	return ""
+}
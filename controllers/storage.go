@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	BackendConfigMap = "configmap"
+	BackendSecret    = "secret"
+	BackendS3        = "s3"
+
+	// ResultAggregated prefixes the names of the results merged from every target
+	ResultAggregated = "aggregated"
+
+	// resultUIDPrefixLength is the length of the prefix of the PodFlame uid in result names
+	resultUIDPrefixLength = 8
+)
+
+// ResultStore keeps profiling results outside the PodFlame object, which only
+// holds a reference to them.
+type ResultStore interface {
+	// Save stores the gzipped data of format as the result called name of podflame.
+	Save(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, name string, format profilepodiov1alpha1.OutputFormat, data []byte) (*profilepodiov1alpha1.ResultReference, error)
+	// Load returns the data referenced by ref after verifying its checksum.
+	Load(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, ref *profilepodiov1alpha1.ResultReference) ([]byte, error)
+	// Delete removes the data referenced by ref.
+	Delete(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, ref *profilepodiov1alpha1.ResultReference) error
+	// DeleteAll removes every result stored for podflame.
+	DeleteAll(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame) error
+}
+
+// ResultStoreOptions configures the result store of the operator.
+type ResultStoreOptions struct {
+	// Backend is the result storage backend, configmap, secret or s3
+	Backend string
+	S3      S3Options
+}
+
+// NewResultStore returns the result store configured by options. Credentials
+// are read from the operator namespace.
+func NewResultStore(ctx context.Context, options ResultStoreOptions, clientset kubernetes.Interface, namespace string) (ResultStore, error) {
+	switch options.Backend {
+	case BackendConfigMap, BackendSecret:
+		return &objectStore{clientset: clientset, backend: options.Backend}, nil
+	case BackendS3:
+		return newS3Store(ctx, options.S3, clientset, namespace)
+	default:
+		return nil, fmt.Errorf("Unknown result backend %s, known backends are %s, %s, %s",
+			options.Backend, BackendConfigMap, BackendSecret, BackendS3)
+	}
+}
+
+// resultName returns the name of the result called name of podflame. The
+// prefix of the PodFlame uid keeps the results of PodFlames whose name and
+// result name join the same way, e.g. web with x-aggregated and web-x with
+// aggregated, apart.
+func resultName(podflame *profilepodiov1alpha1.PodFlame, name string) string {
+	uid := string(podflame.UID)
+	if len(uid) > resultUIDPrefixLength {
+		uid = uid[:resultUIDPrefixLength]
+	}
+	return truncateName(podflame.Name+"-"+uid+"-"+name, validation.DNS1123SubdomainMaxLength)
+}
+
+// truncateName shortens name to maxLength, replacing its end with a hash of name.
+func truncateName(name string, maxLength int) string {
+	if len(name) <= maxLength {
+		return name
+	}
+	hash := sha256.Sum256([]byte(name))
+	suffix := hex.EncodeToString(hash[:])[:10]
+	return name[:maxLength-len(suffix)-1] + "-" + suffix
+}
+
+// checksum returns the hex encoded SHA-256 checksum of data.
+func checksum(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// verifyResult checks that data matches the size and checksum recorded in ref.
+func verifyResult(ref *profilepodiov1alpha1.ResultReference, data []byte) error {
+	if int64(len(data)) != ref.Size {
+		return fmt.Errorf("result %s has %d bytes, expected %d", ref.Name, len(data), ref.Size)
+	}
+	if sum := checksum(data); sum != ref.SHA256 {
+		return fmt.Errorf("result %s has checksum %s, expected %s", ref.Name, sum, ref.SHA256)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"github.com/profile-pod/profile-pod-operator/controllers/constants"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// resultKey is the data key holding a result chunk
+	resultKey = "result"
+	// resultChunkSize keeps every chunk, with its metadata, below the 1MiB object size limit
+	resultChunkSize = 900 * 1024
+)
+
+// objectStore keeps results in ConfigMaps or Secrets in the PodFlame namespace,
+// owned by the PodFlame. Results larger than resultChunkSize are split across
+// several objects. Objects not owned by the PodFlame are never replaced nor
+// deleted.
+type objectStore struct {
+	clientset kubernetes.Interface
+	backend   string
+}
+
+func (store *objectStore) Save(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, name string, format profilepodiov1alpha1.OutputFormat, data []byte) (*profilepodiov1alpha1.ResultReference, error) {
+	ref := &profilepodiov1alpha1.ResultReference{
+		Format:      format,
+		ContentType: formatContentType(format),
+		Backend:     store.backend,
+		Name:        resultName(podflame, name),
+		Size:        int64(len(data)),
+		SHA256:      checksum(data),
+	}
+	for offset := 0; offset == 0 || offset < len(data); offset += resultChunkSize {
+		end := offset + resultChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		meta := metav1.ObjectMeta{
+			Name:      chunkName(ref.Name, int(ref.Chunks)),
+			Namespace: podflame.Namespace,
+			Labels:    labelsForPodfalme(podflame),
+			Annotations: map[string]string{
+				constants.AnnotationContentType: ref.ContentType,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(podflame, profilepodiov1alpha1.GroupVersion.WithKind("PodFlame")),
+			},
+		}
+		if err := store.put(ctx, podflame, meta, data[offset:end]); err != nil {
+			return nil, err
+		}
+		ref.Chunks++
+	}
+	return ref, nil
+}
+
+func (store *objectStore) Load(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, ref *profilepodiov1alpha1.ResultReference) ([]byte, error) {
+	var data bytes.Buffer
+	for i := 0; i < int(ref.Chunks); i++ {
+		chunk, err := store.get(ctx, podflame.Namespace, chunkName(ref.Name, i))
+		if err != nil {
+			return nil, err
+		}
+		data.Write(chunk)
+	}
+	if err := verifyResult(ref, data.Bytes()); err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+func (store *objectStore) Delete(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, ref *profilepodiov1alpha1.ResultReference) error {
+	for i := 0; i < int(ref.Chunks); i++ {
+		name := chunkName(ref.Name, i)
+		var object metav1.Object
+		var err error
+		if store.backend == BackendSecret {
+			object, err = store.clientset.CoreV1().Secrets(podflame.Namespace).Get(ctx, name, metav1.GetOptions{})
+		} else {
+			object, err = store.clientset.CoreV1().ConfigMaps(podflame.Namespace).Get(ctx, name, metav1.GetOptions{})
+		}
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !ownedBy(object, podflame) {
+			continue
+		}
+		// The precondition keeps an object recreated by someone else meanwhile
+		options := metav1.DeleteOptions{Preconditions: metav1.NewUIDPreconditions(string(object.GetUID()))}
+		if store.backend == BackendSecret {
+			err = store.clientset.CoreV1().Secrets(podflame.Namespace).Delete(ctx, name, options)
+		} else {
+			err = store.clientset.CoreV1().ConfigMaps(podflame.Namespace).Delete(ctx, name, options)
+		}
+		if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *objectStore) DeleteAll(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame) error {
+	listOptions := metav1.ListOptions{LabelSelector: labels.Set(labelsForPodfalme(podflame)).String()}
+	if store.backend == BackendSecret {
+		return store.clientset.CoreV1().Secrets(podflame.Namespace).DeleteCollection(ctx, metav1.DeleteOptions{}, listOptions)
+	}
+	return store.clientset.CoreV1().ConfigMaps(podflame.Namespace).DeleteCollection(ctx, metav1.DeleteOptions{}, listOptions)
+}
+
+// put creates the object described by meta holding chunk, or replaces it when
+// podflame already owns it.
+func (store *objectStore) put(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, meta metav1.ObjectMeta, chunk []byte) error {
+	if store.backend == BackendSecret {
+		secrets := store.clientset.CoreV1().Secrets(meta.Namespace)
+		secret := &corev1.Secret{ObjectMeta: meta, Type: corev1.SecretTypeOpaque, Data: map[string][]byte{resultKey: chunk}}
+		_, err := secrets.Create(ctx, secret, metav1.CreateOptions{})
+		if !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+		existing, err := secrets.Get(ctx, meta.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !ownedBy(existing, podflame) {
+			return store.foreignObjectError(podflame, meta.Name)
+		}
+		secret.ResourceVersion = existing.ResourceVersion
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	}
+	configMaps := store.clientset.CoreV1().ConfigMaps(meta.Namespace)
+	configMap := &corev1.ConfigMap{ObjectMeta: meta, BinaryData: map[string][]byte{resultKey: chunk}}
+	_, err := configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	existing, err := configMaps.Get(ctx, meta.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if !ownedBy(existing, podflame) {
+		return store.foreignObjectError(podflame, meta.Name)
+	}
+	configMap.ResourceVersion = existing.ResourceVersion
+	_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	return err
+}
+
+func (store *objectStore) foreignObjectError(podflame *profilepodiov1alpha1.PodFlame, name string) error {
+	return fmt.Errorf("%s %s already exists and is not owned by PodFlame %s, refusing to replace it", store.backend, name, podflame.Name)
+}
+
+// ownedBy reports whether object is controlled by podflame.
+func ownedBy(object metav1.Object, podflame *profilepodiov1alpha1.PodFlame) bool {
+	return isControlledBy(object, podflame.UID)
+}
+
+// get returns the chunk held by the object called name.
+func (store *objectStore) get(ctx context.Context, namespace, name string) ([]byte, error) {
+	var data map[string][]byte
+	if store.backend == BackendSecret {
+		secret, err := store.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		data = secret.Data
+	} else {
+		configMap, err := store.clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		data = configMap.BinaryData
+	}
+	chunk, found := data[resultKey]
+	if !found {
+		return nil, fmt.Errorf("%s %s holds no result", store.backend, name)
+	}
+	return chunk, nil
+}
+
+// chunkName returns the name of the object holding chunk i of the result called name.
+func chunkName(name string, i int) string {
+	if i == 0 {
+		return name
+	}
+	suffix := fmt.Sprintf("-%d", i)
+	return truncateName(name, validation.DNS1123SubdomainMaxLength-len(suffix)) + suffix
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testPodFlame(name string, uid types.UID) *profilepodiov1alpha1.PodFlame {
+	return &profilepodiov1alpha1.PodFlame{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "my-app-namespace", UID: uid}}
+}
+
+func TestResultName(t *testing.T) {
+	web := resultName(testPodFlame("web", "0b7c9e5a-aaaa-4d0e-9c5c-1b2b3c4d5e6f"), "x-aggregated-html")
+	webX := resultName(testPodFlame("web-x", "7f3e1c2d-bbbb-4d0e-9c5c-1b2b3c4d5e6f"), "aggregated-html")
+	if web == webX {
+		t.Errorf("the results of different PodFlames are both named %s", web)
+	}
+	if web != "web-0b7c9e5a-x-aggregated-html" {
+		t.Errorf("result name = %s", web)
+	}
+}
+
+func TestObjectStoreForeignObject(t *testing.T) {
+	for _, backend := range []string{BackendConfigMap, BackendSecret} {
+		t.Run(backend, func(t *testing.T) {
+			ctx := context.Background()
+			podflame := testPodFlame("web", "0b7c9e5a-aaaa-4d0e-9c5c-1b2b3c4d5e6f")
+			name := resultName(podflame, "my-app-html")
+			meta := metav1.ObjectMeta{Name: name, Namespace: podflame.Namespace, Labels: map[string]string{"owner": "someone-else"}}
+			foreign := []byte("not a profile")
+			clientset := fake.NewSimpleClientset(
+				&corev1.ConfigMap{ObjectMeta: meta, BinaryData: map[string][]byte{resultKey: foreign}},
+				&corev1.Secret{ObjectMeta: meta, Data: map[string][]byte{resultKey: foreign}},
+			)
+			store := &objectStore{clientset: clientset, backend: backend}
+
+			_, err := store.Save(ctx, podflame, "my-app-html", profilepodiov1alpha1.FormatHTML, []byte("profile"))
+			if err == nil || !strings.Contains(err.Error(), "not owned by PodFlame web") {
+				t.Fatalf("expected saving over a foreign object to fail, got %v", err)
+			}
+			if data, err := store.get(ctx, podflame.Namespace, name); err != nil || string(data) != string(foreign) {
+				t.Fatalf("the foreign object holds %q, %v", data, err)
+			}
+
+			ref := &profilepodiov1alpha1.ResultReference{Name: name, Chunks: 1}
+			if err := store.Delete(ctx, podflame, ref); err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if _, err := store.get(ctx, podflame.Namespace, name); err != nil {
+				t.Errorf("the foreign object was deleted: %v", err)
+			}
+		})
+	}
+}
+
+func TestObjectStoreReplaceOwned(t *testing.T) {
+	for _, backend := range []string{BackendConfigMap, BackendSecret} {
+		t.Run(backend, func(t *testing.T) {
+			ctx := context.Background()
+			podflame := testPodFlame("web", "0b7c9e5a-aaaa-4d0e-9c5c-1b2b3c4d5e6f")
+			store := &objectStore{clientset: fake.NewSimpleClientset(), backend: backend}
+
+			if _, err := store.Save(ctx, podflame, "my-app-html", profilepodiov1alpha1.FormatHTML, []byte("first")); err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			ref, err := store.Save(ctx, podflame, "my-app-html", profilepodiov1alpha1.FormatHTML, []byte("second"))
+			if err != nil {
+				t.Fatalf("replacing an owned result failed: %s", err)
+			}
+			data, err := store.Load(ctx, podflame, ref)
+			if err != nil || string(data) != "second" {
+				t.Fatalf("loaded %q, %v", data, err)
+			}
+
+			if err := store.Delete(ctx, podflame, ref); err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if _, err := store.get(ctx, podflame.Namespace, ref.Name); !apierrors.IsNotFound(err) {
+				t.Errorf("expected the result to be deleted, got %v", err)
+			}
+		})
+	}
+}
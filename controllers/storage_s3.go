@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	"github.com/profile-pod/profile-pod-operator/controllers/s3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// S3AccessKeyIDKey is the key of the access key id in the credentials Secret
+	S3AccessKeyIDKey = "AWS_ACCESS_KEY_ID"
+	// S3SecretAccessKeyKey is the key of the secret access key in the credentials Secret
+	S3SecretAccessKeyKey = "AWS_SECRET_ACCESS_KEY"
+	// S3SessionTokenKey is the optional key of a session token in the credentials Secret
+	S3SessionTokenKey = "AWS_SESSION_TOKEN"
+
+	resultContentEncoding = "gzip"
+	// maxPresignExpiry is the longest lifetime of a Signature Version 4 presigned URL
+	maxPresignExpiry = 7 * 24 * time.Hour
+)
+
+// S3Options configures the s3 result backend.
+type S3Options struct {
+	// Endpoint is the URL of the S3-compatible endpoint, e.g. http://minio.minio:9000
+	Endpoint string
+	Bucket   string
+	// Prefix is prepended to the key of every stored result
+	Prefix string
+	Region string
+	// CredentialsSecret is the name of the Secret in the operator namespace holding the credentials
+	CredentialsSecret string
+	// PresignExpiry is the lifetime of the download URL placed in the result reference,
+	// no URL is placed when it is zero
+	PresignExpiry time.Duration
+}
+
+// s3Store keeps results as objects of an S3-compatible bucket, under
+// <prefix>/<namespace>/<name>/<uid>/.
+type s3Store struct {
+	client        *s3.Client
+	bucket        string
+	prefix        string
+	presignExpiry time.Duration
+}
+
+func newS3Store(ctx context.Context, options S3Options, clientset kubernetes.Interface, namespace string) (*s3Store, error) {
+	if options.Endpoint == "" || options.Bucket == "" || options.CredentialsSecret == "" {
+		return nil, errors.New("the s3 result backend requires an endpoint, a bucket and a credentials secret")
+	}
+	if options.PresignExpiry > maxPresignExpiry {
+		return nil, fmt.Errorf("the s3 presign expiry can not exceed %s", maxPresignExpiry)
+	}
+	endpoint, err := url.Parse(options.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, options.CredentialsSecret, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read s3 credentials: %w", err)
+	}
+	accessKeyID, secretAccessKey := string(secret.Data[S3AccessKeyIDKey]), string(secret.Data[S3SecretAccessKeyKey])
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, fmt.Errorf("secret %s must hold %s and %s", options.CredentialsSecret, S3AccessKeyIDKey, S3SecretAccessKeyKey)
+	}
+	region := options.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &s3Store{
+		client: &s3.Client{
+			Endpoint:        endpoint,
+			Region:          region,
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: secretAccessKey,
+			SessionToken:    string(secret.Data[S3SessionTokenKey]),
+			HTTPClient:      &http.Client{Timeout: time.Minute},
+		},
+		bucket:        options.Bucket,
+		prefix:        options.Prefix,
+		presignExpiry: options.PresignExpiry,
+	}, nil
+}
+
+// keyPrefix returns the prefix of the keys of every result of podflame.
+func (store *s3Store) keyPrefix(podflame *profilepodiov1alpha1.PodFlame) string {
+	return path.Join(store.prefix, podflame.Namespace, podflame.Name, string(podflame.UID)) + "/"
+}
+
+func (store *s3Store) Save(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, name string, format profilepodiov1alpha1.OutputFormat, data []byte) (*profilepodiov1alpha1.ResultReference, error) {
+	key := store.keyPrefix(podflame) + name + ".gz"
+	contentType := formatContentType(format)
+	if err := store.client.PutObject(ctx, store.bucket, key, data, contentType, resultContentEncoding); err != nil {
+		return nil, err
+	}
+	ref := &profilepodiov1alpha1.ResultReference{
+		Format:      format,
+		ContentType: contentType,
+		Backend:     BackendS3,
+		Name:        key,
+		Bucket:      store.bucket,
+		Size:        int64(len(data)),
+		SHA256:      checksum(data),
+	}
+	if store.presignExpiry > 0 {
+		ref.URL = store.client.PresignGetObject(store.bucket, key, store.presignExpiry)
+	}
+	return ref, nil
+}
+
+func (store *s3Store) Load(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, ref *profilepodiov1alpha1.ResultReference) ([]byte, error) {
+	data, err := store.client.GetObject(ctx, ref.Bucket, ref.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyResult(ref, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (store *s3Store) Delete(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame, ref *profilepodiov1alpha1.ResultReference) error {
+	return store.client.DeleteObject(ctx, ref.Bucket, ref.Name)
+}
+
+func (store *s3Store) DeleteAll(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame) error {
+	keys, err := store.client.ListObjects(ctx, store.bucket, store.keyPrefix(podflame))
+	if err != nil {
+		if s3.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	for _, key := range keys {
+		if err := store.client.DeleteObject(ctx, store.bucket, key); err != nil && !s3.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
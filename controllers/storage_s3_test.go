@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeS3 is an in-memory path style bucket endpoint, like a local MinIO. It
+// serves objects with the Content-Encoding they were uploaded with.
+type fakeS3 struct {
+	mutex     sync.Mutex
+	objects   map[string][]byte
+	encodings map[string]string
+}
+
+func (s3 *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s3.mutex.Lock()
+	defer s3.mutex.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodPut:
+		s3.objects[r.URL.Path] = body
+		s3.encodings[r.URL.Path] = r.Header.Get("Content-Encoding")
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		type object struct {
+			Key string `xml:"Key"`
+		}
+		var result struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []object `xml:"Contents"`
+		}
+		bucket, prefix := r.URL.Path+"/", r.URL.Query().Get("prefix")
+		for path := range s3.objects {
+			if key := strings.TrimPrefix(path, bucket); strings.HasPrefix(key, prefix) {
+				result.Contents = append(result.Contents, object{Key: key})
+			}
+		}
+		sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+		_ = xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodGet:
+		data, found := s3.objects[r.URL.Path]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if encoding := s3.encodings[r.URL.Path]; encoding != "" {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		_, _ = w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(s3.objects, r.URL.Path)
+		delete(s3.encodings, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3StoreRoundTrip(t *testing.T) {
+	bucket := &fakeS3{objects: map[string][]byte{}, encodings: map[string]string{}}
+	server := httptest.NewServer(bucket)
+	defer server.Close()
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "s3-credentials", Namespace: "profile-pod-operator-system"},
+		Data:       map[string][]byte{S3AccessKeyIDKey: []byte("minio"), S3SecretAccessKeyKey: []byte("minio123")},
+	})
+	store, err := newS3Store(ctx, S3Options{
+		Endpoint: server.URL, Bucket: "profiles", Prefix: "results", CredentialsSecret: "s3-credentials", PresignExpiry: time.Hour,
+	}, clientset, "profile-pod-operator-system")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	podflame := testPodFlame("my-app-flame", "0b7c9e5a-aaaa-4d0e-9c5c-1b2b3c4d5e6f")
+	ref, err := store.Save(ctx, podflame, "my-app-0-html", profilepodiov1alpha1.FormatHTML, []byte("profile"))
+	if err != nil {
+		t.Fatalf("save failed: %s", err)
+	}
+	if ref.Name != "results/my-app-namespace/my-app-flame/0b7c9e5a-aaaa-4d0e-9c5c-1b2b3c4d5e6f/my-app-0-html.gz" || ref.Bucket != "profiles" {
+		t.Errorf("unexpected reference %+v", ref)
+	}
+	if !strings.HasPrefix(ref.URL, server.URL+"/profiles/results/") || !strings.Contains(ref.URL, "X-Amz-Signature=") {
+		t.Errorf("unexpected presigned url %s", ref.URL)
+	}
+	if _, err := store.Save(ctx, podflame, "my-app-0-svg", profilepodiov1alpha1.FormatSVG, []byte("<svg/>")); err != nil {
+		t.Fatalf("save failed: %s", err)
+	}
+
+	data, err := store.Load(ctx, podflame, ref)
+	if err != nil || string(data) != "profile" {
+		t.Fatalf("load returned %q, %v", data, err)
+	}
+	corrupt := *ref
+	corrupt.SHA256 = checksum([]byte("another profile"))
+	if _, err := store.Load(ctx, podflame, &corrupt); err == nil {
+		t.Error("expected loading a result with another checksum to fail")
+	}
+
+	if err := store.Delete(ctx, podflame, ref); err != nil {
+		t.Fatalf("delete failed: %s", err)
+	}
+	if _, err := store.Load(ctx, podflame, ref); err == nil {
+		t.Error("expected loading a deleted result to fail")
+	}
+	if err := store.DeleteAll(ctx, podflame); err != nil {
+		t.Fatalf("delete all failed: %s", err)
+	}
+	if len(bucket.objects) != 0 {
+		t.Errorf("objects left after delete all: %v", bucket.objects)
+	}
+}
@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// validateTarget checks that the PodFlame spec describes exactly one way of selecting targets.
+func validateTarget(spec *profilepodiov1alpha1.PodFlameSpec) error {
+	targets := 0
+	if spec.TargetPod != "" {
+		targets++
+	}
+	if spec.TargetSelector != nil {
+		targets++
+	}
+	if spec.TargetRef != nil {
+		targets++
+	}
+	switch {
+	case targets > 1:
+		return errors.New("only one of targetPod, targetSelector and targetRef may be set")
+	case targets == 0:
+		return errors.New("one of targetPod, targetSelector and targetRef must be set")
+	}
+	if spec.TargetRef != nil {
+		if _, err := workloadAPIVersion(spec.TargetRef); err != nil {
+			return err
+		}
+		if spec.TargetRef.Policy == profilepodiov1alpha1.ReplicaPolicyCount && spec.TargetRef.Replicas == nil {
+			return errors.New("targetRef.replicas must be set when targetRef.policy is Count")
+		}
+	}
+	return nil
+}
+
+// resolveTargetPods returns the pods the PodFlame should profile.
+func (reconciler *PodFlameReconciler) resolveTargetPods(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame) ([]corev1.Pod, error) {
+	if podflame.Spec.TargetSelector != nil {
+		return GetTargetPodsBySelector(reconciler.Clientset, podflame.Spec.TargetSelector, podflame.Namespace, ctx)
+	}
+	if podflame.Spec.TargetRef != nil {
+		pods, err := GetWorkloadPods(reconciler.Clientset, podflame.Spec.TargetRef, podflame.Namespace, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return selectReplicas(pods, podflame.Spec.TargetRef), nil
+	}
+	targetPod, err := GetTargetPod(reconciler.Clientset, podflame.Spec.TargetPod, podflame.Namespace, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []corev1.Pod{*targetPod}, nil
+}
+
+// GetTargetPodsBySelector returns the running pods in namespace matching selector.
+func GetTargetPodsBySelector(clientset kubernetes.Interface, selector *metav1.LabelSelector, namespace string, ctx context.Context) ([]corev1.Pod, error) {
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	podList, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector.String()})
+	if err != nil {
+		return nil, err
+	}
+	pods := runningPods(podList.Items)
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("No running pods match selector %s", labelSelector.String())
+	}
+	return pods, nil
+}
+
+// GetWorkloadPods returns the running pods owned by the workload referenced by ref.
+func GetWorkloadPods(clientset kubernetes.Interface, ref *profilepodiov1alpha1.TargetReference, namespace string, ctx context.Context) ([]corev1.Pod, error) {
+	var selector *metav1.LabelSelector
+	var owner metav1.Object
+	switch ref.Kind {
+	case "Deployment":
+		deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return getDeploymentPods(clientset, deployment, ctx)
+	case "StatefulSet":
+		statefulSet, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		selector, owner = statefulSet.Spec.Selector, statefulSet
+	case "DaemonSet":
+		daemonSet, err := clientset.AppsV1().DaemonSets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		selector, owner = daemonSet.Spec.Selector, daemonSet
+	case "ReplicaSet":
+		replicaSet, err := clientset.AppsV1().ReplicaSets(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		selector, owner = replicaSet.Spec.Selector, replicaSet
+	case "Job":
+		job, err := clientset.BatchV1().Jobs(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		selector, owner = job.Spec.Selector, job
+	default:
+		return nil, fmt.Errorf("Unsupported target kind %s", ref.Kind)
+	}
+	pods, err := listOwnedPods(clientset, selector, namespace, map[types.UID]bool{owner.GetUID(): true}, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("No running pods found for %s %s", ref.Kind, ref.Name)
+	}
+	return pods, nil
+}
+
+// getDeploymentPods returns the running pods of every ReplicaSet owned by deployment.
+func getDeploymentPods(clientset kubernetes.Interface, deployment *appsv1.Deployment, ctx context.Context) ([]corev1.Pod, error) {
+	labelSelector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	replicaSets, err := clientset.AppsV1().ReplicaSets(deployment.Namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector.String()})
+	if err != nil {
+		return nil, err
+	}
+	owners := map[types.UID]bool{}
+	for i := range replicaSets.Items {
+		if isControlledBy(&replicaSets.Items[i], deployment.UID) {
+			owners[replicaSets.Items[i].UID] = true
+		}
+	}
+	pods, err := listOwnedPods(clientset, deployment.Spec.Selector, deployment.Namespace, owners, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("No running pods found for Deployment %s", deployment.Name)
+	}
+	return pods, nil
+}
+
+// listOwnedPods returns the running pods matching selector that are controlled by one of owners.
+func listOwnedPods(clientset kubernetes.Interface, selector *metav1.LabelSelector, namespace string, owners map[types.UID]bool, ctx context.Context) ([]corev1.Pod, error) {
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	podList, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector.String()})
+	if err != nil {
+		return nil, err
+	}
+	var pods []corev1.Pod
+	for _, pod := range runningPods(podList.Items) {
+		if controllerRef := metav1.GetControllerOf(&pod); controllerRef != nil && owners[controllerRef.UID] {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+func isControlledBy(object metav1.Object, uid types.UID) bool {
+	controllerRef := metav1.GetControllerOf(object)
+	return controllerRef != nil && controllerRef.UID == uid
+}
+
+// selectReplicas applies the replica policy of ref to pods. The Random policy
+// profiles a single replica, a Count policy the replicas it sets, which
+// validateTarget requires.
+func selectReplicas(pods []corev1.Pod, ref *profilepodiov1alpha1.TargetReference) []corev1.Pod {
+	if ref.Policy == profilepodiov1alpha1.ReplicaPolicyAll {
+		return pods
+	}
+	count := 1
+	if ref.Policy == profilepodiov1alpha1.ReplicaPolicyCount && ref.Replicas != nil {
+		count = int(*ref.Replicas)
+	}
+	if count > len(pods) {
+		count = len(pods)
+	}
+	rand.Shuffle(len(pods), func(i, j int) { pods[i], pods[j] = pods[j], pods[i] })
+	return pods[:count]
+}
+
+// workloadAPIVersion returns the apiVersion of ref, defaulted according to its kind.
+func workloadAPIVersion(ref *profilepodiov1alpha1.TargetReference) (string, error) {
+	apiVersion := appsv1.SchemeGroupVersion.String()
+	if ref.Kind == "Job" {
+		apiVersion = batchv1.SchemeGroupVersion.String()
+	}
+	if ref.APIVersion != "" && ref.APIVersion != apiVersion {
+		return "", fmt.Errorf("Unsupported apiVersion %s for kind %s, expected %s", ref.APIVersion, ref.Kind, apiVersion)
+	}
+	return apiVersion, nil
+}
+
+func runningPods(pods []corev1.Pod) []corev1.Pod {
+	var running []corev1.Pod
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil {
+			running = append(running, pod)
+		}
+	}
+	return running
+}
+
+// agentPodName returns the name of the agent pod profiling targetPodName for podflame.
+func agentPodName(podflame *profilepodiov1alpha1.PodFlame, targetPodName string) string {
+	return truncateName(runName(podflame, podflame.Namespace+"-"+podflame.Name+"-"+targetPodName), validation.DNS1123SubdomainMaxLength)
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testPods(names ...string) []corev1.Pod {
+	pods := make([]corev1.Pod, 0, len(names))
+	for _, name := range names {
+		pods = append(pods, corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "my-app-namespace", Labels: map[string]string{"app": "my-app"}},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		})
+	}
+	return pods
+}
+
+func TestSelectReplicas(t *testing.T) {
+	two, ten := int32(2), int32(10)
+	tests := []struct {
+		name     string
+		ref      profilepodiov1alpha1.TargetReference
+		expected int
+	}{
+		{name: "random", ref: profilepodiov1alpha1.TargetReference{Policy: profilepodiov1alpha1.ReplicaPolicyRandom}, expected: 1},
+		{name: "default policy", ref: profilepodiov1alpha1.TargetReference{}, expected: 1},
+		{name: "all", ref: profilepodiov1alpha1.TargetReference{Policy: profilepodiov1alpha1.ReplicaPolicyAll}, expected: 3},
+		{name: "count", ref: profilepodiov1alpha1.TargetReference{Policy: profilepodiov1alpha1.ReplicaPolicyCount, Replicas: &two}, expected: 2},
+		{name: "count above replicas", ref: profilepodiov1alpha1.TargetReference{Policy: profilepodiov1alpha1.ReplicaPolicyCount, Replicas: &ten}, expected: 3},
+		{name: "count without replicas", ref: profilepodiov1alpha1.TargetReference{Policy: profilepodiov1alpha1.ReplicaPolicyCount}, expected: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected := selectReplicas(testPods("my-app-0", "my-app-1", "my-app-2"), &test.ref)
+			if len(selected) != test.expected {
+				t.Fatalf("selected %d replicas, expected %d", len(selected), test.expected)
+			}
+			seen := map[string]bool{}
+			for _, pod := range selected {
+				if seen[pod.Name] {
+					t.Errorf("replica %s selected twice", pod.Name)
+				}
+				seen[pod.Name] = true
+			}
+		})
+	}
+}
+
+func TestValidateTargetCountWithoutReplicas(t *testing.T) {
+	spec := &profilepodiov1alpha1.PodFlameSpec{TargetRef: &profilepodiov1alpha1.TargetReference{
+		Kind: "Deployment", Name: "my-app", Policy: profilepodiov1alpha1.ReplicaPolicyCount,
+	}}
+	if err := validateTarget(spec); err == nil || !strings.Contains(err.Error(), "targetRef.replicas") {
+		t.Errorf("expected an error naming targetRef.replicas, got %v", err)
+	}
+	replicas := int32(2)
+	spec.TargetRef.Replicas = &replicas
+	if err := validateTarget(spec); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+}
+
+func TestGetTargetPodsBySelector(t *testing.T) {
+	pods := testPods("my-app-0", "my-app-1", "my-app-2", "other")
+	pods[1].Status.Phase = corev1.PodPending
+	now := metav1.Now()
+	pods[2].DeletionTimestamp = &now
+	pods[3].Labels = map[string]string{"app": "other"}
+	clientset := fake.NewSimpleClientset(&pods[0], &pods[1], &pods[2], &pods[3])
+	ctx := context.Background()
+
+	selected, err := GetTargetPodsBySelector(clientset, &metav1.LabelSelector{MatchLabels: map[string]string{"app": "my-app"}}, "my-app-namespace", ctx)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if len(selected) != 1 || selected[0].Name != "my-app-0" {
+		t.Errorf("selected %v, expected the running pod my-app-0", selected)
+	}
+
+	_, err = GetTargetPodsBySelector(clientset, &metav1.LabelSelector{MatchLabels: map[string]string{"app": "missing"}}, "my-app-namespace", ctx)
+	if err == nil || !strings.Contains(err.Error(), "app=missing") {
+		t.Errorf("expected an error naming the selector, got %v", err)
+	}
+
+	invalid := &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: "Like"}}}
+	if _, err = GetTargetPodsBySelector(clientset, invalid, "my-app-namespace", ctx); err == nil {
+		t.Error("expected an error for an invalid selector")
+	}
+}
+
+func TestAgentPodName(t *testing.T) {
+	podflame := &profilepodiov1alpha1.PodFlame{ObjectMeta: metav1.ObjectMeta{Name: "my-app-flame", Namespace: "my-app-namespace"}}
+	if name := agentPodName(podflame, "my-app-0"); name != "my-app-namespace-my-app-flame-my-app-0" {
+		t.Errorf("agent pod name = %s", name)
+	}
+
+	podflame.Name = strings.Repeat("f", 200)
+	first, second := agentPodName(podflame, strings.Repeat("p", 100)+"-0"), agentPodName(podflame, strings.Repeat("p", 100)+"-1")
+	for _, name := range []string{first, second} {
+		if len(name) > validation.DNS1123SubdomainMaxLength {
+			t.Errorf("agent pod name %s is %d characters long", name, len(name))
+		}
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			t.Errorf("agent pod name %s is invalid: %v", name, errs)
+		}
+	}
+	if first == second {
+		t.Errorf("truncated agent pod names of different targets collide: %s", first)
+	}
+}
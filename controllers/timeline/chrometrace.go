@@ -0,0 +1,97 @@
+package timeline
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// traceEvent is an event of the Chrome Trace Event format.
+type traceEvent struct {
+	Name  string            `json:"name"`
+	Phase string            `json:"ph"`
+	Time  float64           `json:"ts"`
+	PID   int               `json:"pid"`
+	TID   int               `json:"tid"`
+	Args  map[string]string `json:"args,omitempty"`
+}
+
+type traceFile struct {
+	TraceEvents     []traceEvent `json:"traceEvents"`
+	DisplayTimeUnit string       `json:"displayTimeUnit"`
+}
+
+// WriteChromeTrace writes samples in the Chrome Trace Event format, as read by
+// chrome://tracing and Perfetto, under a process called name. Consecutive
+// samples of a thread sharing frames are merged into slices spanning the time
+// between them, and the last samples of a thread last as long as the shortest
+// interval between its samples.
+func WriteChromeTrace(w io.Writer, samples []Sample, name string) error {
+	file := traceFile{DisplayTimeUnit: "ms", TraceEvents: []traceEvent{}}
+	if len(samples) == 0 {
+		return json.NewEncoder(w).Encode(file)
+	}
+	start := samples[0].Time
+	// Trace event times are in microseconds
+	micros := func(time int64) float64 { return float64(time-start) / 1000 }
+
+	file.TraceEvents = append(file.TraceEvents, traceEvent{
+		Name: "process_name", Phase: "M", PID: 1, Args: map[string]string{"name": name},
+	})
+	names, byThread := threads(samples)
+	for i, thread := range names {
+		tid := i + 1
+		file.TraceEvents = append(file.TraceEvents, traceEvent{
+			Name: "thread_name", Phase: "M", PID: 1, TID: tid, Args: map[string]string{"name": thread},
+		})
+		threadSamples := byThread[thread]
+		var open []string
+		for _, sample := range threadSamples {
+			common := commonPrefix(open, sample.Stack)
+			for depth := len(open) - 1; depth >= common; depth-- {
+				file.TraceEvents = append(file.TraceEvents, traceEvent{
+					Name: open[depth], Phase: "E", Time: micros(sample.Time), PID: 1, TID: tid,
+				})
+			}
+			for depth := common; depth < len(sample.Stack); depth++ {
+				file.TraceEvents = append(file.TraceEvents, traceEvent{
+					Name: sample.Stack[depth], Phase: "B", Time: micros(sample.Time), PID: 1, TID: tid,
+				})
+			}
+			open = sample.Stack
+		}
+		end := threadSamples[len(threadSamples)-1].Time + shortestInterval(threadSamples)
+		for depth := len(open) - 1; depth >= 0; depth-- {
+			file.TraceEvents = append(file.TraceEvents, traceEvent{
+				Name: open[depth], Phase: "E", Time: micros(end), PID: 1, TID: tid,
+			})
+		}
+	}
+	sort.SliceStable(file.TraceEvents, func(i, j int) bool {
+		return file.TraceEvents[i].Time < file.TraceEvents[j].Time
+	})
+	return json.NewEncoder(w).Encode(file)
+}
+
+func commonPrefix(a, b []string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// shortestInterval returns the shortest time between two samples, or a
+// millisecond when the samples do not advance in time.
+func shortestInterval(samples []Sample) int64 {
+	var shortest int64
+	for i := 1; i < len(samples); i++ {
+		if interval := samples[i].Time - samples[i-1].Time; interval > 0 && (shortest == 0 || interval < shortest) {
+			shortest = interval
+		}
+	}
+	if shortest == 0 {
+		return 1000000
+	}
+	return shortest
+}
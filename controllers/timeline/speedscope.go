@@ -0,0 +1,76 @@
+package timeline
+
+import (
+	"encoding/json"
+	"io"
+)
+
+const speedscopeSchema = "https://www.speedscope.app/file-format-schema.json"
+
+type speedscopeFile struct {
+	Schema   string              `json:"$schema"`
+	Name     string              `json:"name"`
+	Exporter string              `json:"exporter"`
+	Shared   speedscopeShared    `json:"shared"`
+	Profiles []speedscopeProfile `json:"profiles"`
+}
+
+type speedscopeShared struct {
+	Frames []speedscopeFrame `json:"frames"`
+}
+
+type speedscopeFrame struct {
+	Name string `json:"name"`
+}
+
+type speedscopeProfile struct {
+	Type       string  `json:"type"`
+	Name       string  `json:"name"`
+	Unit       string  `json:"unit"`
+	StartValue int64   `json:"startValue"`
+	EndValue   int64   `json:"endValue"`
+	Samples    [][]int `json:"samples"`
+	Weights    []int64 `json:"weights"`
+}
+
+// WriteSpeedscope writes samples as a speedscope file called name, with a
+// sampled profile per thread keeping the time order of its samples. The weights
+// of the samples are expressed in unit, one of the speedscope units such as
+// none, nanoseconds or bytes.
+func WriteSpeedscope(w io.Writer, samples []Sample, name, unit string) error {
+	file := speedscopeFile{
+		Schema:   speedscopeSchema,
+		Name:     name,
+		Exporter: "profile-pod-operator",
+		Profiles: []speedscopeProfile{},
+	}
+	frameIDs := map[string]int{}
+	frameID := func(frame string) int {
+		id, found := frameIDs[frame]
+		if !found {
+			id = len(file.Shared.Frames)
+			file.Shared.Frames = append(file.Shared.Frames, speedscopeFrame{Name: frame})
+			frameIDs[frame] = id
+		}
+		return id
+	}
+
+	names, byThread := threads(samples)
+	for _, thread := range names {
+		profile := speedscopeProfile{Type: "sampled", Name: thread, Unit: unit}
+		for _, sample := range byThread[thread] {
+			stack := make([]int, len(sample.Stack))
+			for i, frame := range sample.Stack {
+				stack[i] = frameID(frame)
+			}
+			profile.Samples = append(profile.Samples, stack)
+			profile.Weights = append(profile.Weights, sample.Weight)
+			profile.EndValue += sample.Weight
+		}
+		file.Profiles = append(file.Profiles, profile)
+	}
+	if file.Shared.Frames == nil {
+		file.Shared.Frames = []speedscopeFrame{}
+	}
+	return json.NewEncoder(w).Encode(file)
+}
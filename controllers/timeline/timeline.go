@@ -0,0 +1,74 @@
+// Package timeline converts the timestamped samples produced by the agent to
+// formats keeping their time order, speedscope and the Chrome Trace Event format.
+// Every line of the samples holds the tab separated unix time in nanoseconds,
+// thread, weight and semicolon separated stack of a sample, e.g.
+// "1672531200000000000\tmain\t1\tmain;foo;bar".
+package timeline
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sample is a stack recorded at a point in time.
+type Sample struct {
+	// Time is the unix time of the sample in nanoseconds
+	Time   int64
+	Thread string
+	Weight int64
+	// Stack holds the frames of the sample, the root frame first
+	Stack []string
+}
+
+// Parse reads timestamped samples from r and returns them sorted by time.
+func Parse(r io.Reader) ([]Sample, error) {
+	var samples []Sample
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		fields := strings.SplitN(text, "\t", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: expected 4 tab separated fields, found %d", line, len(fields))
+		}
+		time, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid time: %w", line, err)
+		}
+		weight, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid weight: %w", line, err)
+		}
+		samples = append(samples, Sample{
+			Time:   time,
+			Thread: fields[1],
+			Weight: weight,
+			Stack:  strings.Split(fields[3], ";"),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Time < samples[j].Time })
+	return samples, nil
+}
+
+// threads groups samples by thread, in the order the threads first appear.
+func threads(samples []Sample) ([]string, map[string][]Sample) {
+	var names []string
+	byThread := map[string][]Sample{}
+	for _, sample := range samples {
+		if _, found := byThread[sample.Thread]; !found {
+			names = append(names, sample.Thread)
+		}
+		byThread[sample.Thread] = append(byThread[sample.Thread], sample)
+	}
+	return names, byThread
+}
@@ -0,0 +1,223 @@
+package timeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const testSamples = "1000000\tmain\t1\tmain;foo;bar\n" +
+	"0\tmain\t2\tmain;foo\n" +
+	"1000000\tworker\t1\trun;work\n" +
+	"2000000\tmain\t1\tmain;baz\n" +
+	"2000000\tmain\t1\tmain;foo\n" +
+	"\n" +
+	"3000000\tworker\t3\trun\n"
+
+func TestParse(t *testing.T) {
+	samples, err := Parse(strings.NewReader(testSamples))
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if len(samples) != 6 {
+		t.Fatalf("parsed %d samples, expected 6", len(samples))
+	}
+	for i := 1; i < len(samples); i++ {
+		if samples[i].Time < samples[i-1].Time {
+			t.Errorf("sample %d at %d follows a sample at %d", i, samples[i].Time, samples[i-1].Time)
+		}
+	}
+	// Samples sharing a time keep the order they were read in
+	if first, second := strings.Join(samples[3].Stack, ";"), strings.Join(samples[4].Stack, ";"); first != "main;baz" || second != "main;foo" {
+		t.Errorf("samples at the same time reordered: %s then %s", first, second)
+	}
+
+	for _, input := range []string{
+		"1000\tmain\t1\n",
+		"later\tmain\t1\tmain\n",
+		"1000\tmain\tone\tmain\n",
+	} {
+		if _, err := Parse(strings.NewReader(input)); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("expected an error naming line 1 for %q, got %v", input, err)
+		}
+	}
+}
+
+func TestWriteSpeedscope(t *testing.T) {
+	samples, err := Parse(strings.NewReader(testSamples))
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	var out bytes.Buffer
+	if err := WriteSpeedscope(&out, samples, "my-app", "none"); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	var file map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &file); err != nil {
+		t.Fatalf("invalid json: %s", err)
+	}
+	if file["$schema"] != speedscopeSchema {
+		t.Errorf("$schema = %v", file["$schema"])
+	}
+	if file["name"] != "my-app" {
+		t.Errorf("name = %v", file["name"])
+	}
+	frames := file["shared"].(map[string]interface{})["frames"].([]interface{})
+	var names []string
+	for _, frame := range frames {
+		names = append(names, frame.(map[string]interface{})["name"].(string))
+	}
+	profiles := file["profiles"].([]interface{})
+	if len(profiles) != 2 {
+		t.Fatalf("found %d profiles, expected one per thread", len(profiles))
+	}
+
+	expected := map[string]struct {
+		stacks  []string
+		weights []float64
+	}{
+		"main":   {stacks: []string{"main;foo", "main;foo;bar", "main;baz", "main;foo"}, weights: []float64{2, 1, 1, 1}},
+		"worker": {stacks: []string{"run;work", "run"}, weights: []float64{1, 3}},
+	}
+	for i, thread := range []string{"main", "worker"} {
+		profile := profiles[i].(map[string]interface{})
+		if profile["type"] != "sampled" || profile["name"] != thread || profile["unit"] != "none" {
+			t.Errorf("profile %d is a %v profile %v in %v", i, profile["type"], profile["name"], profile["unit"])
+		}
+		samples, weights := profile["samples"].([]interface{}), profile["weights"].([]interface{})
+		if len(samples) != len(weights) {
+			t.Fatalf("profile %s has %d samples and %d weights", thread, len(samples), len(weights))
+		}
+		var total float64
+		for j, sample := range samples {
+			var stack []string
+			for _, index := range sample.([]interface{}) {
+				index := int(index.(float64))
+				if index < 0 || index >= len(names) {
+					t.Fatalf("profile %s references frame %d of %d", thread, index, len(names))
+				}
+				stack = append(stack, names[index])
+			}
+			if got := strings.Join(stack, ";"); got != expected[thread].stacks[j] {
+				t.Errorf("sample %d of %s = %s, expected %s", j, thread, got, expected[thread].stacks[j])
+			}
+			if weights[j].(float64) != expected[thread].weights[j] {
+				t.Errorf("weight %d of %s = %v, expected %v", j, thread, weights[j], expected[thread].weights[j])
+			}
+			total += weights[j].(float64)
+		}
+		if profile["startValue"].(float64) != 0 || profile["endValue"].(float64) != total {
+			t.Errorf("profile %s spans %v to %v, expected 0 to %v", thread, profile["startValue"], profile["endValue"], total)
+		}
+	}
+}
+
+func TestWriteSpeedscopeEmpty(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteSpeedscope(&out, nil, "empty", "none"); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if !strings.Contains(out.String(), `"frames":[]`) || !strings.Contains(out.String(), `"profiles":[]`) {
+		t.Errorf("empty speedscope file %s", out.String())
+	}
+}
+
+func TestWriteChromeTrace(t *testing.T) {
+	samples, err := Parse(strings.NewReader(testSamples +
+		// Samples sharing a time with differing stacks open and close slices
+		// at the same timestamp
+		"4000000\tworker\t1\trun;a;b\n" +
+		"4000000\tworker\t1\trun;c\n" +
+		"4000000\tworker\t1\trun;c;d\n"))
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	var out bytes.Buffer
+	if err := WriteChromeTrace(&out, samples, "my-app"); err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	var file traceFile
+	if err := json.Unmarshal(out.Bytes(), &file); err != nil {
+		t.Fatalf("invalid json: %s", err)
+	}
+
+	threadNames := map[int]string{}
+	open := map[int][]traceEvent{}
+	slices := map[string][]string{}
+	last := float64(0)
+	for _, event := range file.TraceEvents {
+		if event.Time < last {
+			t.Errorf("event %s at %v follows an event at %v", event.Name, event.Time, last)
+		}
+		last = event.Time
+		switch event.Phase {
+		case "M":
+			if event.Name == "thread_name" {
+				threadNames[event.TID] = event.Args["name"]
+			}
+		case "B":
+			open[event.TID] = append(open[event.TID], event)
+		case "E":
+			stack := open[event.TID]
+			if len(stack) == 0 {
+				t.Fatalf("end of %s at %v on thread %d without an open slice", event.Name, event.Time, event.TID)
+			}
+			begin := stack[len(stack)-1]
+			if begin.Name != event.Name {
+				t.Fatalf("end of %s at %v on thread %d closes %s", event.Name, event.Time, event.TID, begin.Name)
+			}
+			if event.Time < begin.Time {
+				t.Errorf("slice %s ends at %v before it begins at %v", event.Name, event.Time, begin.Time)
+			}
+			open[event.TID] = stack[:len(stack)-1]
+			thread := threadNames[event.TID]
+			slices[thread] = append(slices[thread], event.Name)
+		default:
+			t.Errorf("unexpected phase %s", event.Phase)
+		}
+	}
+	for tid, stack := range open {
+		if len(stack) > 0 {
+			t.Errorf("thread %d leaves %d slices open", tid, len(stack))
+		}
+	}
+	if len(threadNames) != 2 || threadNames[1] != "main" || threadNames[2] != "worker" {
+		t.Errorf("threads %v, expected main and worker", threadNames)
+	}
+
+	// Slices are listed in the order they end
+	expected := map[string]string{
+		"main":   "bar,foo,baz,foo,main",
+		"worker": "work,b,a,d,c,run",
+	}
+	for thread, names := range expected {
+		if got := strings.Join(slices[thread], ","); got != names {
+			t.Errorf("slices of %s = %s, expected %s", thread, got, names)
+		}
+	}
+}
+
+func TestShortestInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		times    []int64
+		expected int64
+	}{
+		{name: "single sample", times: []int64{5}, expected: 1000000},
+		{name: "same time", times: []int64{5, 5}, expected: 1000000},
+		{name: "same time first", times: []int64{5, 5, 5000005}, expected: 5000000},
+		{name: "shortest", times: []int64{0, 300, 400, 1000}, expected: 100},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var samples []Sample
+			for _, time := range test.times {
+				samples = append(samples, Sample{Time: time})
+			}
+			if interval := shortestInterval(samples); interval != test.expected {
+				t.Errorf("shortest interval = %d, expected %d", interval, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	agentv1 "github.com/profile-pod/profile-pod-operator/api/agent/v1"
+	"github.com/profile-pod/profile-pod-operator/controllers/stacks"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The agent writes its result envelope to its logs framed as
+//
+//	---PROFILEPOD-RESULT-BEGIN length=<bytes> sha256=<hex>---
+//	---PROFILEPOD-RESULT-DATA--- <base64 encoded result, on one or more lines>
+//	---PROFILEPOD-RESULT-END---
+//
+// where length and sha256 describe the decoded envelope. Any other log line,
+// including a line logged within the frame, is ignored.
+const (
+	resultBeginMarker = "---PROFILEPOD-RESULT-BEGIN"
+	resultDataPrefix  = "---PROFILEPOD-RESULT-DATA--- "
+	resultEndMarker   = "---PROFILEPOD-RESULT-END---"
+	markerSuffix      = "---"
+
+	// maxResultSize caps the decoded result envelope read from the logs, which
+	// the kubelet rotates at 10Mi by default
+	maxResultSize = 16 << 20
+
+	// agentStartLogLimit caps the beginning of the logs of a running agent read
+	// for the acknowledgement of the agent contract
+	agentStartLogLimit = 64 << 10
+
+	// failureLogTailLines and failureLogLimit cap the logs of a failed agent
+	// kept as the message of its target
+	failureLogTailLines = 20
+	failureLogLimit     = 4096
+)
+
+// resultError reports a result that is missing, malformed, does not match its
+// declared length and checksum, or follows another version of the agent contract.
+type resultError struct {
+	reason  string
+	message string
+	// frameMissing is set when the logs hold no result frame at all
+	frameMissing bool
+}
+
+func (err *resultError) Error() string {
+	return err.message
+}
+
+func corruptResult(format string, args ...interface{}) error {
+	return &resultError{reason: ReasonResultCorrupt, message: fmt.Sprintf(format, args...)}
+}
+
+// isResultError reports whether err is caused by the result sent by the agent
+// rather than by reading it.
+func isResultError(err error) bool {
+	var resultErr *resultError
+	return errors.As(err, &resultErr)
+}
+
+// isUnreportedResult reports whether err is caused by a result frame that is
+// missing or corrupt, as written by an agent that crashed.
+func isUnreportedResult(err error) bool {
+	var resultErr *resultError
+	return errors.As(err, &resultErr) && (resultErr.frameMissing || resultErr.reason == ReasonResultCorrupt)
+}
+
+// resultErrorReason returns the reason a target fails with because of err.
+func resultErrorReason(err error) string {
+	var resultErr *resultError
+	if errors.As(err, &resultErr) {
+		return resultErr.reason
+	}
+	return ReasonAgentFailed
+}
+
+// getPodResult streams the logs of the agent pod and returns the result framed in them.
+func getPodResult(ctx context.Context, clientset kubernetes.Interface, namespace, podName string) ([]byte, error) {
+	podLogs, err := clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{Container: ContainerName}).Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer podLogs.Close()
+	return readResult(podLogs)
+}
+
+// getAgentAPIVersion returns the version of the agent contract acknowledged at
+// the beginning of the logs of the agent pod, empty until the agent logged it.
+func getAgentAPIVersion(ctx context.Context, clientset kubernetes.Interface, namespace, podName string) (string, error) {
+	limit := int64(agentStartLogLimit)
+	podLogs, err := clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{
+		Container:  ContainerName,
+		LimitBytes: &limit,
+	}).Stream(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer podLogs.Close()
+	return readAgentAPIVersion(podLogs)
+}
+
+// readAgentAPIVersion returns the version acknowledged by the started marker
+// line of logs, empty when logs hold none.
+func readAgentAPIVersion(logs io.Reader) (string, error) {
+	reader := bufio.NewReader(logs)
+	for {
+		line, readErr := reader.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return "", readErr
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, agentv1.StartedMarker) {
+			for _, field := range strings.Fields(strings.TrimSuffix(strings.TrimPrefix(line, agentv1.StartedMarker), markerSuffix)) {
+				if key, value, _ := strings.Cut(field, "="); key == "apiVersion" {
+					return value, nil
+				}
+			}
+		}
+		if readErr == io.EOF {
+			return "", nil
+		}
+	}
+}
+
+// getAgentResult returns the result envelope framed in the logs of the agent pod.
+func getAgentResult(ctx context.Context, clientset kubernetes.Interface, namespace, podName string) (*agentv1.Result, error) {
+	payload, err := getPodResult(ctx, clientset, namespace, podName)
+	if err != nil {
+		return nil, err
+	}
+	return decodeAgentResult(payload)
+}
+
+// decodeAgentResult parses the result envelope sent by the agent.
+func decodeAgentResult(payload []byte) (*agentv1.Result, error) {
+	result := &agentv1.Result{}
+	if err := json.Unmarshal(payload, result); err != nil {
+		return nil, corruptResult("Failed to parse profiler result: %s", err)
+	}
+	if result.APIVersion != agentv1.APIVersion {
+		return nil, &resultError{
+			reason: ReasonAgentVersionMismatch,
+			message: fmt.Sprintf("The agent image %s answered with version %q of the agent contract, expected %q",
+				GetAgentImage(), result.APIVersion, agentv1.APIVersion),
+		}
+	}
+	return result, nil
+}
+
+// artifactData returns the gzipped data of artifact.
+func artifactData(artifact *agentv1.Artifact) ([]byte, error) {
+	switch artifact.Encoding {
+	case agentv1.EncodingGzip:
+		return artifact.Data, nil
+	case agentv1.EncodingIdentity, "":
+		return stacks.Compress(artifact.Data)
+	default:
+		return nil, corruptResult("Unsupported %s artifact encoding %q", artifact.Format, artifact.Encoding)
+	}
+}
+
+// readResult reads the framed result from logs and verifies its length and checksum.
+func readResult(logs io.Reader) ([]byte, error) {
+	reader := bufio.NewReader(logs)
+	var encoded strings.Builder
+	length, sum := int64(-1), ""
+	for {
+		line, readErr := reader.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, readErr
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, resultBeginMarker):
+			if length >= 0 {
+				return nil, corruptResult("Profiler result frame started twice")
+			}
+			var err error
+			length, sum, err = parseBeginMarker(line)
+			if err != nil {
+				return nil, err
+			}
+		case line == resultEndMarker:
+			if length < 0 {
+				return nil, corruptResult("Profiler result frame ended before it started")
+			}
+			return decodeResult(encoded.String(), length, sum)
+		case length >= 0 && strings.HasPrefix(line, resultDataPrefix):
+			data := strings.TrimPrefix(line, resultDataPrefix)
+			if encoded.Len()+len(data) > base64.StdEncoding.EncodedLen(int(length)) {
+				return nil, corruptResult("Profiler result holds more data than the %d bytes declared", length)
+			}
+			encoded.WriteString(data)
+		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+	if length < 0 {
+		// Agents predating the framed result envelope write their result as is
+		return nil, &resultError{
+			reason:       ReasonAgentVersionMismatch,
+			message:      fmt.Sprintf("Profiler logs hold no result frame, the agent image %s does not implement the agent contract %s", GetAgentImage(), agentv1.APIVersion),
+			frameMissing: true,
+		}
+	}
+	return nil, corruptResult("Profiler result is truncated, the end of its frame is missing")
+}
+
+// parseBeginMarker returns the length and checksum declared by the begin marker line.
+func parseBeginMarker(line string) (int64, string, error) {
+	fields := strings.Fields(strings.TrimSuffix(strings.TrimPrefix(line, resultBeginMarker), markerSuffix))
+	length, sum := int64(-1), ""
+	for _, field := range fields {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "length":
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || parsed < 0 {
+				return 0, "", corruptResult("Invalid profiler result length %q", value)
+			}
+			if parsed > maxResultSize {
+				return 0, "", corruptResult("Profiler result of %d bytes exceeds the limit of %d bytes", parsed, maxResultSize)
+			}
+			length = parsed
+		case "sha256":
+			sum = strings.ToLower(value)
+		}
+	}
+	if length < 0 || sum == "" {
+		return 0, "", corruptResult("Profiler result frame %q lacks a length or a sha256 checksum", line)
+	}
+	return length, sum, nil
+}
+
+// decodeResult decodes the base64 encoded result and verifies it.
+func decodeResult(encoded string, length int64, sum string) ([]byte, error) {
+	result, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, corruptResult("Failed to decode profiler result: %s", err)
+	}
+	if int64(len(result)) != length {
+		return nil, corruptResult("Profiler result has %d bytes, %d declared", len(result), length)
+	}
+	if actual := checksum(result); actual != sum {
+		return nil, corruptResult("Profiler result checksum %s does not match the declared %s", actual, sum)
+	}
+	return result, nil
+}
+
+// getPodLogTail returns the last lines of the logs of a failed agent pod,
+// capped to failureLogLimit bytes.
+func getPodLogTail(ctx context.Context, clientset kubernetes.Interface, namespace, podName string) (string, error) {
+	tailLines := int64(failureLogTailLines)
+	podLogs, err := clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{
+		Container: ContainerName,
+		TailLines: &tailLines,
+	}).Stream(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer podLogs.Close()
+
+	logs, err := io.ReadAll(podLogs)
+	if err != nil {
+		return "", err
+	}
+	if len(logs) > failureLogLimit {
+		logs = logs[len(logs)-failureLogLimit:]
+	}
+	return strings.TrimSpace(string(logs)), nil
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	agentv1 "github.com/profile-pod/profile-pod-operator/api/agent/v1"
+)
+
+// frame returns the log lines framing result the way the agent writes them,
+// with its base64 encoding split every width characters.
+func frame(result []byte, length int, sum string, width int) []string {
+	encoded := base64.StdEncoding.EncodeToString(result)
+	lines := []string{fmt.Sprintf("%s length=%d sha256=%s%s", resultBeginMarker, length, sum, markerSuffix)}
+	for len(encoded) > width {
+		lines = append(lines, resultDataPrefix+encoded[:width])
+		encoded = encoded[width:]
+	}
+	return append(lines, resultDataPrefix+encoded, resultEndMarker)
+}
+
+func TestReadResult(t *testing.T) {
+	result := []byte(`{"apiVersion":"agent.profilepod.io/v1","language":"java","samples":42}`)
+	valid := frame(result, len(result), checksum(result), 16)
+	join := func(lines ...[]string) string {
+		var all []string
+		for _, part := range lines {
+			all = append(all, part...)
+		}
+		return strings.Join(all, "\n") + "\n"
+	}
+	tests := []struct {
+		name         string
+		logs         string
+		reason       string
+		err          string
+		frameMissing bool
+	}{
+		{name: "frame", logs: join(valid)},
+		{name: "crlf", logs: strings.ReplaceAll(join(valid), "\n", "\r\n")},
+		{name: "without final newline", logs: strings.TrimSuffix(join(valid), "\n")},
+		{
+			name: "log noise around and between lines",
+			logs: join([]string{"Detected java process 7", ""}, valid[:2], []string{"[async-profiler] Profiling stopped", ""}, valid[2:], []string{"Done"}),
+		},
+		{
+			// Single words are valid base64
+			name: "alphanumeric log noise between lines",
+			logs: join(valid[:2], []string{"Profiling", "Done", "42"}, valid[2:3], []string{"Stopping"}, valid[3:]),
+		},
+		{name: "upper case checksum", logs: join(frame(result, len(result), strings.ToUpper(checksum(result)), 16))},
+		{
+			name:   "truncated frame",
+			logs:   join(valid[:len(valid)-2]),
+			reason: ReasonResultCorrupt,
+			err:    "the end of its frame is missing",
+		},
+		{
+			name:   "missing end marker",
+			logs:   join(valid[:len(valid)-1], []string{"Done"}),
+			reason: ReasonResultCorrupt,
+			err:    "the end of its frame is missing",
+		},
+		{
+			name:   "truncated data",
+			logs:   join(valid[:2], valid[len(valid)-1:]),
+			reason: ReasonResultCorrupt,
+		},
+		{
+			name:   "sha256 mismatch",
+			logs:   join(frame(result, len(result), checksum([]byte("another result")), 16)),
+			reason: ReasonResultCorrupt,
+			err:    "does not match the declared",
+		},
+		{
+			name:   "length mismatch",
+			logs:   join(frame(result, len(result)+1, checksum(result), 16)),
+			reason: ReasonResultCorrupt,
+			err:    fmt.Sprintf("has %d bytes, %d declared", len(result), len(result)+1),
+		},
+		{
+			name:   "multiple begin markers",
+			logs:   join(valid[:2], valid),
+			reason: ReasonResultCorrupt,
+			err:    "started twice",
+		},
+		{
+			name:   "end before begin",
+			logs:   join([]string{resultEndMarker}, valid),
+			reason: ReasonResultCorrupt,
+			err:    "ended before it started",
+		},
+		{
+			name:   "begin marker without checksum",
+			logs:   join([]string{resultBeginMarker + " length=3---", resultDataPrefix + "YWJj", resultEndMarker}),
+			reason: ReasonResultCorrupt,
+			err:    "lacks a length or a sha256 checksum",
+		},
+		{
+			name:   "unmarked data",
+			logs:   join([]string{valid[0], strings.TrimPrefix(valid[1], resultDataPrefix)}, valid[2:]),
+			reason: ReasonResultCorrupt,
+		},
+		{
+			name:   "more data than declared",
+			logs:   join(frame(result, len(result)-10, checksum(result), 16)),
+			reason: ReasonResultCorrupt,
+			err:    fmt.Sprintf("more data than the %d bytes declared", len(result)-10),
+		},
+		{
+			name:   "result above the limit",
+			logs:   join([]string{fmt.Sprintf("%s length=%d sha256=abc---", resultBeginMarker, maxResultSize+1), resultEndMarker}),
+			reason: ReasonResultCorrupt,
+			err:    "exceeds the limit",
+		},
+		{
+			name:   "negative length",
+			logs:   join([]string{resultBeginMarker + " length=-1 sha256=abc---", resultEndMarker}),
+			reason: ReasonResultCorrupt,
+			err:    "Invalid profiler result length",
+		},
+		{
+			name:         "no frame",
+			logs:         string(result) + "\n",
+			reason:       ReasonAgentVersionMismatch,
+			frameMissing: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload, err := readResult(strings.NewReader(test.logs))
+			if test.reason == "" {
+				if err != nil {
+					t.Fatalf("unexpected error %s", err)
+				}
+				if string(payload) != string(result) {
+					t.Fatalf("read %q, expected %q", payload, result)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected an error with reason %s", test.reason)
+			}
+			if reason := resultErrorReason(err); reason != test.reason {
+				t.Errorf("reason = %s, expected %s", reason, test.reason)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("error %q does not contain %q", err, test.err)
+			}
+			if isUnreportedResult(err) != (test.frameMissing || test.reason == ReasonResultCorrupt) {
+				t.Errorf("isUnreportedResult = %t", isUnreportedResult(err))
+			}
+		})
+	}
+}
+
+func TestDecodeAgentResult(t *testing.T) {
+	result, err := decodeAgentResult([]byte(`{"apiVersion":"` + agentv1.APIVersion + `","samples":42}`))
+	if err != nil || result.Samples != 42 {
+		t.Fatalf("decoded %+v, %v", result, err)
+	}
+	if _, err := decodeAgentResult([]byte(`{"apiVersion":"agent.profilepod.io/v0"}`)); resultErrorReason(err) != ReasonAgentVersionMismatch {
+		t.Errorf("expected a version mismatch, got %v", err)
+	}
+	if _, err := decodeAgentResult([]byte(`{"apiVersion":`)); resultErrorReason(err) != ReasonResultCorrupt {
+		t.Errorf("expected a corrupt result, got %v", err)
+	}
+}
+
+func TestReadAgentAPIVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		logs     string
+		expected string
+	}{
+		{name: "acknowledged", logs: agentv1.StartedMarker + " apiVersion=agent.profilepod.io/v1---\nprofiling\n", expected: agentv1.APIVersion},
+		{name: "after other lines", logs: "starting\n  " + agentv1.StartedMarker + " apiVersion=agent.profilepod.io/v2---  \n", expected: "agent.profilepod.io/v2"},
+		{name: "without newline", logs: agentv1.StartedMarker + " apiVersion=agent.profilepod.io/v1---", expected: agentv1.APIVersion},
+		{name: "not yet acknowledged", logs: "starting\nprofiling\n"},
+		{name: "without version", logs: agentv1.StartedMarker + "---\n"},
+		{name: "empty", logs: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			version, err := readAgentAPIVersion(strings.NewReader(test.logs))
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if version != test.expected {
+				t.Errorf("version = %q, expected %q", version, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// ReasonTTLExpired is the reason of the event of a PodFlame deleted after its time to live
+const ReasonTTLExpired = "TTLExpired"
+
+// DefaultTTLSecondsAfterFinished returns the operator default of the time to
+// live of finished PodFlames from the --ttl-seconds-after-finished flag, nil
+// when seconds is negative and they are kept forever.
+func DefaultTTLSecondsAfterFinished(seconds int) *int32 {
+	if seconds < 0 {
+		return nil
+	}
+	ttl := int32(seconds)
+	return &ttl
+}
+
+// ttlAfterFinished returns the number of seconds podflame is kept once
+// finished, nil when it is kept forever.
+func (reconciler *PodFlameReconciler) ttlAfterFinished(podflame *profilepodiov1alpha1.PodFlame) *int32 {
+	if podflame.Spec.TTLSecondsAfterFinished != nil {
+		return podflame.Spec.TTLSecondsAfterFinished
+	}
+	return reconciler.DefaultTTLSecondsAfterFinished
+}
+
+// expireFinished deletes a finished podflame once its time to live elapsed,
+// its results are deleted by the finalizer. Otherwise it returns when to
+// requeue podflame to delete it.
+func (reconciler *PodFlameReconciler) expireFinished(ctx context.Context, podflame *profilepodiov1alpha1.PodFlame) (ctrl.Result, error) {
+	ttl := reconciler.ttlAfterFinished(podflame)
+	if ttl == nil || !isFinished(podflame) || podflame.Status.CompletionTime == nil {
+		return ctrl.Result{}, nil
+	}
+	expiry := podflame.Status.CompletionTime.Add(time.Duration(*ttl) * time.Second)
+	if remaining := time.Until(expiry); remaining > 0 {
+		return ctrl.Result{RequeueAfter: remaining}, nil
+	}
+	log.FromContext(ctx).Info("Deleting podflame after its time to live", "ttlSecondsAfterFinished", *ttl)
+	if err := reconciler.Delete(ctx, podflame, client.Preconditions{UID: &podflame.UID}); client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, err
+	}
+	reconciler.Recorder.Event(podflame, "Normal", ReasonTTLExpired,
+		fmt.Sprintf("PodFlame %s deleted %d seconds after it finished", podflame.Name, *ttl))
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+func int32Pointer(i int32) *int32 { return &i }
+
+// finishedPodFlame returns a PodFlame that succeeded finishedFor ago.
+func finishedPodFlame(finishedFor time.Duration, ttl *int32) *profilepodiov1alpha1.PodFlame {
+	podflame := testPodFlame("my-app-flame", "0123456789abcdef")
+	podflame.Spec.TTLSecondsAfterFinished = ttl
+	podflame.Status.Phase = profilepodiov1alpha1.PodFlameSucceeded
+	completion := metav1.NewTime(time.Now().Add(-finishedFor))
+	podflame.Status.CompletionTime = &completion
+	return podflame
+}
+
+func TestExpireFinished(t *testing.T) {
+	tests := []struct {
+		name       string
+		podflame   *profilepodiov1alpha1.PodFlame
+		defaultTTL int
+		deleted    bool
+		// requeue is the time left before the expiry, within a minute, zero when the PodFlame is not requeued
+		requeue time.Duration
+	}{
+		{name: "spec ttl expired", podflame: finishedPodFlame(2*time.Minute, int32Pointer(60)), defaultTTL: -1, deleted: true},
+		{name: "spec ttl not expired", podflame: finishedPodFlame(time.Minute, int32Pointer(3600)), defaultTTL: -1, requeue: 58 * time.Minute},
+		{name: "spec ttl over the default", podflame: finishedPodFlame(time.Minute, int32Pointer(3600)), defaultTTL: 0, requeue: 58 * time.Minute},
+		{name: "spec ttl of zero", podflame: finishedPodFlame(0, int32Pointer(0)), defaultTTL: 3600, deleted: true},
+		{name: "default ttl expired", podflame: finishedPodFlame(2*time.Hour, nil), defaultTTL: 3600, deleted: true},
+		{name: "default ttl not expired", podflame: finishedPodFlame(30*time.Minute, nil), defaultTTL: 3600, requeue: 29 * time.Minute},
+		{name: "negative default keeps the podflame", podflame: finishedPodFlame(24*time.Hour, nil), defaultTTL: -1},
+		{name: "running", podflame: func() *profilepodiov1alpha1.PodFlame {
+			podflame := finishedPodFlame(time.Hour, int32Pointer(0))
+			podflame.Status.Phase = profilepodiov1alpha1.PodFlameRunning
+			return podflame
+		}(), defaultTTL: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			recorder := record.NewFakeRecorder(10)
+			reconciler := &PodFlameReconciler{
+				Client:                         testClient(test.podflame.DeepCopy()),
+				Recorder:                       recorder,
+				DefaultTTLSecondsAfterFinished: DefaultTTLSecondsAfterFinished(test.defaultTTL),
+			}
+			result, err := reconciler.expireFinished(ctx, test.podflame)
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			err = reconciler.Get(ctx, types.NamespacedName{Namespace: test.podflame.Namespace, Name: test.podflame.Name}, &profilepodiov1alpha1.PodFlame{})
+			if deleted := apierrors.IsNotFound(err); deleted != test.deleted {
+				t.Errorf("deleted = %t (%v), expected %t", deleted, err, test.deleted)
+			}
+			if hasEvent(recorder, ReasonTTLExpired) != test.deleted {
+				t.Errorf("expected a %s event only when the podflame is deleted", ReasonTTLExpired)
+			}
+			if test.requeue == 0 {
+				if result.RequeueAfter != 0 {
+					t.Errorf("requeued after %s", result.RequeueAfter)
+				}
+				return
+			}
+			if result.RequeueAfter < test.requeue || result.RequeueAfter > test.requeue+time.Minute {
+				t.Errorf("requeued after %s, expected about %s", result.RequeueAfter, test.requeue)
+			}
+		})
+	}
+}
+
+func TestExpireFinishedDeletedPodFlame(t *testing.T) {
+	// A PodFlame deleted since it was read is not an error
+	reconciler := &PodFlameReconciler{
+		Client:                         testClient(),
+		Recorder:                       record.NewFakeRecorder(10),
+		DefaultTTLSecondsAfterFinished: DefaultTTLSecondsAfterFinished(0),
+	}
+	if _, err := reconciler.expireFinished(context.Background(), finishedPodFlame(time.Minute, nil)); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+}
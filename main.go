@@ -19,6 +19,12 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
+	"time"
+
+	// Embed the time zone database for the time zones of PodFlameSchedules,
+	// the distroless image does not have one.
+	_ "time/tzdata"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -32,7 +38,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	profilepodiov1alpha1 "github.com/profile-pod/profile-pod-operator/api/v1alpha1"
+	profilepodiov1beta1 "github.com/profile-pod/profile-pod-operator/api/v1beta1"
 	"github.com/profile-pod/profile-pod-operator/controllers"
+	"github.com/profile-pod/profile-pod-operator/controllers/exporter"
 	//+kubebuilder:scaffold:imports
 
 	"k8s.io/client-go/kubernetes"
@@ -47,6 +55,7 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(profilepodiov1alpha1.AddToScheme(scheme))
+	utilruntime.Must(profilepodiov1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -54,11 +63,57 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var resultStoreOptions controllers.ResultStoreOptions
+	var exportOptions controllers.ExportOptions
+	var exportDeadline time.Duration
+	var ttlSecondsAfterFinished int
+	var sidecarContainers string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&resultStoreOptions.Backend, "result-backend", controllers.BackendConfigMap,
+		"The backend storing profiling results, configmap, secret or s3. "+
+			"ConfigMaps and Secrets are stored in the namespace of their PodFlame. "+
+			"The secret backend requires the secret_backend_role of config/rbac, which grants write access to the Secrets of every namespace.")
+	flag.StringVar(&resultStoreOptions.S3.Endpoint, "s3-endpoint", "",
+		"The URL of the S3-compatible endpoint of the s3 result backend.")
+	flag.StringVar(&resultStoreOptions.S3.Bucket, "s3-bucket", "", "The bucket of the s3 result backend.")
+	flag.StringVar(&resultStoreOptions.S3.Prefix, "s3-prefix", "", "The key prefix of the results stored by the s3 result backend.")
+	flag.StringVar(&resultStoreOptions.S3.Region, "s3-region", "us-east-1", "The region of the s3 result backend.")
+	flag.StringVar(&resultStoreOptions.S3.CredentialsSecret, "s3-credentials-secret", "",
+		"The Secret in the operator namespace holding the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY of the s3 result backend.")
+	flag.DurationVar(&resultStoreOptions.S3.PresignExpiry, "s3-presign-expiry", 0,
+		"The lifetime of the presigned download URL of results stored by the s3 result backend, 0 disables it.")
+	flag.StringVar(&exportOptions.Pyroscope.URL, "pyroscope-url", "",
+		"The URL of the Pyroscope-compatible server completed profiles are pushed to, empty disables the export.")
+	flag.StringVar(&exportOptions.Pyroscope.Format, "pyroscope-format", exporter.PyroscopeFolded,
+		"The format of the profiles pushed to the Pyroscope-compatible server, folded or pprof.")
+	flag.IntVar(&exportOptions.Pyroscope.Retries, "pyroscope-retries", 2,
+		"The number of times a profile push failing with a network or server error is retried.")
+	flag.DurationVar(&exportOptions.Pyroscope.Timeout, "pyroscope-timeout", 30*time.Second,
+		"The timeout of a single profile push to the Pyroscope-compatible server.")
+	flag.StringVar(&exportOptions.OTLP.Endpoint, "otlp-endpoint", "",
+		"The URL of the OpenTelemetry collector completed profiles are sent to, e.g. http://otel-collector:4317, empty disables the export.")
+	flag.StringVar(&exportOptions.OTLP.Protocol, "otlp-protocol", exporter.OTLPGRPC,
+		"The transport to the OpenTelemetry collector, grpc or http.")
+	flag.IntVar(&exportOptions.OTLP.Retries, "otlp-retries", 2,
+		"The number of times a profile export failing with a transient error is retried.")
+	flag.DurationVar(&exportOptions.OTLP.Timeout, "otlp-timeout", 30*time.Second,
+		"The timeout of a single profile export to the OpenTelemetry collector.")
+	flag.Func("otlp-allowed-endpoints",
+		"The comma separated URLs of the OpenTelemetry collectors PodFlames may send their profiles to instead of --otlp-endpoint.",
+		func(value string) error {
+			exportOptions.OTLP.AllowedEndpoints = strings.Split(value, ",")
+			return nil
+		})
+	flag.DurationVar(&exportDeadline, "export-deadline", controllers.DefaultExportDeadline,
+		"The time allowed to push a profile to every exporter, retries included.")
+	flag.IntVar(&ttlSecondsAfterFinished, "ttl-seconds-after-finished", -1,
+		"The number of seconds finished PodFlames are kept when they do not set ttlSecondsAfterFinished, a negative value keeps them.")
+	flag.StringVar(&sidecarContainers, "sidecar-containers", "istio-proxy,linkerd-proxy,envoy,vault-agent,cloud-sql-proxy",
+		"The comma separated names of the sidecar containers skipped when choosing the profiled container of a PodFlame that does not set one.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -104,16 +159,60 @@ func main() {
 		os.Exit(1)
 	}
 
+	ctx := ctrl.SetupSignalHandler()
+	resultStore, err := controllers.NewResultStore(ctx, resultStoreOptions, clientset, ns)
+	if err != nil {
+		setupLog.Error(err, "unable to create result store")
+		os.Exit(1)
+	}
+
+	exporters, err := controllers.NewExporters(exportOptions)
+	if err != nil {
+		setupLog.Error(err, "unable to create exporters")
+		os.Exit(1)
+	}
+
+	exportQueue := controllers.NewExportQueue(mgr.GetClient(), mgr.GetEventRecorderFor("podflame-controller"), exportDeadline)
+	if err = mgr.Add(exportQueue); err != nil {
+		setupLog.Error(err, "unable to add export queue")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.PodFlameReconciler{
-		Client:            mgr.GetClient(),
-		Scheme:            mgr.GetScheme(),
-		Clientset:         clientset,
-		OperatorNamesapce: ns,
-		Recorder:          mgr.GetEventRecorderFor("podflame-controller"),
+		Client:                         mgr.GetClient(),
+		Scheme:                         mgr.GetScheme(),
+		Clientset:                      clientset,
+		RestConfig:                     mgr.GetConfig(),
+		OperatorNamesapce:              ns,
+		Recorder:                       mgr.GetEventRecorderFor("podflame-controller"),
+		ResultStore:                    resultStore,
+		Exporters:                      exporters,
+		ExportQueue:                    exportQueue,
+		OTLPAllowedEndpoints:           exportOptions.OTLP.AllowedEndpoints,
+		SidecarContainers:              strings.Split(sidecarContainers, ","),
+		DefaultTTLSecondsAfterFinished: controllers.DefaultTTLSecondsAfterFinished(ttlSecondsAfterFinished),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PodFlame")
 		os.Exit(1)
 	}
+	// Webhooks need a serving certificate, set ENABLE_WEBHOOKS=false to run the manager without them
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&controllers.PodFlameWebhook{
+			Clientset:         clientset,
+			SidecarContainers: strings.Split(sidecarContainers, ","),
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "PodFlame")
+			os.Exit(1)
+		}
+	}
+	if err = (&controllers.PodFlameScheduleReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("podflameschedule-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PodFlameSchedule")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -126,7 +225,7 @@ func main() {
 	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}